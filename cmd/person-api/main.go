@@ -14,12 +14,18 @@ import (
 	"person-api/internal/logger"
 	"person-api/internal/services/enrichment"
 	"person-api/internal/services/person"
+	"person-api/internal/storage"
+	"person-api/internal/storage/memory"
 	"person-api/internal/storage/postgres"
 
 	_ "person-api/internal/handler/docs"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+
 	cfg, err := configs.LoadConfig()
 	if err != nil {
 		panic(err)
@@ -27,17 +33,94 @@ func main() {
 
 	logg := logger.NewLogger(cfg.LogLevel)
 
-	store, err := postgres.NewPostgresStorage(cfg.DBDSN)
+	var store storage.Storage
+	switch cfg.StorageDriver {
+	case configs.StorageMemory:
+		logg.Warn("using in-memory storage, data will be lost on restart")
+		store = memory.NewMemoryStorage()
+	default:
+		pg, err := postgres.NewPostgresStorage(cfg.DBDSN)
+		if err != nil {
+			logg.Error("connect postgres", "err", err)
+			os.Exit(1)
+		}
+		if cfg.MigrateOnStart {
+			applied, err := pg.Migrate(context.Background(), postgres.MigrateUp)
+			for _, m := range applied {
+				logg.Info("migration applied", "file", m.File)
+			}
+			if err != nil {
+				logg.Error("migrate", "err", err)
+				os.Exit(1)
+			}
+		}
+		store = pg
+	}
+
+	providerCfgs := make([]enrichment.ProviderConfig, len(cfg.EnrichmentProviders))
+	for i, p := range cfg.EnrichmentProviders {
+		providerCfgs[i] = enrichment.ProviderConfig{
+			Name:      p.Name,
+			BaseURL:   p.BaseURL,
+			APIKey:    p.APIKey,
+			Timeout:   p.Timeout,
+			Enabled:   p.Enabled,
+			BatchSize: p.BatchSize,
+			Retry: enrichment.RetryConfig{
+				Retries:   cfg.EnrichmentRetries,
+				BaseDelay: cfg.EnrichmentRetryBaseDelay,
+				MaxDelay:  cfg.EnrichmentRetryMaxDelay,
+				Budget:    cfg.EnrichmentRetryBudget,
+			},
+			Breaker: enrichment.BreakerConfig{
+				Threshold: cfg.EnrichmentBreakerThreshold,
+				Cooldown:  cfg.EnrichmentBreakerCooldown,
+			},
+		}
+	}
+	providers, err := enrichment.Providers(providerCfgs, nil)
 	if err != nil {
-		logg.Error("connect postgres", "err", err)
+		logg.Error("enrichment providers", "err", err)
 		os.Exit(1)
 	}
-
-	enrichSvc := enrichment.NewService()
-	personSvc := person.NewPersonService(logg, enrichSvc, store)
+	for _, p := range providers {
+		logg.Info("enrichment provider enabled", "name", p.Name(), "attribute", p.Attribute())
+	}
+	enrichSvc := enrichment.NewService(providers...)
+	if cfg.EnrichmentCacheTTL > 0 {
+		cache := enrichment.NewCache(enrichment.CacheConfig{
+			Size:        cfg.EnrichmentCacheSize,
+			TTL:         cfg.EnrichmentCacheTTL,
+			NegativeTTL: cfg.EnrichmentCacheNegativeTTL,
+		}, store)
+		enrichSvc = enrichment.NewCachedService(cache, providers...)
+	}
+	opts := []person.Option{person.WithRepairPolicy(person.RepairPolicy{
+		Attempts: cfg.EnrichmentRepairAttempts,
+		Delay:    cfg.EnrichmentRepairDelay,
+		MaxDelay: cfg.EnrichmentRepairMaxDelay,
+	}), person.WithIdempotencyLease(cfg.IdempotencyLease)}
+	if cfg.EnrichmentMode == configs.EnrichmentAsync {
+		opts = append(opts, person.WithAsyncEnrichment())
+	}
+	personSvc := person.NewPersonService(logg, enrichSvc, store, opts...)
 
 	r := handler.NewRouter(personSvc)
 
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	if cfg.PurgeRetention > 0 || cfg.IdempotencyKeyTTL > 0 {
+		go person.RunPurger(bgCtx, logg, personSvc, cfg.PurgeInterval, cfg.PurgeRetention, cfg.IdempotencyKeyTTL)
+	}
+	// записи с назначенными повторами остаются и после уменьшения ENRICHMENT_REPAIR_ATTEMPTS
+	go person.RunEnrichmentRepairer(bgCtx, logg, personSvc, cfg.EnrichmentRepairInterval)
+	// задания в очереди остаются и после переключения на ENRICHMENT_MODE=sync
+	workersDone := make(chan struct{})
+	go func() {
+		defer close(workersDone)
+		person.RunEnrichmentWorkers(bgCtx, logg, personSvc, cfg.EnrichmentWorkers, cfg.EnrichmentPollInterval)
+	}()
+
 	srv := &http.Server{
 		Addr:         ":" + cfg.ServerPort,
 		Handler:      r,
@@ -57,11 +140,17 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	logg.Info("shutting down")
+	stopBackground()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
 		logg.Error("shutdown", "err", err)
 	}
+	// обработчики возвращают незавершённые задания в очередь
+	select {
+	case <-workersDone:
+	case <-ctx.Done():
+	}
 	logg.Info("stopped")
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"person-api/configs"
+	"person-api/internal/storage/postgres"
+)
+
+const migrateUsage = "usage: person-api migrate up|down|redo|status"
+
+// runMigrate выполняет подкоманду `person-api migrate <command>` и возвращает код выхода.
+func runMigrate(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	command := args[0]
+	switch command {
+	case postgres.MigrateUp, postgres.MigrateDown, postgres.MigrateRedo, postgres.MigrateStatus:
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	cfg, err := configs.LoadMigrateConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	store, err := postgres.NewPostgresStorage(cfg.DBDSN)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer store.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	migrations, err := store.Migrate(ctx, command)
+	for _, m := range migrations {
+		switch {
+		case command == postgres.MigrateStatus && m.Applied:
+			fmt.Printf("applied  %s  %s\n", m.AppliedAt, m.File)
+		case command == postgres.MigrateStatus:
+			fmt.Printf("pending  %-19s  %s\n", "", m.File)
+		case m.Applied:
+			fmt.Printf("up    %s\n", m.File)
+		default:
+			fmt.Printf("down  %s\n", m.File)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if command == postgres.MigrateUp && len(migrations) == 0 {
+		fmt.Println("no pending migrations")
+	}
+	return 0
+}
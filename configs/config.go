@@ -2,29 +2,295 @@ package configs
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+const (
+	StoragePostgres = "postgres"
+	StorageMemory   = "memory"
+)
+
+const (
+	EnrichmentSync  = "sync"
+	EnrichmentAsync = "async"
+)
+
 type Config struct {
-	DBDSN      string
-	ServerPort string
-	LogLevel   string
+	// StorageDriver — postgres или memory; memory не требует DB_DSN и теряет данные при перезапуске.
+	StorageDriver string
+	DBDSN         string
+	ServerPort    string
+	LogLevel      string
+	// PurgeRetention — сколько хранить удалённые записи; 0 отключает очистку.
+	PurgeRetention time.Duration
+	PurgeInterval  time.Duration
+	// IdempotencyKeyTTL — сколько хранить ответы для повторов по Idempotency-Key; 0 — не удалять.
+	IdempotencyKeyTTL time.Duration
+	// IdempotencyLease — через сколько ключ без ответа можно занять снова; 0 — только после удаления.
+	IdempotencyLease time.Duration
+	// EnrichmentProviders — провайдеры обогащения в порядке приоритета.
+	EnrichmentProviders []EnrichmentProvider
+	// EnrichmentCacheTTL — сколько хранить найденные провайдерами значения; 0 отключает кеш.
+	EnrichmentCacheTTL time.Duration
+	// EnrichmentCacheNegativeTTL — сколько помнить, что провайдер не знает имя; 0 — не помнить.
+	EnrichmentCacheNegativeTTL time.Duration
+	// EnrichmentCacheSize — сколько ответов держать в памяти процесса поверх таблицы в базе.
+	EnrichmentCacheSize int
+	// EnrichmentRetries — сколько раз повторять запрос к провайдеру при сбое сети, 429 и 5xx.
+	EnrichmentRetries int
+	// EnrichmentRetryBaseDelay — первая пауза между повторами, дальше она удваивается
+	// до EnrichmentRetryMaxDelay; Retry-After длиннее максимума повтор отменяет.
+	EnrichmentRetryBaseDelay time.Duration
+	EnrichmentRetryMaxDelay  time.Duration
+	// EnrichmentRetryBudget — сколько всего может длиться запрос к провайдеру со
+	// всеми повторами; должен укладываться в таймаут ответа сервера (10 секунд).
+	EnrichmentRetryBudget time.Duration
+	// EnrichmentBreakerThreshold — после скольких неудачных запросов подряд провайдер
+	// отключается на EnrichmentBreakerCooldown; 0 — не отключать.
+	EnrichmentBreakerThreshold int
+	EnrichmentBreakerCooldown  time.Duration
+	// EnrichmentRepairAttempts — сколько всего попыток получить атрибут, который не
+	// удалось обогатить при создании записи; 0 или 1 — не повторять.
+	EnrichmentRepairAttempts int
+	// EnrichmentRepairDelay — пауза перед первым повтором, дальше она удваивается
+	// до EnrichmentRepairMaxDelay.
+	EnrichmentRepairDelay    time.Duration
+	EnrichmentRepairMaxDelay time.Duration
+	// EnrichmentRepairInterval — как часто искать записи, которые пора дообогатить.
+	EnrichmentRepairInterval time.Duration
+	// EnrichmentMode — sync (обогащение в запросе) или async (через очередь в базе).
+	EnrichmentMode string
+	// EnrichmentWorkers — сколько обработчиков очереди обогащения работает одновременно;
+	// 0 — экземпляр только ставит задания, выполняют их другие.
+	EnrichmentWorkers int
+	// EnrichmentPollInterval — как часто обработчик проверяет пустую очередь.
+	EnrichmentPollInterval time.Duration
+	// MigrateOnStart применяет миграции перед запуском сервера (только для postgres).
+	MigrateOnStart bool
+}
+
+// EnrichmentProvider — настройки провайдера обогащения из переменных
+// <ИМЯ>_URL, <ИМЯ>_API_KEY, <ИМЯ>_TIMEOUT, <ИМЯ>_ENABLED и <ИМЯ>_BATCH_SIZE,
+// например AGIFY_URL.
+type EnrichmentProvider struct {
+	Name    string
+	BaseURL string
+	// APIKey передаётся в параметре apikey; пустой — бесплатный тариф.
+	APIKey  string
+	Timeout time.Duration
+	Enabled bool
+	// BatchSize — сколько имён отправлять одним запросом; 1 — по одному.
+	BatchSize int
+}
+
+// defaultEnrichmentURLs — адреса встроенных провайдеров по умолчанию.
+var defaultEnrichmentURLs = map[string]string{
+	"agify":       "https://api.agify.io/",
+	"genderize":   "https://api.genderize.io/",
+	"nationalize": "https://api.nationalize.io/",
 }
 
 func LoadConfig() (Config, error) {
 	_ = godotenv.Load() // если нет .env – читаем из окружения
 	cfg := Config{
-		DBDSN:      os.Getenv("DB_DSN"),
-		ServerPort: os.Getenv("SERVER_PORT"),
-		LogLevel:   os.Getenv("LOG_LEVEL"),
+		StorageDriver: os.Getenv("STORAGE_DRIVER"),
+		DBDSN:         os.Getenv("DB_DSN"),
+		ServerPort:    os.Getenv("SERVER_PORT"),
+		LogLevel:      os.Getenv("LOG_LEVEL"),
 	}
-	if cfg.DBDSN == "" {
+	switch cfg.StorageDriver {
+	case "":
+		cfg.StorageDriver = StoragePostgres
+	case StoragePostgres, StorageMemory:
+	default:
+		return cfg, fmt.Errorf("STORAGE_DRIVER must be %s or %s", StoragePostgres, StorageMemory)
+	}
+	if cfg.StorageDriver == StoragePostgres && cfg.DBDSN == "" {
 		return cfg, fmt.Errorf("DB_DSN is required")
 	}
 	if cfg.ServerPort == "" {
 		return cfg, fmt.Errorf("SERVER_PORT is required")
 	}
+	var err error
+	if cfg.PurgeRetention, err = durationEnv("PURGE_RETENTION", 30*24*time.Hour); err != nil {
+		return cfg, err
+	}
+	if cfg.PurgeInterval, err = durationEnv("PURGE_INTERVAL", time.Hour); err != nil {
+		return cfg, err
+	}
+	if cfg.IdempotencyKeyTTL, err = durationEnv("IDEMPOTENCY_KEY_TTL", 24*time.Hour); err != nil {
+		return cfg, err
+	}
+	if cfg.IdempotencyLease, err = durationEnv("IDEMPOTENCY_LEASE", time.Minute); err != nil {
+		return cfg, err
+	}
+	if cfg.PurgeInterval <= 0 {
+		return cfg, fmt.Errorf("PURGE_INTERVAL must be positive")
+	}
+	for _, name := range listEnv("ENRICHMENT_PROVIDERS", []string{"agify", "genderize", "nationalize"}) {
+		p, err := loadEnrichmentProvider(strings.ToLower(name))
+		if err != nil {
+			return cfg, err
+		}
+		cfg.EnrichmentProviders = append(cfg.EnrichmentProviders, p)
+	}
+	if cfg.EnrichmentCacheTTL, err = durationEnv("ENRICHMENT_CACHE_TTL", 7*24*time.Hour); err != nil {
+		return cfg, err
+	}
+	if cfg.EnrichmentCacheNegativeTTL, err = durationEnv("ENRICHMENT_CACHE_NEGATIVE_TTL", 24*time.Hour); err != nil {
+		return cfg, err
+	}
+	if cfg.EnrichmentCacheSize, err = intEnv("ENRICHMENT_CACHE_SIZE", 10000); err != nil {
+		return cfg, err
+	}
+	if cfg.EnrichmentRetries, err = intEnv("ENRICHMENT_RETRIES", 2); err != nil {
+		return cfg, err
+	}
+	if cfg.EnrichmentRetryBaseDelay, err = durationEnv("ENRICHMENT_RETRY_BASE_DELAY", 200*time.Millisecond); err != nil {
+		return cfg, err
+	}
+	if cfg.EnrichmentRetryMaxDelay, err = durationEnv("ENRICHMENT_RETRY_MAX_DELAY", 2*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.EnrichmentRetryBudget, err = durationEnv("ENRICHMENT_RETRY_BUDGET", 6*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.EnrichmentBreakerThreshold, err = intEnv("ENRICHMENT_BREAKER_THRESHOLD", 5); err != nil {
+		return cfg, err
+	}
+	if cfg.EnrichmentBreakerCooldown, err = durationEnv("ENRICHMENT_BREAKER_COOLDOWN", 30*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.EnrichmentRepairAttempts, err = intEnv("ENRICHMENT_REPAIR_ATTEMPTS", 5); err != nil {
+		return cfg, err
+	}
+	if cfg.EnrichmentRepairDelay, err = durationEnv("ENRICHMENT_REPAIR_DELAY", time.Minute); err != nil {
+		return cfg, err
+	}
+	if cfg.EnrichmentRepairMaxDelay, err = durationEnv("ENRICHMENT_REPAIR_MAX_DELAY", time.Hour); err != nil {
+		return cfg, err
+	}
+	if cfg.EnrichmentRepairInterval, err = durationEnv("ENRICHMENT_REPAIR_INTERVAL", 30*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.EnrichmentRepairDelay <= 0 || cfg.EnrichmentRepairInterval <= 0 {
+		return cfg, fmt.Errorf("ENRICHMENT_REPAIR_DELAY and ENRICHMENT_REPAIR_INTERVAL must be positive")
+	}
+	switch cfg.EnrichmentMode = os.Getenv("ENRICHMENT_MODE"); cfg.EnrichmentMode {
+	case "":
+		cfg.EnrichmentMode = EnrichmentSync
+	case EnrichmentSync, EnrichmentAsync:
+	default:
+		return cfg, fmt.Errorf("ENRICHMENT_MODE must be %s or %s", EnrichmentSync, EnrichmentAsync)
+	}
+	if cfg.EnrichmentWorkers, err = intEnv("ENRICHMENT_WORKERS", 4); err != nil {
+		return cfg, err
+	}
+	if cfg.EnrichmentPollInterval, err = durationEnv("ENRICHMENT_POLL_INTERVAL", time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.EnrichmentPollInterval <= 0 {
+		return cfg, fmt.Errorf("ENRICHMENT_POLL_INTERVAL must be positive")
+	}
+	if v := os.Getenv("MIGRATE_ON_START"); v != "" {
+		if cfg.MigrateOnStart, err = strconv.ParseBool(v); err != nil {
+			return cfg, fmt.Errorf("MIGRATE_ON_START must be true or false")
+		}
+	}
+	return cfg, nil
+}
+
+// LoadMigrateConfig читает настройки для подкоманды migrate: нужен только DB_DSN.
+func LoadMigrateConfig() (Config, error) {
+	_ = godotenv.Load()
+	cfg := Config{
+		StorageDriver: StoragePostgres,
+		DBDSN:         os.Getenv("DB_DSN"),
+		LogLevel:      os.Getenv("LOG_LEVEL"),
+	}
+	if cfg.DBDSN == "" {
+		return cfg, fmt.Errorf("DB_DSN is required")
+	}
 	return cfg, nil
 }
+
+func durationEnv(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative duration like 720h", key)
+	}
+	return d, nil
+}
+
+func intEnv(key string, def int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", key)
+	}
+	return n, nil
+}
+
+func loadEnrichmentProvider(name string) (EnrichmentProvider, error) {
+	prefix := strings.ToUpper(name) + "_"
+	p := EnrichmentProvider{
+		Name:    name,
+		BaseURL: os.Getenv(prefix + "URL"),
+		APIKey:  os.Getenv(prefix + "API_KEY"),
+		Enabled: true,
+	}
+	if p.BaseURL == "" {
+		p.BaseURL = defaultEnrichmentURLs[name]
+	}
+	if u, err := url.Parse(p.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return p, fmt.Errorf("%sURL must be an absolute http(s) URL", prefix)
+	}
+	var err error
+	if p.Timeout, err = durationEnv(prefix+"TIMEOUT", 5*time.Second); err != nil {
+		return p, err
+	}
+	if p.Timeout <= 0 {
+		return p, fmt.Errorf("%sTIMEOUT must be positive", prefix)
+	}
+	if v := os.Getenv(prefix + "ENABLED"); v != "" {
+		if p.Enabled, err = strconv.ParseBool(v); err != nil {
+			return p, fmt.Errorf("%sENABLED must be true or false", prefix)
+		}
+	}
+	if p.BatchSize, err = intEnv(prefix+"BATCH_SIZE", 10); err != nil {
+		return p, err
+	}
+	if p.BatchSize < 1 {
+		return p, fmt.Errorf("%sBATCH_SIZE must be at least 1", prefix)
+	}
+	return p, nil
+}
+
+// listEnv читает список через запятую; пустые элементы пропускаются.
+// Переменная, заданная пустой строкой, даёт пустой список.
+func listEnv(key string, def []string) []string {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -15,9 +15,61 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/enrichment/cache": {
+            "get": {
+                "description": "Hit and miss counters of the enrichment cache since the service started",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "enrichment"
+                ],
+                "summary": "Enrichment cache statistics",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.CacheStatsResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/enrichment/queue": {
+            "get": {
+                "description": "Number of asynchronous enrichment jobs by status; dead jobs ran out of attempts",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "enrichment"
+                ],
+                "summary": "Enrichment queue statistics",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.QueueStatsResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Database unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/persons": {
             "get": {
-                "description": "Returns paginated list of persons with optional filters",
+                "description": "Returns paginated list of persons with optional filters.\nPass next_cursor from a previous response as cursor to page by keyset instead of page number.",
                 "consumes": [
                     "application/json"
                 ],
@@ -43,6 +95,38 @@ const docTemplate = `{
                         "name": "page_size",
                         "in": "query"
                     },
+                    {
+                        "type": "string",
+                        "description": "Opaque cursor from next_cursor; cannot be combined with page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated fields, '-' for descending, ':nulls_first'/':nulls_last' suffix (e.g. -age:nulls_last,surname); score is allowed with q",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "default": true,
+                        "description": "Count total matching rows",
+                        "name": "include_total",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "default": false,
+                        "description": "Admin: include soft-deleted persons",
+                        "name": "include_deleted",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Fuzzy search by name, surname and patronymic; results are ranked by score unless sort is set",
+                        "name": "q",
+                        "in": "query"
+                    },
                     {
                         "type": "string",
                         "description": "Filter by name",
@@ -69,13 +153,13 @@ const docTemplate = `{
                     },
                     {
                         "type": "string",
-                        "description": "Filter by gender",
+                        "description": "Filter by gender (male, female); comma-separated for several",
                         "name": "gender",
                         "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "Filter by nationality",
+                        "description": "Filter by 2-letter country code; comma-separated for several (RU,KZ)",
                         "name": "nationality",
                         "in": "query"
                     }
@@ -102,7 +186,7 @@ const docTemplate = `{
                 }
             },
             "post": {
-                "description": "Creates a new person and enriches their data (age, gender, nationality)",
+                "description": "Creates a new person and enriches their data (age, gender, nationality).\nA person is saved even if some providers fail: such attributes are listed in missing_fields and retried later.\nIn asynchronous mode (ENRICHMENT_MODE=async) the person is saved without enrichment and 202 is returned:\nattributes stay pending until a background worker enriches them; poll the Location header.",
                 "consumes": [
                     "application/json"
                 ],
@@ -122,6 +206,12 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/internal_handler.CreatePersonRequest"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Repeating the request with the same key returns the stored response",
+                        "name": "Idempotency-Key",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -129,6 +219,32 @@ const docTemplate = `{
                         "description": "Created",
                         "schema": {
                             "$ref": "#/definitions/internal_handler.PersonResponse"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the created person"
+                            },
+                            "Idempotent-Replayed": {
+                                "type": "string",
+                                "description": "true if the response was replayed for a repeated Idempotency-Key"
+                            }
+                        }
+                    },
+                    "202": {
+                        "description": "Person saved, enrichment is queued",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.PersonResponse"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the created person"
+                            },
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the person"
+                            }
                         }
                     },
                     "400": {
@@ -137,18 +253,42 @@ const docTemplate = `{
                             "$ref": "#/definitions/internal_handler.ErrorResponse"
                         }
                     },
+                    "409": {
+                        "description": "Request with this Idempotency-Key is still in progress",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Idempotency-Key was used with a different request",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/internal_handler.ErrorResponse"
                         }
+                    },
+                    "503": {
+                        "description": "Database unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Database timed out or the request deadline passed during enrichment",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
                     }
                 }
             }
         },
-        "/persons/{id}": {
-            "get": {
-                "description": "Returns a single person by their ID",
+        "/persons/batch": {
+            "post": {
+                "description": "Validates, enriches and stores up to 1000 persons. Items fail independently:\neach result has the status and error POST /persons would have returned for that item.",
                 "consumes": [
                     "application/json"
                 ],
@@ -158,21 +298,26 @@ const docTemplate = `{
                 "tags": [
                     "persons"
                 ],
-                "summary": "Get person by ID",
+                "summary": "Create persons in batch",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Person ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Persons to create",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/internal_handler.CreatePersonRequest"
+                            }
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/internal_handler.PersonResponse"
+                            "$ref": "#/definitions/internal_handler.BatchCreateResponse"
                         }
                     },
                     "400": {
@@ -180,9 +325,98 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/internal_handler.ErrorResponse"
                         }
+                    }
+                }
+            }
+        },
+        "/persons/export": {
+            "get": {
+                "description": "Streams all persons matching the filters as CSV or newline-delimited JSON.\nAccepts the same filters and sort as GET /persons; pagination parameters are ignored.",
+                "produces": [
+                    "text/csv",
+                    "application/x-ndjson"
+                ],
+                "tags": [
+                    "persons"
+                ],
+                "summary": "Export persons",
+                "parameters": [
+                    {
+                        "enum": [
+                            "csv",
+                            "ndjson"
+                        ],
+                        "type": "string",
+                        "default": "ndjson",
+                        "description": "Output format",
+                        "name": "format",
+                        "in": "query"
                     },
-                    "404": {
-                        "description": "Not Found",
+                    {
+                        "type": "string",
+                        "description": "Same as in GET /persons",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "default": false,
+                        "description": "Admin: include soft-deleted persons",
+                        "name": "include_deleted",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Fuzzy search by name, surname and patronymic; rows are ranked by score unless sort is set",
+                        "name": "q",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by name",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by surname",
+                        "name": "surname",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Filter by minimum age",
+                        "name": "min_age",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Filter by maximum age",
+                        "name": "max_age",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by gender (male, female); comma-separated for several",
+                        "name": "gender",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by 2-letter country code; comma-separated for several (RU,KZ)",
+                        "name": "nationality",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Rows in the requested format",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
                             "$ref": "#/definitions/internal_handler.ErrorResponse"
                         }
@@ -194,11 +428,15 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "put": {
-                "description": "Updates one or more fields of an existing person",
+            }
+        },
+        "/persons/import": {
+            "post": {
+                "description": "Imports persons from CSV (header with name, surname and optional patronymic) or NDJSON\n(one CreatePersonRequest per line), sent as the body or as the file field of a multipart form.\nEvery row is validated like POST /persons and checked for likely duplicates. Files of up to 100 rows\nare processed in the request (200 with the report); larger ones start a background job (202),\nwhose status is available at the Location header.",
                 "consumes": [
-                    "application/json"
+                    "text/csv",
+                    "application/x-ndjson",
+                    "multipart/form-data"
                 ],
                 "produces": [
                     "application/json"
@@ -206,30 +444,57 @@ const docTemplate = `{
                 "tags": [
                     "persons"
                 ],
-                "summary": "Update person",
+                "summary": "Import persons",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Person ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "enum": [
+                            "csv",
+                            "ndjson"
+                        ],
+                        "type": "string",
+                        "description": "File format; detected from Content-Type or file name if omitted",
+                        "name": "format",
+                        "in": "query"
                     },
                     {
-                        "description": "Fields to update",
-                        "name": "payload",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/internal_handler.UpdatePersonRequest"
-                        }
+                        "type": "boolean",
+                        "default": false,
+                        "description": "Only validate and report, write nothing",
+                        "name": "dry_run",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "default": true,
+                        "description": "Enrich age, gender and nationality",
+                        "name": "enrich",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "default": false,
+                        "description": "Create rows that look like existing persons",
+                        "name": "allow_duplicates",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/internal_handler.PersonResponse"
+                            "$ref": "#/definitions/internal_handler.ImportReportResponse"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ImportJobResponse"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the import job"
+                            }
                         }
                     },
                     "400": {
@@ -238,8 +503,8 @@ const docTemplate = `{
                             "$ref": "#/definitions/internal_handler.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "413": {
+                        "description": "Request Entity Too Large",
                         "schema": {
                             "$ref": "#/definitions/internal_handler.ErrorResponse"
                         }
@@ -251,9 +516,46 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "Deletes a person by their ID",
+            }
+        },
+        "/persons/import/{jobID}": {
+            "get": {
+                "description": "Returns the progress of a background import and its report once finished",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "persons"
+                ],
+                "summary": "Get import job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Import job ID",
+                        "name": "jobID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ImportJobResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/persons/{id}": {
+            "get": {
+                "description": "Returns a single person by their ID",
                 "consumes": [
                     "application/json"
                 ],
@@ -263,7 +565,7 @@ const docTemplate = `{
                 "tags": [
                     "persons"
                 ],
-                "summary": "Delete person",
+                "summary": "Get person by ID",
                 "parameters": [
                     {
                         "type": "integer",
@@ -274,10 +576,16 @@ const docTemplate = `{
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/internal_handler.PersonResponse"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Current version of the person"
+                            }
                         }
                     },
                     "400": {
@@ -299,19 +607,483 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        }
-    },
-    "definitions": {
-        "internal_handler.CreatePersonRequest": {
-            "type": "object",
-            "required": [
-                "name",
-                "surname"
-            ],
-            "properties": {
-                "name": {
-                    "type": "string"
+            },
+            "put": {
+                "description": "Replaces all fields of an existing person; optional fields that are omitted or null are cleared",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "persons"
+                ],
+                "summary": "Replace person",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Person ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag from a previous response; the update fails with 412 if the person has changed since",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "New state of the person",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.UpdatePersonRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.PersonResponse"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "New version of the person"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Soft-deletes a person by their ID; it can be restored until the purge retention expires",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "persons"
+                ],
+                "summary": "Delete person",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Person ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag from a previous response; the delete fails with 412 if the person has changed since",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Applies a JSON Merge Patch (RFC 7396): omitted fields are kept, null clears a field. name and surname cannot be cleared",
+                "consumes": [
+                    "application/merge-patch+json",
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "persons"
+                ],
+                "summary": "Patch person",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Person ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag from a previous response; the update fails with 412 if the person has changed since",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Fields to change",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.PatchPersonRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.PersonResponse"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "New version of the person"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/persons/{id}/history": {
+            "get": {
+                "description": "Returns every create, update, delete and restore of a person with field-level changes, oldest first",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "persons"
+                ],
+                "summary": "Get person history",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Person ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.PersonHistoryResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/persons/{id}/restore": {
+            "post": {
+                "description": "Restores a soft-deleted person",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "persons"
+                ],
+                "summary": "Restore person",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Person ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.PersonResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "internal_handler.AttributeSourceResponse": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "candidates": {
+                    "description": "Candidates — все варианты по убыванию вероятности (для nationality).",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/internal_handler.CandidateResponse"
+                    }
+                },
+                "count": {
+                    "description": "Count — по скольким записям провайдер сделал вывод.",
+                    "type": "integer",
+                    "example": 1094417
+                },
+                "error": {
+                    "description": "Error — последняя ошибка провайдеров для pending и failed.",
+                    "type": "string",
+                    "example": "agify: status 503"
+                },
+                "probability": {
+                    "description": "Probability — уверенность провайдера от 0 до 1.",
+                    "type": "number",
+                    "example": 0.98
+                },
+                "provider": {
+                    "description": "Provider пуст, если провайдеры не знают имя.",
+                    "type": "string",
+                    "example": "genderize"
+                },
+                "retry_at": {
+                    "description": "RetryAt — когда атрибут будет запрошен снова (для pending).",
+                    "type": "string",
+                    "example": "2024-01-01T12:01:00Z"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "complete",
+                        "pending",
+                        "failed"
+                    ],
+                    "example": "complete"
+                }
+            }
+        },
+        "internal_handler.BatchCreateResponse": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "type": "integer"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/internal_handler.BatchItemResult"
+                    }
+                }
+            }
+        },
+        "internal_handler.BatchItemResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "$ref": "#/definitions/internal_handler.ErrorResponse"
+                },
+                "index": {
+                    "type": "integer"
+                },
+                "person": {
+                    "$ref": "#/definitions/internal_handler.PersonResponse"
+                },
+                "status": {
+                    "type": "integer",
+                    "example": 201
+                }
+            }
+        },
+        "internal_handler.CacheStatsResponse": {
+            "type": "object",
+            "properties": {
+                "capacity": {
+                    "type": "integer"
+                },
+                "enabled": {
+                    "description": "Enabled == false — кеш выключен (ENRICHMENT_CACHE_TTL=0), счётчики нулевые.",
+                    "type": "boolean"
+                },
+                "entries": {
+                    "type": "integer"
+                },
+                "hit_ratio": {
+                    "description": "HitRatio — доля запросов, обслуженных кешем.",
+                    "type": "number",
+                    "example": 0.93
+                },
+                "memory_hits": {
+                    "description": "MemoryHits и StoreHits — ответы из памяти процесса и из базы.",
+                    "type": "integer"
+                },
+                "misses": {
+                    "type": "integer"
+                },
+                "negative_hits": {
+                    "description": "NegativeHits — попадания, где провайдер не знает имя (входят в hits).",
+                    "type": "integer"
+                },
+                "store_errors": {
+                    "type": "integer"
+                },
+                "store_hits": {
+                    "type": "integer"
+                }
+            }
+        },
+        "internal_handler.CandidateResponse": {
+            "type": "object",
+            "properties": {
+                "probability": {
+                    "type": "number",
+                    "example": 0.42
+                },
+                "value": {
+                    "type": "string",
+                    "example": "RU"
+                }
+            }
+        },
+        "internal_handler.CreatePersonRequest": {
+            "type": "object",
+            "required": [
+                "name",
+                "surname"
+            ],
+            "properties": {
+                "name": {
+                    "type": "string"
                 },
                 "patronymic": {
                     "type": "string"
@@ -324,14 +1096,187 @@ const docTemplate = `{
         "internal_handler.ErrorResponse": {
             "type": "object",
             "properties": {
+                "code": {
+                    "description": "Code — стабильный машиночитаемый код ошибки.",
+                    "type": "string",
+                    "example": "validation_failed"
+                },
+                "detail": {
+                    "type": "string",
+                    "example": "request has invalid fields"
+                },
+                "errors": {
+                    "description": "Errors — сообщения по полям тела запроса, если они не прошли проверку.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "instance": {
+                    "type": "string",
+                    "example": "/persons"
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer",
+                    "example": 400
+                },
+                "title": {
+                    "type": "string",
+                    "example": "Bad Request"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "about:blank"
+                }
+            }
+        },
+        "internal_handler.FieldChangeResponse": {
+            "type": "object",
+            "properties": {
+                "new": {},
+                "old": {}
+            }
+        },
+        "internal_handler.HistoryEntryResponse": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string",
+                    "enum": [
+                        "create",
+                        "update",
+                        "delete",
+                        "restore"
+                    ]
+                },
+                "changed_at": {
+                    "type": "string"
+                },
+                "changes": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/internal_handler.FieldChangeResponse"
+                    }
+                },
+                "id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "internal_handler.ImportJobResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
                 "error": {
+                    "$ref": "#/definitions/internal_handler.ErrorResponse"
+                },
+                "finished_at": {
                     "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "processed": {
+                    "type": "integer"
+                },
+                "report": {
+                    "$ref": "#/definitions/internal_handler.ImportReportResponse"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "pending",
+                        "running",
+                        "done",
+                        "failed"
+                    ]
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "internal_handler.ImportReportResponse": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "type": "integer"
+                },
+                "dry_run": {
+                    "type": "boolean"
+                },
+                "duplicates": {
+                    "type": "integer"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "invalid": {
+                    "type": "integer"
+                },
+                "rows": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/internal_handler.ImportRowResult"
+                    }
+                },
+                "total": {
+                    "type": "integer"
+                },
+                "valid": {
+                    "type": "integer"
+                }
+            }
+        },
+        "internal_handler.ImportRowResult": {
+            "type": "object",
+            "properties": {
+                "duplicate_of_id": {
+                    "type": "integer"
+                },
+                "duplicate_of_line": {
+                    "type": "integer"
+                },
+                "error": {
+                    "description": "Error — почему не удалось создать запись (status failed).",
+                    "$ref": "#/definitions/internal_handler.ErrorResponse"
+                },
+                "errors": {
+                    "description": "Errors — почему строка не прошла проверку (status invalid).",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "line": {
+                    "type": "integer"
+                },
+                "person_id": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "valid",
+                        "invalid",
+                        "duplicate",
+                        "created",
+                        "failed"
+                    ]
                 }
             }
         },
         "internal_handler.PagedPersonsResponse": {
             "type": "object",
             "properties": {
+                "next_cursor": {
+                    "type": "string"
+                },
                 "page": {
                     "type": "integer"
                 },
@@ -349,6 +1294,43 @@ const docTemplate = `{
                 }
             }
         },
+        "internal_handler.PatchPersonRequest": {
+            "type": "object",
+            "properties": {
+                "age": {
+                    "type": "integer"
+                },
+                "gender": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "nationality": {
+                    "type": "string"
+                },
+                "patronymic": {
+                    "type": "string"
+                },
+                "surname": {
+                    "type": "string"
+                }
+            }
+        },
+        "internal_handler.PersonHistoryResponse": {
+            "type": "object",
+            "properties": {
+                "entries": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/internal_handler.HistoryEntryResponse"
+                    }
+                },
+                "person_id": {
+                    "type": "integer"
+                }
+            }
+        },
         "internal_handler.PersonResponse": {
             "type": "object",
             "properties": {
@@ -358,12 +1340,32 @@ const docTemplate = `{
                 "created_at": {
                     "type": "string"
                 },
+                "deleted_at": {
+                    "type": "string"
+                },
+                "enrichment": {
+                    "description": "Enrichment — статус обогащения age, gender и nationality и откуда они\nполучены; атрибуты, заданные вручную, отсутствуют.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/internal_handler.AttributeSourceResponse"
+                    }
+                },
                 "gender": {
                     "type": "string"
                 },
                 "id": {
                     "type": "integer"
                 },
+                "missing_fields": {
+                    "description": "MissingFields — атрибуты, которые обогащение ещё не получило (pending)\nили не смогло получить (failed).",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "age"
+                    ]
+                },
                 "name": {
                     "type": "string"
                 },
@@ -373,13 +1375,43 @@ const docTemplate = `{
                 "patronymic": {
                     "type": "string"
                 },
+                "score": {
+                    "type": "number"
+                },
                 "surname": {
                     "type": "string"
+                },
+                "version": {
+                    "type": "integer"
+                }
+            }
+        },
+        "internal_handler.QueueStatsResponse": {
+            "type": "object",
+            "properties": {
+                "dead": {
+                    "description": "Dead — задания, для которых исчерпаны попытки; их атрибуты получили статус failed.",
+                    "type": "integer"
+                },
+                "oldest_queued": {
+                    "description": "OldestQueued — когда создано самое старое ожидающее задание (RFC 3339).",
+                    "type": "string",
+                    "example": "2024-05-01T12:00:00Z"
+                },
+                "queued": {
+                    "type": "integer"
+                },
+                "running": {
+                    "type": "integer"
                 }
             }
         },
         "internal_handler.UpdatePersonRequest": {
             "type": "object",
+            "required": [
+                "name",
+                "surname"
+            ],
             "properties": {
                 "age": {
                     "type": "integer"
@@ -1,7 +1,24 @@
 package handler
 
+import (
+	"sort"
+	"time"
+
+	"person-api/internal/model"
+)
+
+// ErrorResponse — тело ошибки в формате RFC 7807 (application/problem+json).
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Type     string `json:"type" example:"about:blank"`
+	Title    string `json:"title" example:"Bad Request"`
+	Status   int    `json:"status" example:"400"`
+	Detail   string `json:"detail,omitempty" example:"request has invalid fields"`
+	Instance string `json:"instance,omitempty" example:"/persons"`
+	// Code — стабильный машиночитаемый код ошибки.
+	Code      string `json:"code" example:"validation_failed"`
+	RequestID string `json:"request_id,omitempty"`
+	// Errors — сообщения по полям тела запроса, если они не прошли проверку.
+	Errors map[string]string `json:"errors,omitempty"`
 }
 type CreatePersonRequest struct {
 	Name       string  `json:"name" validate:"required"`
@@ -9,29 +26,238 @@ type CreatePersonRequest struct {
 	Patronymic *string `json:"patronymic"`
 }
 
+// BatchCreateResponse — итог POST /persons/batch. Results идут в порядке запроса.
+type BatchCreateResponse struct {
+	Created int               `json:"created"`
+	Failed  int               `json:"failed"`
+	Results []BatchItemResult `json:"results"`
+}
+
+// BatchItemResult — результат одного элемента пакета: Person при успехе
+// (status 201 или 202, если обогащение в очереди), иначе Error со статусом,
+// который вернул бы POST /persons.
+type BatchItemResult struct {
+	Index  int             `json:"index"`
+	Status int             `json:"status" example:"201"`
+	Person *PersonResponse `json:"person,omitempty"`
+	Error  *ErrorResponse  `json:"error,omitempty"`
+}
+
+// ImportRowResult — результат одной строки файла импорта.
+type ImportRowResult struct {
+	Line   int    `json:"line"`
+	Status string `json:"status" enums:"valid,invalid,duplicate,created,failed"`
+	// Errors — почему строка не прошла проверку (status invalid).
+	Errors map[string]string `json:"errors,omitempty"`
+	// Error — почему не удалось создать запись (status failed).
+	Error           *ErrorResponse `json:"error,omitempty"`
+	PersonID        int64          `json:"person_id,omitempty"`
+	DuplicateOfID   int64          `json:"duplicate_of_id,omitempty"`
+	DuplicateOfLine int            `json:"duplicate_of_line,omitempty"`
+}
+
+type ImportReportResponse struct {
+	DryRun     bool              `json:"dry_run"`
+	Total      int               `json:"total"`
+	Valid      int               `json:"valid"`
+	Invalid    int               `json:"invalid"`
+	Duplicates int               `json:"duplicates"`
+	Created    int               `json:"created"`
+	Failed     int               `json:"failed"`
+	Rows       []ImportRowResult `json:"rows"`
+}
+
+// ImportJobResponse — состояние фонового импорта; Report появляется по завершении.
+type ImportJobResponse struct {
+	ID         string                `json:"id"`
+	Status     string                `json:"status" enums:"pending,running,done,failed"`
+	Total      int                   `json:"total"`
+	Processed  int                   `json:"processed"`
+	CreatedAt  string                `json:"created_at"`
+	FinishedAt *string               `json:"finished_at,omitempty"`
+	Report     *ImportReportResponse `json:"report,omitempty"`
+	Error      *ErrorResponse        `json:"error,omitempty"`
+}
+
+// UpdatePersonRequest — полная замена записи (PUT): пропущенное
+// необязательное поле очищается.
 type UpdatePersonRequest struct {
-	Name        *string `json:"name"`
-	Surname     *string `json:"surname"`
+	Name        string  `json:"name" validate:"required"`
+	Surname     string  `json:"surname" validate:"required"`
 	Patronymic  *string `json:"patronymic"`
 	Age         *int    `json:"age"`
 	Gender      *string `json:"gender"`
 	Nationality *string `json:"nationality"`
 }
 
+// PatchPersonRequest — JSON Merge Patch (RFC 7396): пропущенное поле
+// не меняется, null очищает его.
+type PatchPersonRequest struct {
+	Name        model.Optional[string] `json:"name" swaggertype:"string"`
+	Surname     model.Optional[string] `json:"surname" swaggertype:"string"`
+	Patronymic  model.Optional[string] `json:"patronymic" swaggertype:"string"`
+	Age         model.Optional[int]    `json:"age" swaggertype:"integer"`
+	Gender      model.Optional[string] `json:"gender" swaggertype:"string"`
+	Nationality model.Optional[string] `json:"nationality" swaggertype:"string"`
+}
+
 type PersonResponse struct {
-	ID          int64   `json:"id"`
-	Name        string  `json:"name"`
-	Surname     string  `json:"surname"`
-	Patronymic  *string `json:"patronymic"`
-	Age         *int    `json:"age"`
-	Gender      *string `json:"gender"`
-	Nationality *string `json:"nationality"`
-	CreatedAt   string  `json:"created_at"`
+	ID          int64    `json:"id"`
+	Name        string   `json:"name"`
+	Surname     string   `json:"surname"`
+	Patronymic  *string  `json:"patronymic"`
+	Age         *int     `json:"age"`
+	Gender      *string  `json:"gender"`
+	Nationality *string  `json:"nationality"`
+	CreatedAt   string   `json:"created_at"`
+	DeletedAt   *string  `json:"deleted_at,omitempty"`
+	Version     int64    `json:"version"`
+	Score       *float64 `json:"score,omitempty"`
+	// Enrichment — статус обогащения age, gender и nationality и откуда они
+	// получены; атрибуты, заданные вручную, отсутствуют.
+	Enrichment map[string]AttributeSourceResponse `json:"enrichment,omitempty"`
+	// MissingFields — атрибуты, которые обогащение ещё не получило (pending)
+	// или не смогло получить (failed).
+	MissingFields []string `json:"missing_fields,omitempty" example:"age"`
+}
+
+// AttributeSourceResponse — откуда получен атрибут и насколько он надёжен.
+type AttributeSourceResponse struct {
+	Status string `json:"status" enums:"complete,pending,failed" example:"complete"`
+	// Provider пуст, если провайдеры не знают имя.
+	Provider string `json:"provider,omitempty" example:"genderize"`
+	// Probability — уверенность провайдера от 0 до 1.
+	Probability *float64 `json:"probability,omitempty" example:"0.98"`
+	// Count — по скольким записям провайдер сделал вывод.
+	Count *int `json:"count,omitempty" example:"1094417"`
+	// Candidates — все варианты по убыванию вероятности (для nationality).
+	Candidates []CandidateResponse `json:"candidates,omitempty"`
+	// Error — последняя ошибка провайдеров для pending и failed.
+	Error    string `json:"error,omitempty" example:"agify: status 503"`
+	Attempts int    `json:"attempts,omitempty" example:"1"`
+	// RetryAt — когда атрибут будет запрошен снова (для pending).
+	RetryAt *string `json:"retry_at,omitempty" example:"2024-01-01T12:01:00Z"`
+}
+
+type CandidateResponse struct {
+	Value       string  `json:"value" example:"RU"`
+	Probability float64 `json:"probability" example:"0.42"`
+}
+
+func newPersonResponse(p model.Person) PersonResponse {
+	out := PersonResponse{
+		ID:          p.ID,
+		Name:        p.Name,
+		Surname:     p.Surname,
+		Patronymic:  p.Patronymic,
+		Age:         p.Age,
+		Gender:      p.Gender,
+		Nationality: p.Nationality,
+		CreatedAt:   p.CreatedAt,
+		DeletedAt:   p.DeletedAt,
+		Version:     p.Version,
+		Score:       p.Score,
+	}
+	if len(p.Enrichment) > 0 {
+		out.Enrichment = make(map[string]AttributeSourceResponse, len(p.Enrichment))
+		for attr, src := range p.Enrichment {
+			r := AttributeSourceResponse{
+				Status:      src.Status,
+				Provider:    src.Provider,
+				Probability: src.Probability,
+				Count:       src.Count,
+				Error:       src.Error,
+				Attempts:    src.Attempts,
+			}
+			for _, c := range src.Candidates {
+				r.Candidates = append(r.Candidates, CandidateResponse{Value: c.Value, Probability: c.Probability})
+			}
+			if src.RetryAt != nil {
+				v := src.RetryAt.UTC().Format(time.RFC3339)
+				r.RetryAt = &v
+			}
+			out.Enrichment[attr] = r
+			if src.Status != model.EnrichmentComplete {
+				out.MissingFields = append(out.MissingFields, attr)
+			}
+		}
+		sort.Strings(out.MissingFields)
+	}
+	return out
 }
 
 type PagedPersonsResponse struct {
-	Persons  []PersonResponse `json:"persons"`
-	Total    int              `json:"total"`
-	Page     int              `json:"page"`
-	PageSize int              `json:"page_size"`
+	Persons    []PersonResponse `json:"persons"`
+	Total      *int             `json:"total,omitempty"`
+	Page       int              `json:"page,omitempty"`
+	PageSize   int              `json:"page_size"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+type FieldChangeResponse struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+type HistoryEntryResponse struct {
+	ID        int64                          `json:"id"`
+	Action    string                         `json:"action" enums:"create,update,delete,restore"`
+	Changes   map[string]FieldChangeResponse `json:"changes"`
+	ChangedAt string                         `json:"changed_at"`
+}
+
+type PersonHistoryResponse struct {
+	PersonID int64                  `json:"person_id"`
+	Entries  []HistoryEntryResponse `json:"entries"`
+}
+
+type CacheStatsResponse struct {
+	// Enabled == false — кеш выключен (ENRICHMENT_CACHE_TTL=0), счётчики нулевые.
+	Enabled  bool `json:"enabled"`
+	Entries  int  `json:"entries"`
+	Capacity int  `json:"capacity"`
+	// MemoryHits и StoreHits — ответы из памяти процесса и из базы.
+	MemoryHits int64 `json:"memory_hits"`
+	StoreHits  int64 `json:"store_hits"`
+	// NegativeHits — попадания, где провайдер не знает имя (входят в hits).
+	NegativeHits int64 `json:"negative_hits"`
+	Misses       int64 `json:"misses"`
+	StoreErrors  int64 `json:"store_errors"`
+	// HitRatio — доля запросов, обслуженных кешем.
+	HitRatio float64 `json:"hit_ratio" example:"0.93"`
+}
+
+func newCacheStatsResponse(s model.CacheStats) CacheStatsResponse {
+	out := CacheStatsResponse{
+		Enabled:      s.Enabled,
+		Entries:      s.Entries,
+		Capacity:     s.Capacity,
+		MemoryHits:   s.MemoryHits,
+		StoreHits:    s.StoreHits,
+		NegativeHits: s.NegativeHits,
+		Misses:       s.Misses,
+		StoreErrors:  s.StoreErrors,
+	}
+	if total := s.MemoryHits + s.StoreHits + s.Misses; total > 0 {
+		out.HitRatio = float64(s.MemoryHits+s.StoreHits) / float64(total)
+	}
+	return out
+}
+
+type QueueStatsResponse struct {
+	Queued  int64 `json:"queued"`
+	Running int64 `json:"running"`
+	// Dead — задания, для которых исчерпаны попытки; их атрибуты получили статус failed.
+	Dead int64 `json:"dead"`
+	// OldestQueued — когда создано самое старое ожидающее задание (RFC 3339).
+	OldestQueued *string `json:"oldest_queued,omitempty" example:"2024-05-01T12:00:00Z"`
+}
+
+func newQueueStatsResponse(s model.QueueStats) QueueStatsResponse {
+	out := QueueStatsResponse{Queued: s.Queued, Running: s.Running, Dead: s.Dead}
+	if s.OldestQueued != nil {
+		v := s.OldestQueued.UTC().Format(time.RFC3339)
+		out.OldestQueued = &v
+	}
+	return out
 }
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+
+	"person-api/internal/services/person"
+)
+
+// Машиночитаемые коды ошибок (поле code). Коды — часть API: не переименовывайте их.
+const (
+	codeBadRequest           = "bad_request"          // неверный id, параметр запроса или заголовок
+	codeInvalidPayload       = "invalid_payload"      // тело запроса — не JSON нужной формы
+	codeValidationFailed     = "validation_failed"    // поля не прошли проверку, подробности в errors
+	codeInvalidQuery         = "invalid_query"        // выборку нельзя выполнить (курсор, сортировка)
+	codeNotFound             = "not_found"            // записи нет
+	codeVersionMismatch      = "version_mismatch"     // не совпала версия из If-Match
+	codeConflict             = "conflict"             // конфликт с сохранёнными данными
+	codeUnavailable          = "upstream_unavailable" // недоступна база или API обогащения
+	codeTimeout              = "upstream_timeout"     // база или API обогащения не ответили вовремя
+	codeMethodNotAllowed     = "method_not_allowed"
+	codeUnsupportedMedia     = "unsupported_media_type" // тело в неподдерживаемом формате
+	codeIdempotencyKeyReused = "idempotency_key_reused" // Idempotency-Key уже использован с другим запросом
+	codeInternal             = "internal_error"
+)
+
+const (
+	problemContentType    = "application/problem+json"
+	mergePatchContentType = "application/merge-patch+json"
+)
+
+// serviceErrors — единственное место, где ошибки сервиса сопоставляются статусам HTTP.
+// Пустое message означает, что текст ошибки можно показать клиенту как есть;
+// иначе показывается message, чтобы не раскрывать детали базы и внешних API.
+var serviceErrors = []struct {
+	err     error
+	status  int
+	code    string
+	message string
+}{
+	{person.ErrNotFound, http.StatusNotFound, codeNotFound, ""},
+	{person.ErrJobNotFound, http.StatusNotFound, codeNotFound, ""},
+	{person.ErrInvalidQuery, http.StatusBadRequest, codeInvalidQuery, ""},
+	{person.ErrValidation, http.StatusBadRequest, codeValidationFailed, "invalid person data"},
+	{person.ErrVersionMismatch, http.StatusPreconditionFailed, codeVersionMismatch, "person has been modified"},
+	{person.ErrConflict, http.StatusConflict, codeConflict, "person conflicts with existing data"},
+	{person.ErrUnavailable, http.StatusServiceUnavailable, codeUnavailable, "service temporarily unavailable"},
+	{person.ErrTimeout, http.StatusGatewayTimeout, codeTimeout, "upstream timed out"},
+}
+
+// respondError отвечает ошибкой в формате RFC 7807.
+func respondError(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	respondProblem(w, r, ErrorResponse{Status: status, Code: code, Detail: detail})
+}
+
+// respondServiceError отвечает статусом, соответствующим ошибке сервиса.
+// fallback — сообщение для непредвиденных ошибок (500).
+func respondServiceError(w http.ResponseWriter, r *http.Request, err error, fallback string) {
+	respondProblem(w, r, serviceProblem(err, fallback))
+}
+
+func serviceProblem(err error, fallback string) ErrorResponse {
+	for _, e := range serviceErrors {
+		if errors.Is(err, e.err) {
+			msg := e.message
+			if msg == "" {
+				msg = err.Error()
+			}
+			return problem(e.status, e.code, msg)
+		}
+	}
+	return problem(http.StatusInternalServerError, codeInternal, fallback)
+}
+
+// respondValidationError раскладывает ошибки ozzo-validation по полям тела запроса.
+func respondValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	respondProblem(w, r, validationProblem(err))
+}
+
+func validationProblem(err error) ErrorResponse {
+	var fieldErrs validation.Errors
+	if !errors.As(err, &fieldErrs) {
+		return problem(http.StatusBadRequest, codeValidationFailed, err.Error())
+	}
+	fields := make(map[string]string, len(fieldErrs))
+	for field, e := range fieldErrs {
+		fields[field] = e.Error()
+	}
+	p := problem(http.StatusBadRequest, codeValidationFailed, "request has invalid fields")
+	p.Errors = fields
+	return p
+}
+
+// problem заполняет тело ошибки без привязки к запросу; так же описываются
+// ошибки отдельных элементов пакета.
+func problem(status int, code, detail string) ErrorResponse {
+	return ErrorResponse{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+func respondProblem(w http.ResponseWriter, r *http.Request, p ErrorResponse) {
+	p.Type = "about:blank"
+	p.Title = http.StatusText(p.Status)
+	p.Instance = r.URL.Path
+	p.RequestID = middleware.GetReqID(r.Context())
+	w.Header().Set("Content-Type", problemContentType)
+	writeJSON(w, p.Status, p)
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	respondError(w, r, http.StatusNotFound, codeNotFound, "no such endpoint")
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	respondError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, r.Method+" is not allowed here")
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Форматы GET /persons/export.
+const (
+	exportCSV    = "csv"
+	exportNDJSON = "ndjson"
+)
+
+const (
+	// exportFlushRows — через сколько строк отправлять накопленное клиенту.
+	exportFlushRows = 100
+	// exportWriteIdle — сколько ждать клиента при каждой отправке; общий
+	// WriteTimeout сервера ограничил бы весь ответ.
+	exportWriteIdle = 30 * time.Second
+)
+
+var exportColumns = []string{
+	"id", "name", "surname", "patronymic", "age", "gender", "nationality", "created_at", "deleted_at", "version",
+}
+
+// exportWriter пишет записи в ответ построчно. Заголовки ответа уходят вместе
+// с первой строкой, поэтому до неё ещё можно ответить ошибкой.
+type exportWriter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	format  string
+	csv     *csv.Writer
+	json    *json.Encoder
+	started bool
+	rows    int
+}
+
+func newExportWriter(w http.ResponseWriter, format string) *exportWriter {
+	return &exportWriter{w: w, rc: http.NewResponseController(w), format: format}
+}
+
+func (e *exportWriter) start() error {
+	e.started = true
+	h := e.w.Header()
+	switch e.format {
+	case exportCSV:
+		h.Set("Content-Type", "text/csv; charset=utf-8")
+		e.csv = csv.NewWriter(e.w)
+	default:
+		h.Set("Content-Type", "application/x-ndjson")
+		e.json = json.NewEncoder(e.w)
+	}
+	h.Set("Content-Disposition", `attachment; filename="persons.`+e.format+`"`)
+	_ = e.rc.SetWriteDeadline(time.Now().Add(exportWriteIdle))
+	e.w.WriteHeader(http.StatusOK)
+	if e.csv != nil {
+		return e.csv.Write(exportColumns)
+	}
+	return nil
+}
+
+func (e *exportWriter) write(p PersonResponse) error {
+	if !e.started {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+	var err error
+	if e.csv != nil {
+		err = e.csv.Write(csvRecord(p))
+	} else {
+		err = e.json.Encode(p)
+	}
+	if err != nil {
+		return err
+	}
+	e.rows++
+	if e.rows%exportFlushRows == 0 {
+		return e.flush()
+	}
+	return nil
+}
+
+// finish отправляет остаток; для пустой выборки CSV состоит из одного заголовка.
+func (e *exportWriter) finish() error {
+	if !e.started {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+	return e.flush()
+}
+
+func (e *exportWriter) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	_ = e.rc.SetWriteDeadline(time.Now().Add(exportWriteIdle))
+	if err := e.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+func csvRecord(p PersonResponse) []string {
+	str := func(v *string) string {
+		if v == nil {
+			return ""
+		}
+		return *v
+	}
+	age := ""
+	if p.Age != nil {
+		age = strconv.Itoa(*p.Age)
+	}
+	return []string{
+		strconv.FormatInt(p.ID, 10), p.Name, p.Surname, str(p.Patronymic), age,
+		str(p.Gender), str(p.Nationality), p.CreatedAt, str(p.DeletedAt), strconv.FormatInt(p.Version, 10),
+	}
+}
@@ -1,30 +1,38 @@
 package handler
 
 import (
-	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"mime"
 	"net/http"
 	"person-api/internal/model"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"person-api/internal/services/person"
 )
 
 // @Summary      List persons
-// @Description  Returns paginated list of persons with optional filters
+// @Description  Returns paginated list of persons with optional filters.
+// @Description  Pass next_cursor from a previous response as cursor to page by keyset instead of page number.
 // @Tags         persons
 // @Accept       json
 // @Produce      json
 // @Param        page         query   int              false  "Page number"       default(1)
 // @Param        page_size    query   int              false  "Items per page"    default(10)
+// @Param        cursor       query   string           false  "Opaque cursor from next_cursor; cannot be combined with page"
+// @Param        sort         query   string           false  "Comma-separated fields, '-' for descending, ':nulls_first'/':nulls_last' suffix (e.g. -age:nulls_last,surname); score is allowed with q"
+// @Param        include_total query  bool             false  "Count total matching rows"  default(true)
+// @Param        include_deleted query bool            false  "Admin: include soft-deleted persons"  default(false)
+// @Param        q            query   string           false  "Fuzzy search by name, surname and patronymic; results are ranked by score unless sort is set"
 // @Param        name         query   string           false  "Filter by name"
 // @Param        surname      query   string           false  "Filter by surname"
 // @Param        min_age      query   int              false  "Filter by minimum age"
 // @Param        max_age      query   int              false  "Filter by maximum age"
-// @Param        gender       query   string           false  "Filter by gender"
-// @Param        nationality  query   string           false  "Filter by nationality"
+// @Param        gender       query   string           false  "Filter by gender (male, female); comma-separated for several"
+// @Param        nationality  query   string           false  "Filter by 2-letter country code; comma-separated for several (RU,KZ)"
 // @Success      200  {object}  PagedPersonsResponse
 // @Failure      400  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
@@ -33,24 +41,25 @@ func handleList(svc person.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		q, err := parsePersonQuery(r)
 		if err != nil {
-			respondError(w, http.StatusBadRequest, err.Error())
+			respondError(w, r, http.StatusBadRequest, codeBadRequest, err.Error())
 			return
 		}
 
 		res, err := svc.ListPersons(r.Context(), q)
 		if err != nil {
-			respondError(w, http.StatusInternalServerError, "cannot list persons")
+			respondServiceError(w, r, err, "cannot list persons")
 			return
 		}
 
 		out := PagedPersonsResponse{
-			Persons:  make([]PersonResponse, len(res.Persons)),
-			Total:    res.Total,
-			Page:     res.Page,
-			PageSize: res.PageSize,
+			Persons:    make([]PersonResponse, len(res.Persons)),
+			Total:      res.Total,
+			Page:       res.Page,
+			PageSize:   res.PageSize,
+			NextCursor: res.NextCursor,
 		}
 		for i, p := range res.Persons {
-			out.Persons[i] = PersonResponse(p)
+			out.Persons[i] = newPersonResponse(p)
 		}
 		respondJSON(w, http.StatusOK, out)
 	}
@@ -63,6 +72,7 @@ func handleList(svc person.Service) http.HandlerFunc {
 // @Produce      json
 // @Param        id   path      int              true   "Person ID"
 // @Success      200  {object}  PersonResponse
+// @Header       200  {string}  ETag  "Current version of the person"
 // @Failure      400  {object}  ErrorResponse
 // @Failure      404  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
@@ -71,39 +81,150 @@ func handleGetByID(svc person.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 		if err != nil || id < 1 {
-			respondError(w, http.StatusBadRequest, "invalid id")
+			respondError(w, r, http.StatusBadRequest, codeBadRequest, "invalid id")
 			return
 		}
 
 		p, err := svc.GetPersonByID(r.Context(), id)
 		if err != nil {
-			respondError(w, http.StatusNotFound, "person not found")
+			respondServiceError(w, r, err, "could not load person")
 			return
 		}
-		respondJSON(w, http.StatusOK, PersonResponse(p))
+		setETag(w, p.Version)
+		respondJSON(w, http.StatusOK, newPersonResponse(p))
+	}
+}
+
+// @Summary      Get person history
+// @Description  Returns every create, update, delete and restore of a person with field-level changes, oldest first
+// @Tags         persons
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int              true   "Person ID"
+// @Success      200  {object}  PersonHistoryResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /persons/{id}/history [get]
+func handleHistory(svc person.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id < 1 {
+			respondError(w, r, http.StatusBadRequest, codeBadRequest, "invalid id")
+			return
+		}
+
+		entries, err := svc.GetPersonHistory(r.Context(), id)
+		if err != nil {
+			respondServiceError(w, r, err, "could not load history")
+			return
+		}
+
+		out := PersonHistoryResponse{PersonID: id, Entries: make([]HistoryEntryResponse, len(entries))}
+		for i, e := range entries {
+			changes := make(map[string]FieldChangeResponse, len(e.Changes))
+			for field, c := range e.Changes {
+				changes[field] = FieldChangeResponse(c)
+			}
+			out.Entries[i] = HistoryEntryResponse{
+				ID:        e.ID,
+				Action:    e.Action,
+				Changes:   changes,
+				ChangedAt: e.ChangedAt,
+			}
+		}
+		respondJSON(w, http.StatusOK, out)
+	}
+}
+
+// @Summary      Export persons
+// @Description  Streams all persons matching the filters as CSV or newline-delimited JSON.
+// @Description  Accepts the same filters and sort as GET /persons; pagination parameters are ignored.
+// @Tags         persons
+// @Produce      text/csv,application/x-ndjson
+// @Param        format       query   string           false  "Output format"  Enums(csv, ndjson)  default(ndjson)
+// @Param        sort         query   string           false  "Same as in GET /persons"
+// @Param        include_deleted query bool            false  "Admin: include soft-deleted persons"  default(false)
+// @Param        q            query   string           false  "Fuzzy search by name, surname and patronymic; rows are ranked by score unless sort is set"
+// @Param        name         query   string           false  "Filter by name"
+// @Param        surname      query   string           false  "Filter by surname"
+// @Param        min_age      query   int              false  "Filter by minimum age"
+// @Param        max_age      query   int              false  "Filter by maximum age"
+// @Param        gender       query   string           false  "Filter by gender (male, female); comma-separated for several"
+// @Param        nationality  query   string           false  "Filter by 2-letter country code; comma-separated for several (RU,KZ)"
+// @Success      200  {string}  string  "Rows in the requested format"
+// @Failure      400  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /persons/export [get]
+func handleExport(svc person.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		switch format {
+		case "":
+			format = exportNDJSON
+		case exportCSV, exportNDJSON:
+		default:
+			respondError(w, r, http.StatusBadRequest, codeBadRequest, "format must be csv or ndjson")
+			return
+		}
+		q, err := parsePersonQuery(r)
+		if err != nil {
+			respondError(w, r, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+
+		out := newExportWriter(w, format)
+		err = svc.ExportPersons(r.Context(), q, func(p model.Person) error {
+			return out.write(newPersonResponse(p))
+		})
+		if err == nil {
+			err = out.finish()
+		}
+		if err != nil {
+			if !out.started {
+				respondServiceError(w, r, err, "cannot export persons")
+				return
+			}
+			// статус уже отправлен: обрываем ответ, чтобы клиент не принял
+			// неполную выгрузку за целую
+			panic(http.ErrAbortHandler)
+		}
 	}
 }
 
 // @Summary      Create person
-// @Description  Creates a new person and enriches their data (age, gender, nationality)
+// @Description  Creates a new person and enriches their data (age, gender, nationality).
+// @Description  A person is saved even if some providers fail: such attributes are listed in missing_fields and retried later.
+// @Description  In asynchronous mode (ENRICHMENT_MODE=async) the person is saved without enrichment and 202 is returned:
+// @Description  attributes stay pending until a background worker enriches them; poll the Location header.
 // @Tags         persons
 // @Accept       json
 // @Produce      json
-// @Param        payload  body      CreatePersonRequest  true   "Person payload"
+// @Param        payload          body      CreatePersonRequest  true   "Person payload"
+// @Param        Idempotency-Key  header    string               false  "Repeating the request with the same key returns the stored response"
 // @Success      201      {object}  PersonResponse
+// @Header       201      {string}  ETag  "Version of the created person"
+// @Header       201      {string}  Idempotent-Replayed  "true if the response was replayed for a repeated Idempotency-Key"
+// @Success      202      {object}  PersonResponse  "Person saved, enrichment is queued"
+// @Header       202      {string}  Location  "URL of the person"
+// @Header       202      {string}  ETag  "Version of the created person"
 // @Failure      400      {object}  ErrorResponse
+// @Failure      409      {object}  ErrorResponse  "Request with this Idempotency-Key is still in progress"
+// @Failure      422      {object}  ErrorResponse  "Idempotency-Key was used with a different request"
 // @Failure      500      {object}  ErrorResponse
+// @Failure      503      {object}  ErrorResponse  "Database unavailable"
+// @Failure      504      {object}  ErrorResponse  "Database timed out or the request deadline passed during enrichment"
 // @Router       /persons [post]
 func handleCreate(svc person.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req CreatePersonRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			respondError(w, http.StatusBadRequest, "invalid request payload")
+			respondError(w, r, http.StatusBadRequest, codeInvalidPayload, "invalid request payload")
 			return
 		}
 
 		if err := req.Validate(); err != nil {
-			respondError(w, http.StatusBadRequest, err.Error())
+			respondValidationError(w, r, err)
 			return
 		}
 
@@ -114,23 +235,232 @@ func handleCreate(svc person.Service) http.HandlerFunc {
 		}
 		p, err := svc.CreatePerson(r.Context(), cmd)
 		if err != nil {
-			respondError(w, http.StatusInternalServerError, "could not create person")
+			respondServiceError(w, r, err, "could not create person")
+			return
+		}
+		setETag(w, p.Version)
+		if enrichmentQueued(p) {
+			w.Header().Set("Location", fmt.Sprintf("/persons/%d", p.ID))
+			respondJSON(w, http.StatusAccepted, newPersonResponse(p))
 			return
 		}
-		respondJSON(w, http.StatusCreated, PersonResponse(p))
+		respondJSON(w, http.StatusCreated, newPersonResponse(p))
 	}
 }
 
-// @Summary      Update person
-// @Description  Updates one or more fields of an existing person
+// enrichmentQueued сообщает, ждут ли атрибуты p очереди обогащения
+// (pending без назначенного повтора).
+func enrichmentQueued(p model.Person) bool {
+	for _, src := range p.Enrichment {
+		if src.Status == model.EnrichmentPending && src.RetryAt == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// maxBatchSize — наибольшее число записей в одном POST /persons/batch.
+const maxBatchSize = 1000
+
+// batchWriteTimeout заменяет общий WriteTimeout сервера: обогащение пакета
+// занимает заметно больше времени, чем одиночный запрос.
+const batchWriteTimeout = 5 * time.Minute
+
+// @Summary      Create persons in batch
+// @Description  Validates, enriches and stores up to 1000 persons. Items fail independently:
+// @Description  each result has the status and error POST /persons would have returned for that item.
+// @Tags         persons
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      []CreatePersonRequest  true   "Persons to create"
+// @Success      200      {object}  BatchCreateResponse
+// @Failure      400      {object}  ErrorResponse
+// @Router       /persons/batch [post]
+func handleCreateBatch(svc person.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(batchWriteTimeout))
+
+		var reqs []CreatePersonRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+			respondError(w, r, http.StatusBadRequest, codeInvalidPayload, "request payload must be an array of persons")
+			return
+		}
+		if len(reqs) == 0 || len(reqs) > maxBatchSize {
+			respondError(w, r, http.StatusBadRequest, codeValidationFailed,
+				fmt.Sprintf("batch must contain from 1 to %d persons", maxBatchSize))
+			return
+		}
+
+		resp := BatchCreateResponse{Results: make([]BatchItemResult, len(reqs))}
+		// невалидные элементы не уходят в сервис
+		var cmds []model.CreatePersonCommand
+		var idx []int
+		for i, req := range reqs {
+			resp.Results[i].Index = i
+			if err := req.Validate(); err != nil {
+				p := validationProblem(err)
+				resp.Results[i].Status, resp.Results[i].Error = p.Status, &p
+				continue
+			}
+			cmds = append(cmds, model.CreatePersonCommand{
+				Name:       req.Name,
+				Surname:    req.Surname,
+				Patronymic: req.Patronymic,
+			})
+			idx = append(idx, i)
+		}
+
+		if len(cmds) > 0 {
+			for k, res := range svc.CreatePersons(r.Context(), cmds) {
+				item := &resp.Results[idx[k]]
+				if res.Err != nil {
+					p := serviceProblem(res.Err, "could not create person")
+					item.Status, item.Error = p.Status, &p
+					continue
+				}
+				pr := newPersonResponse(res.Person)
+				item.Status, item.Person = http.StatusCreated, &pr
+				if enrichmentQueued(res.Person) {
+					item.Status = http.StatusAccepted
+				}
+			}
+		}
+
+		for _, item := range resp.Results {
+			if item.Person != nil {
+				resp.Created++
+			} else {
+				resp.Failed++
+			}
+		}
+		respondJSON(w, http.StatusOK, resp)
+	}
+}
+
+// @Summary      Import persons
+// @Description  Imports persons from CSV (header with name, surname and optional patronymic) or NDJSON
+// @Description  (one CreatePersonRequest per line), sent as the body or as the file field of a multipart form.
+// @Description  Every row is validated like POST /persons and checked for likely duplicates. Files of up to 100 rows
+// @Description  are processed in the request (200 with the report); larger ones start a background job (202),
+// @Description  whose status is available at the Location header.
+// @Tags         persons
+// @Accept       text/csv,application/x-ndjson,multipart/form-data
+// @Produce      json
+// @Param        format            query  string  false  "File format; detected from Content-Type or file name if omitted"  Enums(csv, ndjson)
+// @Param        dry_run           query  bool    false  "Only validate and report, write nothing"  default(false)
+// @Param        enrich            query  bool    false  "Enrich age, gender and nationality"  default(true)
+// @Param        allow_duplicates  query  bool    false  "Create rows that look like existing persons"  default(false)
+// @Success      200  {object}  ImportReportResponse
+// @Success      202  {object}  ImportJobResponse
+// @Header       202  {string}  Location  "URL of the import job"
+// @Failure      400  {object}  ErrorResponse
+// @Failure      413  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /persons/import [post]
+func handleImport(svc person.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		_ = rc.SetReadDeadline(time.Now().Add(importReadTimeout))
+
+		opts, err := parseImportOptions(r)
+		if err != nil {
+			respondError(w, r, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+		rows, err := readImport(r)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				respondError(w, r, http.StatusRequestEntityTooLarge, codeInvalidPayload,
+					fmt.Sprintf("file must not exceed %d MB", maxImportBytes>>20))
+				return
+			}
+			respondError(w, r, http.StatusBadRequest, codeInvalidPayload, err.Error())
+			return
+		}
+
+		if len(rows) > importSyncRows {
+			job := svc.StartImport(r.Context(), rows, opts)
+			w.Header().Set("Location", "/persons/import/"+job.ID)
+			respondJSON(w, http.StatusAccepted, importJobResponse(job))
+			return
+		}
+
+		_ = rc.SetWriteDeadline(time.Now().Add(batchWriteTimeout))
+		report, err := svc.ImportPersons(r.Context(), rows, opts)
+		if err != nil {
+			respondServiceError(w, r, err, "could not import persons")
+			return
+		}
+		respondJSON(w, http.StatusOK, importReportResponse(report))
+	}
+}
+
+// @Summary      Get import job
+// @Description  Returns the progress of a background import and its report once finished
+// @Tags         persons
+// @Produce      json
+// @Param        jobID  path      string  true  "Import job ID"
+// @Success      200    {object}  ImportJobResponse
+// @Failure      404    {object}  ErrorResponse
+// @Router       /persons/import/{jobID} [get]
+func handleImportJob(svc person.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, err := svc.GetImportJob(r.Context(), chi.URLParam(r, "jobID"))
+		if err != nil {
+			respondServiceError(w, r, err, "cannot get import job")
+			return
+		}
+		respondJSON(w, http.StatusOK, importJobResponse(job))
+	}
+}
+
+// @Summary      Enrichment cache statistics
+// @Description  Hit and miss counters of the enrichment cache since the service started
+// @Tags         enrichment
+// @Produce      json
+// @Success      200  {object}  CacheStatsResponse
+// @Router       /enrichment/cache [get]
+func handleCacheStats(svc person.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		respondJSON(w, http.StatusOK, newCacheStatsResponse(svc.EnrichmentCacheStats()))
+	}
+}
+
+// @Summary      Enrichment queue statistics
+// @Description  Number of asynchronous enrichment jobs by status; dead jobs ran out of attempts
+// @Tags         enrichment
+// @Produce      json
+// @Success      200  {object}  QueueStatsResponse
+// @Failure      500  {object}  ErrorResponse
+// @Failure      503  {object}  ErrorResponse  "Database unavailable"
+// @Router       /enrichment/queue [get]
+func handleQueueStats(svc person.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		st, err := svc.EnrichmentQueueStats(r.Context())
+		if err != nil {
+			respondServiceError(w, r, err, "cannot get enrichment queue stats")
+			return
+		}
+		respondJSON(w, http.StatusOK, newQueueStatsResponse(st))
+	}
+}
+
+// @Summary      Replace person
+// @Description  Replaces all fields of an existing person; optional fields that are omitted or null are cleared
 // @Tags         persons
 // @Accept       json
 // @Produce      json
 // @Param        id       path      int                  true   "Person ID"
-// @Param        payload  body      UpdatePersonRequest  true   "Fields to update"
+// @Param        If-Match header    string               false  "ETag from a previous response; the update fails with 412 if the person has changed since"
+// @Param        payload  body      UpdatePersonRequest  true   "New state of the person"
 // @Success      200      {object}  PersonResponse
+// @Header       200      {string}  ETag  "New version of the person"
 // @Failure      400      {object}  ErrorResponse
 // @Failure      404      {object}  ErrorResponse
+// @Failure      409      {object}  ErrorResponse
+// @Failure      412      {object}  ErrorResponse
 // @Failure      500      {object}  ErrorResponse
 // @Router       /persons/{id} [put]
 func handleUpdate(svc person.Service) http.HandlerFunc {
@@ -138,57 +468,134 @@ func handleUpdate(svc person.Service) http.HandlerFunc {
 		idStr := chi.URLParam(r, "id")
 		id, err := strconv.ParseInt(idStr, 10, 64)
 		if err != nil || id < 1 {
-			respondError(w, http.StatusBadRequest, "invalid id")
+			respondError(w, r, http.StatusBadRequest, codeBadRequest, "invalid id")
+			return
+		}
+
+		version, err := parseIfMatch(r)
+		if err != nil {
+			respondError(w, r, http.StatusBadRequest, codeBadRequest, err.Error())
 			return
 		}
 
 		var req UpdatePersonRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			respondError(w, http.StatusBadRequest, "invalid request payload")
+			respondError(w, r, http.StatusBadRequest, codeInvalidPayload, "invalid request payload")
+			return
+		}
+
+		if err = req.Validate(); err != nil {
+			respondValidationError(w, r, err)
 			return
 		}
 
-		if req.Name == nil && req.Surname == nil && req.Patronymic == nil &&
-			req.Age == nil && req.Gender == nil && req.Nationality == nil {
-			respondError(w, http.StatusBadRequest, "no fields to update")
+		cmd := model.UpdatePersonCommand{
+			Name:            model.Some(req.Name),
+			Surname:         model.Some(req.Surname),
+			Patronymic:      model.OptionalOf(req.Patronymic),
+			Age:             model.OptionalOf(req.Age),
+			Gender:          model.OptionalOf(req.Gender),
+			Nationality:     model.OptionalOf(req.Nationality),
+			ExpectedVersion: version,
+		}
+		p, err := svc.UpdatePerson(r.Context(), id, cmd)
+		if err != nil {
+			respondServiceError(w, r, err, "could not update person")
+			return
+		}
+		setETag(w, p.Version)
+		respondJSON(w, http.StatusOK, newPersonResponse(p))
+	}
+}
+
+// @Summary      Patch person
+// @Description  Applies a JSON Merge Patch (RFC 7396): omitted fields are kept, null clears a field. name and surname cannot be cleared
+// @Tags         persons
+// @Accept       application/merge-patch+json,json
+// @Produce      json
+// @Param        id       path      int                 true   "Person ID"
+// @Param        If-Match header    string              false  "ETag from a previous response; the update fails with 412 if the person has changed since"
+// @Param        payload  body      PatchPersonRequest  true   "Fields to change"
+// @Success      200      {object}  PersonResponse
+// @Header       200      {string}  ETag  "New version of the person"
+// @Failure      400      {object}  ErrorResponse
+// @Failure      404      {object}  ErrorResponse
+// @Failure      409      {object}  ErrorResponse
+// @Failure      412      {object}  ErrorResponse
+// @Failure      415      {object}  ErrorResponse
+// @Failure      500      {object}  ErrorResponse
+// @Router       /persons/{id} [patch]
+func handlePatch(svc person.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idStr := chi.URLParam(r, "id")
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil || id < 1 {
+			respondError(w, r, http.StatusBadRequest, codeBadRequest, "invalid id")
+			return
+		}
+
+		if ct := r.Header.Get("Content-Type"); ct != "" {
+			mt, _, err := mime.ParseMediaType(ct)
+			if err != nil || (mt != mergePatchContentType && mt != "application/json") {
+				respondError(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMedia,
+					"content type must be "+mergePatchContentType)
+				return
+			}
+		}
+
+		version, err := parseIfMatch(r)
+		if err != nil {
+			respondError(w, r, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+
+		var req PatchPersonRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, r, http.StatusBadRequest, codeInvalidPayload, "invalid request payload")
+			return
+		}
+
+		if !req.Name.Set && !req.Surname.Set && !req.Patronymic.Set &&
+			!req.Age.Set && !req.Gender.Set && !req.Nationality.Set {
+			respondError(w, r, http.StatusBadRequest, codeValidationFailed, "no fields to update")
 			return
 		}
 
 		if err = req.Validate(); err != nil {
-			respondError(w, http.StatusBadRequest, err.Error())
+			respondValidationError(w, r, err)
 			return
 		}
 
 		cmd := model.UpdatePersonCommand{
-			Name:        req.Name,
-			Surname:     req.Surname,
-			Patronymic:  req.Patronymic,
-			Age:         req.Age,
-			Gender:      req.Gender,
-			Nationality: req.Nationality,
+			Name:            req.Name,
+			Surname:         req.Surname,
+			Patronymic:      req.Patronymic,
+			Age:             req.Age,
+			Gender:          req.Gender,
+			Nationality:     req.Nationality,
+			ExpectedVersion: version,
 		}
 		p, err := svc.UpdatePerson(r.Context(), id, cmd)
 		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				respondError(w, http.StatusNotFound, "person not found")
-			} else {
-				respondError(w, http.StatusInternalServerError, "could not update person")
-			}
+			respondServiceError(w, r, err, "could not update person")
 			return
 		}
-		respondJSON(w, http.StatusOK, PersonResponse(p))
+		setETag(w, p.Version)
+		respondJSON(w, http.StatusOK, newPersonResponse(p))
 	}
 }
 
 // @Summary      Delete person
-// @Description  Deletes a person by their ID
+// @Description  Soft-deletes a person by their ID; it can be restored until the purge retention expires
 // @Tags         persons
 // @Accept       json
 // @Produce      json
-// @Param        id   path      int              true   "Person ID"
+// @Param        id        path      int              true   "Person ID"
+// @Param        If-Match  header    string           false  "ETag from a previous response; the delete fails with 412 if the person has changed since"
 // @Success      204  {string}  string            "No Content"
 // @Failure      400  {object}  ErrorResponse
 // @Failure      404  {object}  ErrorResponse
+// @Failure      412  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
 // @Router       /persons/{id} [delete]
 func handleDelete(svc person.Service) http.HandlerFunc {
@@ -196,17 +603,46 @@ func handleDelete(svc person.Service) http.HandlerFunc {
 		idStr := chi.URLParam(r, "id")
 		id, err := strconv.ParseInt(idStr, 10, 64)
 		if err != nil || id < 1 {
-			respondError(w, http.StatusBadRequest, "invalid id")
+			respondError(w, r, http.StatusBadRequest, codeBadRequest, "invalid id")
 			return
 		}
-		if err = svc.DeletePerson(r.Context(), id); err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				respondError(w, http.StatusNotFound, "person not found")
-			} else {
-				respondError(w, http.StatusInternalServerError, "could not delete person")
-			}
+		version, err := parseIfMatch(r)
+		if err != nil {
+			respondError(w, r, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		if err = svc.DeletePerson(r.Context(), id, model.DeletePersonCommand{ExpectedVersion: version}); err != nil {
+			respondServiceError(w, r, err, "could not delete person")
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
+
+// @Summary      Restore person
+// @Description  Restores a soft-deleted person
+// @Tags         persons
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int              true   "Person ID"
+// @Success      200  {object}  PersonResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /persons/{id}/restore [post]
+func handleRestore(svc person.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id < 1 {
+			respondError(w, r, http.StatusBadRequest, codeBadRequest, "invalid id")
+			return
+		}
+		p, err := svc.RestorePerson(r.Context(), id)
+		if err != nil {
+			respondServiceError(w, r, err, "could not restore person")
+			return
+		}
+		setETag(w, p.Version)
+		respondJSON(w, http.StatusOK, newPersonResponse(p))
+	}
+}
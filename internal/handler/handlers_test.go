@@ -5,10 +5,14 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"person-api/internal/model"
 	personsvc "person-api/internal/services/person"
@@ -27,16 +31,80 @@ func (m *MockPersonService) GetPersonByID(ctx context.Context, id int64) (model.
 	args := m.Called(ctx, id)
 	return args.Get(0).(model.Person), args.Error(1)
 }
+func (m *MockPersonService) GetPersonHistory(ctx context.Context, id int64) ([]model.HistoryEntry, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).([]model.HistoryEntry), args.Error(1)
+}
 func (m *MockPersonService) CreatePerson(ctx context.Context, cmd model.CreatePersonCommand) (model.Person, error) {
 	args := m.Called(ctx, cmd)
 	return args.Get(0).(model.Person), args.Error(1)
 }
+func (m *MockPersonService) CreatePersons(ctx context.Context, cmds []model.CreatePersonCommand) []model.CreateResult {
+	return m.Called(ctx, cmds).Get(0).([]model.CreateResult)
+}
+func (m *MockPersonService) ExportPersons(ctx context.Context, q model.PersonQuery, fn func(model.Person) error) error {
+	args := m.Called(ctx, q, fn)
+	for _, p := range args.Get(0).([]model.Person) {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+func (m *MockPersonService) ImportPersons(ctx context.Context, rows []model.ImportRow, opts model.ImportOptions) (model.ImportReport, error) {
+	args := m.Called(ctx, rows, opts)
+	return args.Get(0).(model.ImportReport), args.Error(1)
+}
+func (m *MockPersonService) StartImport(ctx context.Context, rows []model.ImportRow, opts model.ImportOptions) model.ImportJob {
+	return m.Called(ctx, rows, opts).Get(0).(model.ImportJob)
+}
+func (m *MockPersonService) GetImportJob(ctx context.Context, id string) (model.ImportJob, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(model.ImportJob), args.Error(1)
+}
 func (m *MockPersonService) UpdatePerson(ctx context.Context, id int64, cmd model.UpdatePersonCommand) (model.Person, error) {
 	args := m.Called(ctx, id, cmd)
 	return args.Get(0).(model.Person), args.Error(1)
 }
-func (m *MockPersonService) DeletePerson(ctx context.Context, id int64) error {
-	return m.Called(ctx, id).Error(0)
+func (m *MockPersonService) DeletePerson(ctx context.Context, id int64, cmd model.DeletePersonCommand) error {
+	return m.Called(ctx, id, cmd).Error(0)
+}
+func (m *MockPersonService) RestorePerson(ctx context.Context, id int64) (model.Person, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(model.Person), args.Error(1)
+}
+func (m *MockPersonService) PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	args := m.Called(ctx, retention)
+	return args.Get(0).(int64), args.Error(1)
+}
+func (m *MockPersonService) RepairEnrichment(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
+	return args.Int(0), args.Error(1)
+}
+func (m *MockPersonService) ProcessEnrichmentJobs(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
+	return args.Int(0), args.Error(1)
+}
+func (m *MockPersonService) EnrichmentQueueStats(ctx context.Context) (model.QueueStats, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(model.QueueStats), args.Error(1)
+}
+func (m *MockPersonService) ClaimIdempotencyKey(ctx context.Context, key, fingerprint string) (model.IdempotencyRecord, bool, error) {
+	args := m.Called(ctx, key, fingerprint)
+	return args.Get(0).(model.IdempotencyRecord), args.Bool(1), args.Error(2)
+}
+func (m *MockPersonService) CompleteIdempotencyKey(ctx context.Context, key string, rec model.IdempotencyRecord) error {
+	return m.Called(ctx, key, rec).Error(0)
+}
+func (m *MockPersonService) ReleaseIdempotencyKey(ctx context.Context, key string, claim int64) error {
+	return m.Called(ctx, key, claim).Error(0)
+}
+func (m *MockPersonService) EnrichmentCacheStats() model.CacheStats {
+	return m.Called().Get(0).(model.CacheStats)
+}
+func (m *MockPersonService) PurgeIdempotencyKeys(ctx context.Context, ttl time.Duration) (int64, error) {
+	args := m.Called(ctx, ttl)
+	return args.Get(0).(int64), args.Error(1)
 }
 
 func setupRouter(s personsvc.Service) http.Handler {
@@ -53,12 +121,47 @@ func TestHandleGetByID_Success(t *testing.T) {
 	setupRouter(svc).ServeHTTP(w, req)
 
 	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, `"0"`, w.Header().Get("ETag"))
 	var got model.Person
 	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
 	require.Equal(t, person, got)
 	svc.AssertExpectations(t)
 }
 
+func TestHandleGetByID_Enrichment(t *testing.T) {
+	svc := new(MockPersonService)
+	prob, count := 0.8, 300
+	retryAt := time.Date(2024, 1, 1, 12, 1, 0, 0, time.UTC)
+	svc.On("GetPersonByID", mock.Anything, int64(1)).Return(model.Person{
+		ID: 1, Name: "Ivan", Surname: "Ivanov", Nationality: ptr("RU"),
+		Enrichment: map[string]model.AttributeSource{
+			"nationality": {Status: model.EnrichmentComplete, Provider: "nationalize", Probability: &prob, Count: &count, Candidates: []model.Candidate{
+				{Value: "RU", Probability: 0.8}, {Value: "BY", Probability: 0.1},
+			}},
+			"gender": {Status: model.EnrichmentComplete},
+			"age":    {Status: model.EnrichmentPending, Error: "agify: status 503", Attempts: 1, RetryAt: &retryAt},
+		},
+	}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/persons/1", nil)
+	w := httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var got struct {
+		Enrichment    json.RawMessage `json:"enrichment"`
+		MissingFields []string        `json:"missing_fields"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	require.JSONEq(t, `{
+		"nationality": {"status": "complete", "provider": "nationalize", "probability": 0.8, "count": 300,
+			"candidates": [{"value": "RU", "probability": 0.8}, {"value": "BY", "probability": 0.1}]},
+		"gender": {"status": "complete"},
+		"age": {"status": "pending", "error": "agify: status 503", "attempts": 1, "retry_at": "2024-01-01T12:01:00Z"}
+	}`, string(got.Enrichment))
+	require.Equal(t, []string{"age"}, got.MissingFields)
+}
+
 func TestHandleGetByID_InvalidID(t *testing.T) {
 	svc := new(MockPersonService)
 
@@ -71,7 +174,7 @@ func TestHandleGetByID_InvalidID(t *testing.T) {
 
 func TestHandleGetByID_NotFound(t *testing.T) {
 	svc := new(MockPersonService)
-	svc.On("GetPersonByID", mock.Anything, int64(2)).Return(model.Person{}, errors.New("not found"))
+	svc.On("GetPersonByID", mock.Anything, int64(2)).Return(model.Person{}, personsvc.ErrNotFound)
 
 	req := httptest.NewRequest(http.MethodGet, "/persons/2", nil)
 	w := httptest.NewRecorder()
@@ -81,6 +184,40 @@ func TestHandleGetByID_NotFound(t *testing.T) {
 	svc.AssertExpectations(t)
 }
 
+func TestRespondServiceError_Statuses(t *testing.T) {
+	tests := []struct {
+		err     error
+		status  int
+		errCode string
+		detail  string
+	}{
+		{personsvc.ErrNotFound, http.StatusNotFound, codeNotFound, "person not found"},
+		{fmt.Errorf("%w: bad cursor", personsvc.ErrInvalidQuery), http.StatusBadRequest, codeInvalidQuery, "invalid query: bad cursor"},
+		{fmt.Errorf("%w: pq: value too long", personsvc.ErrValidation), http.StatusBadRequest, codeValidationFailed, "invalid person data"},
+		{personsvc.ErrVersionMismatch, http.StatusPreconditionFailed, codeVersionMismatch, "person has been modified"},
+		{fmt.Errorf("%w: pq: duplicate key", personsvc.ErrConflict), http.StatusConflict, codeConflict, "person conflicts with existing data"},
+		{fmt.Errorf("%w: dial tcp: connection refused", personsvc.ErrUnavailable), http.StatusServiceUnavailable, codeUnavailable, "service temporarily unavailable"},
+		{fmt.Errorf("%w: context deadline exceeded", personsvc.ErrTimeout), http.StatusGatewayTimeout, codeTimeout, "upstream timed out"},
+		{errors.New("boom"), http.StatusInternalServerError, codeInternal, "could not load person"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.err.Error(), func(t *testing.T) {
+			svc := new(MockPersonService)
+			svc.On("GetPersonByID", mock.Anything, int64(2)).Return(model.Person{}, tc.err)
+
+			req := httptest.NewRequest(http.MethodGet, "/persons/2", nil)
+			w := httptest.NewRecorder()
+			setupRouter(svc).ServeHTTP(w, req)
+
+			require.Equal(t, tc.status, w.Code)
+			problem := decodeProblem(t, w)
+			require.Equal(t, tc.status, problem.Status)
+			require.Equal(t, tc.errCode, problem.Code)
+			require.Equal(t, tc.detail, problem.Detail)
+		})
+	}
+}
+
 func TestHandleCreate_Success(t *testing.T) {
 	svc := new(MockPersonService)
 	cmd := model.CreatePersonCommand{Name: "Jane", Surname: "Doe"}
@@ -99,6 +236,126 @@ func TestHandleCreate_Success(t *testing.T) {
 	svc.AssertExpectations(t)
 }
 
+func TestHandleCreate_Queued(t *testing.T) {
+	svc := new(MockPersonService)
+	cmd := model.CreatePersonCommand{Name: "Jane", Surname: "Doe"}
+	svc.On("CreatePerson", mock.Anything, cmd).Return(model.Person{ID: 2, Name: "Jane", Surname: "Doe", Version: 1,
+		Enrichment: map[string]model.AttributeSource{"age": {Status: model.EnrichmentPending}},
+	}, nil)
+
+	body, _ := json.Marshal(cmd)
+	req := httptest.NewRequest(http.MethodPost, "/persons", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	require.Equal(t, "/persons/2", w.Header().Get("Location"))
+	var got PersonResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	require.Equal(t, []string{"age"}, got.MissingFields)
+	require.Equal(t, "pending", got.Enrichment["age"].Status)
+}
+
+func TestHandleCreate_IdempotencyKey(t *testing.T) {
+	svc := new(MockPersonService)
+	cmd := model.CreatePersonCommand{Name: "Jane", Surname: "Doe"}
+	svc.On("CreatePerson", mock.Anything, cmd).Return(model.Person{ID: 2, Name: "Jane", Surname: "Doe", Version: 1}, nil).Once()
+
+	var fingerprint string
+	var saved model.IdempotencyRecord
+	svc.On("ClaimIdempotencyKey", mock.Anything, "k1", mock.Anything).
+		Run(func(args mock.Arguments) { fingerprint = args.String(2) }).
+		Return(model.IdempotencyRecord{}, true, nil).Once()
+	svc.On("CompleteIdempotencyKey", mock.Anything, "k1", mock.Anything).
+		Run(func(args mock.Arguments) { saved = args.Get(2).(model.IdempotencyRecord) }).
+		Return(nil).Once()
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/persons", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", "k1")
+		w := httptest.NewRecorder()
+		setupRouter(svc).ServeHTTP(w, req)
+		return w
+	}
+
+	first := send(`{"name":"Jane","surname":"Doe"}`)
+	require.Equal(t, http.StatusCreated, first.Code)
+	require.Equal(t, http.StatusCreated, saved.Status)
+	require.Equal(t, `"1"`, saved.Header["ETag"])
+	require.Equal(t, first.Body.Bytes(), saved.Body)
+
+	// повтор с тем же телом (другие пробелы и порядок полей) — сохранённый ответ
+	saved.Fingerprint = fingerprint
+	svc.On("ClaimIdempotencyKey", mock.Anything, "k1", fingerprint).Return(saved, false, nil).Once()
+	second := send(`{ "surname": "Doe", "name": "Jane" }`)
+	require.Equal(t, http.StatusCreated, second.Code)
+	require.Equal(t, "true", second.Header().Get("Idempotent-Replayed"))
+	require.Equal(t, `"1"`, second.Header().Get("ETag"))
+	require.Equal(t, first.Body.String(), second.Body.String())
+
+	// тот же ключ с другим телом
+	svc.On("ClaimIdempotencyKey", mock.Anything, "k1", mock.Anything).Return(saved, false, nil).Once()
+	w := send(`{"name":"John","surname":"Doe"}`)
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	require.Equal(t, codeIdempotencyKeyReused, decodeProblem(t, w).Code)
+
+	// первый запрос ещё выполняется
+	svc.On("ClaimIdempotencyKey", mock.Anything, "k1", fingerprint).
+		Return(model.IdempotencyRecord{Fingerprint: fingerprint}, false, nil).Once()
+	w = send(`{"name":"Jane","surname":"Doe"}`)
+	require.Equal(t, http.StatusConflict, w.Code)
+
+	svc.AssertExpectations(t)
+}
+
+func TestHandleCreate_IdempotencyKeyReleasedOnFailure(t *testing.T) {
+	svc := new(MockPersonService)
+	svc.On("ClaimIdempotencyKey", mock.Anything, "k1", mock.Anything).Return(model.IdempotencyRecord{Claim: 2}, true, nil)
+	svc.On("CreatePerson", mock.Anything, mock.Anything).Return(model.Person{}, personsvc.ErrUnavailable)
+	svc.On("ReleaseIdempotencyKey", mock.Anything, "k1", int64(2)).Return(nil).Once()
+
+	req := httptest.NewRequest(http.MethodPost, "/persons", strings.NewReader(`{"name":"Jane","surname":"Doe"}`))
+	req.Header.Set("Idempotency-Key", "k1")
+	w := httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	svc.AssertExpectations(t)
+	svc.AssertNotCalled(t, "CompleteIdempotencyKey", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestHandleCacheStats(t *testing.T) {
+	svc := new(MockPersonService)
+	svc.On("EnrichmentCacheStats").Return(model.CacheStats{
+		Enabled: true, Entries: 2, Capacity: 100, MemoryHits: 6, StoreHits: 2, NegativeHits: 1, Misses: 2,
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/enrichment/cache", nil)
+	w := httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"enabled": true, "entries": 2, "capacity": 100, "memory_hits": 6, "store_hits": 2,
+		"negative_hits": 1, "misses": 2, "store_errors": 0, "hit_ratio": 0.8}`, w.Body.String())
+}
+
+func TestHandleQueueStats(t *testing.T) {
+	svc := new(MockPersonService)
+	oldest := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	svc.On("EnrichmentQueueStats", mock.Anything).Return(model.QueueStats{Queued: 4, Running: 2, Dead: 1, OldestQueued: &oldest}, nil).Once()
+	svc.On("EnrichmentQueueStats", mock.Anything).Return(model.QueueStats{}, personsvc.ErrUnavailable).Once()
+
+	req := httptest.NewRequest(http.MethodGet, "/enrichment/queue", nil)
+	w := httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"queued": 4, "running": 2, "dead": 1, "oldest_queued": "2024-05-01T12:00:00Z"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/enrichment/queue", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
 func TestHandleCreate_InvalidJSON(t *testing.T) {
 	svc := new(MockPersonService)
 
@@ -111,20 +368,386 @@ func TestHandleCreate_InvalidJSON(t *testing.T) {
 
 func TestHandleCreate_ValidationError(t *testing.T) {
 	svc := new(MockPersonService)
-	req := httptest.NewRequest(http.MethodPost, "/persons", bytes.NewReader([]byte(`{"name":"","surname":""}`)))
+	req := httptest.NewRequest(http.MethodPost, "/persons", bytes.NewReader([]byte(`{"name":"","surname":"D0e"}`)))
 	w := httptest.NewRecorder()
 	setupRouter(svc).ServeHTTP(w, req)
 
 	require.Equal(t, http.StatusBadRequest, w.Code)
+	problem := decodeProblem(t, w)
+	require.Equal(t, codeValidationFailed, problem.Code)
+	require.Equal(t, map[string]string{
+		"name":    "name is required",
+		"surname": "surname must contain only letters",
+	}, problem.Errors)
+}
+
+func TestHandleUpdate_ValidationError(t *testing.T) {
+	svc := new(MockPersonService)
+	req := httptest.NewRequest(http.MethodPut, "/persons/1", bytes.NewReader([]byte(`{"name":"Anna","surname":"Petrova","age":-1,"gender":"x"}`)))
+	w := httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	problem := decodeProblem(t, w)
+	require.Equal(t, map[string]string{
+		"age":    "age must be non-negative",
+		"gender": "gender must be 'male' or 'female'",
+	}, problem.Errors)
+}
+
+func TestProblemResponse(t *testing.T) {
+	svc := new(MockPersonService)
+	req := httptest.NewRequest(http.MethodGet, "/persons/abc", nil)
+	req.Header.Set("X-Request-Id", "req-42")
+	w := httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	require.Equal(t, ErrorResponse{
+		Type:      "about:blank",
+		Title:     "Bad Request",
+		Status:    http.StatusBadRequest,
+		Detail:    "invalid id",
+		Instance:  "/persons/abc",
+		Code:      codeBadRequest,
+		RequestID: "req-42",
+	}, decodeProblem(t, w))
+
+	// неизвестные маршруты и методы отвечают в том же формате
+	w = httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nope", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Equal(t, codeNotFound, decodeProblem(t, w).Code)
+
+	w = httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/persons", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	require.Equal(t, codeMethodNotAllowed, decodeProblem(t, w).Code)
+}
+
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) ErrorResponse {
+	t.Helper()
+	require.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	var p ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	return p
+}
+
+func TestHandleCreateBatch(t *testing.T) {
+	svc := new(MockPersonService)
+	// невалидный элемент не уходит в сервис
+	svc.On("CreatePersons", mock.Anything, []model.CreatePersonCommand{
+		{Name: "Ivan", Surname: "Ivanov"},
+		{Name: "Anna", Surname: "Petrova"},
+	}).Return([]model.CreateResult{
+		{Person: model.Person{ID: 1, Name: "Ivan", Surname: "Ivanov", Version: 1}},
+		{Err: personsvc.ErrUnavailable},
+	})
+
+	body := `[{"name":"Ivan","surname":"Ivanov"},{"name":"1","surname":"X"},{"name":"Anna","surname":"Petrova"}]`
+	req := httptest.NewRequest(http.MethodPost, "/persons/batch", bytes.NewReader([]byte(body)))
+	w := httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp BatchCreateResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, 1, resp.Created)
+	require.Equal(t, 2, resp.Failed)
+	require.Len(t, resp.Results, 3)
+
+	require.Equal(t, http.StatusCreated, resp.Results[0].Status)
+	require.Equal(t, int64(1), resp.Results[0].Person.ID)
+	require.Equal(t, 1, resp.Results[1].Index)
+	require.Equal(t, http.StatusBadRequest, resp.Results[1].Status)
+	require.Equal(t, "name must contain only letters", resp.Results[1].Error.Errors["name"])
+	require.Equal(t, http.StatusServiceUnavailable, resp.Results[2].Status)
+	require.Equal(t, "upstream_unavailable", resp.Results[2].Error.Code)
+	svc.AssertExpectations(t)
+
+	for _, body := range []string{`[]`, `{"name":"Ivan"}`} {
+		req = httptest.NewRequest(http.MethodPost, "/persons/batch", bytes.NewReader([]byte(body)))
+		w = httptest.NewRecorder()
+		setupRouter(svc).ServeHTTP(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
+
+func TestHandleExport(t *testing.T) {
+	svc := new(MockPersonService)
+	age := 30
+	persons := []model.Person{
+		{ID: 1, Name: "Ivan", Surname: "Ivanov", Age: &age, Gender: ptr("male"), CreatedAt: "2024-01-01T00:00:00Z", Version: 1},
+		{ID: 2, Name: "Oleg", Surname: "Smirnov", CreatedAt: "2024-01-02T00:00:00Z", Version: 3},
+	}
+	q := model.PersonQuery{Page: 1, PageSize: 10, Genders: []string{"male"}}
+	svc.On("ExportPersons", mock.Anything, q, mock.Anything).Return(persons, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/persons/export?format=csv&gender=male", nil)
+	w := httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	require.Equal(t, "id,name,surname,patronymic,age,gender,nationality,created_at,deleted_at,version\n"+
+		"1,Ivan,Ivanov,,30,male,,2024-01-01T00:00:00Z,,1\n"+
+		"2,Oleg,Smirnov,,,,,2024-01-02T00:00:00Z,,3\n", w.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/persons/export?gender=male", nil)
+	w = httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 2)
+	var p PersonResponse
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &p))
+	require.Equal(t, "Oleg", p.Name)
+
+	req = httptest.NewRequest(http.MethodGet, "/persons/export?format=xml", nil)
+	w = httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandleExport_Error(t *testing.T) {
+	svc := new(MockPersonService)
+	svc.On("ExportPersons", mock.Anything, mock.Anything, mock.Anything).Return([]model.Person{}, personsvc.ErrUnavailable)
+
+	// до первой строки ошибка возвращается обычным ответом
+	req := httptest.NewRequest(http.MethodGet, "/persons/export", nil)
+	w := httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, "upstream_unavailable", decodeProblem(t, w).Code)
+}
+
+func TestHandleImport_DryRun(t *testing.T) {
+	svc := new(MockPersonService)
+	rows := []model.ImportRow{
+		{Line: 2, Cmd: model.CreatePersonCommand{Name: "Ivan", Surname: "Ivanov", Patronymic: ptr("Petrovich")}},
+		{Line: 3, Cmd: model.CreatePersonCommand{Name: "1", Surname: ""}, Errors: map[string]string{
+			"name":    "name must contain only letters",
+			"surname": "surname is required",
+		}},
+	}
+	opts := model.ImportOptions{DryRun: true, Enrich: true}
+	svc.On("ImportPersons", mock.Anything, rows, opts).Return(model.ImportReport{
+		DryRun: true, Total: 2, Valid: 1, Invalid: 1,
+		Rows: []model.ImportRowResult{
+			{Line: 2, Status: model.ImportValid},
+			{Line: 3, Status: model.ImportInvalid, Errors: rows[1].Errors},
+		},
+	}, nil)
+
+	// лишние колонки выгрузки пропускаются
+	body := "id,name,surname,patronymic,age\n1,Ivan,Ivanov,Petrovich,30\n2,1,,,\n"
+	req := httptest.NewRequest(http.MethodPost, "/persons/import?dry_run=true", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var rep ImportReportResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rep))
+	require.True(t, rep.DryRun)
+	require.Equal(t, 1, rep.Invalid)
+	require.Equal(t, "surname is required", rep.Rows[1].Errors["surname"])
+	svc.AssertExpectations(t)
+}
+
+func TestHandleImport_BackgroundJob(t *testing.T) {
+	svc := new(MockPersonService)
+	var body strings.Builder
+	for i := 0; i < importSyncRows+1; i++ {
+		body.WriteString(`{"name":"Ivan","surname":"Ivanov"}` + "\n")
+	}
+	svc.On("StartImport", mock.Anything, mock.MatchedBy(func(rows []model.ImportRow) bool {
+		return len(rows) == importSyncRows+1 && rows[1].Line == 2
+	}), model.ImportOptions{Enrich: false}).Return(model.ImportJob{ID: "abc", Status: model.JobPending, Total: importSyncRows + 1})
+
+	req := httptest.NewRequest(http.MethodPost, "/persons/import?format=ndjson&enrich=false", strings.NewReader(body.String()))
+	w := httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	require.Equal(t, "/persons/import/abc", w.Header().Get("Location"))
+
+	finished := "2024-01-01T00:00:00Z"
+	svc.On("GetImportJob", mock.Anything, "abc").Return(model.ImportJob{
+		ID: "abc", Status: model.JobDone, Total: 2, Processed: 2, FinishedAt: &finished,
+		Report: &model.ImportReport{Total: 2, Created: 1, Failed: 1, Rows: []model.ImportRowResult{
+			{Line: 1, Status: model.ImportCreated, PersonID: 5},
+			{Line: 2, Status: model.ImportFailed, Err: personsvc.ErrTimeout},
+		}},
+	}, nil)
+	svc.On("GetImportJob", mock.Anything, "nope").Return(model.ImportJob{}, personsvc.ErrJobNotFound)
+
+	req = httptest.NewRequest(http.MethodGet, "/persons/import/abc", nil)
+	w = httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var job ImportJobResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	require.Equal(t, model.JobDone, job.Status)
+	require.Equal(t, int64(5), job.Report.Rows[0].PersonID)
+	require.Equal(t, "upstream_timeout", job.Report.Rows[1].Error.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/persons/import/nope", nil)
+	w = httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+	require.Equal(t, http.StatusNotFound, w.Code)
+	svc.AssertExpectations(t)
+}
+
+func TestHandleImport_BadFile(t *testing.T) {
+	svc := new(MockPersonService)
+	for _, tc := range []struct{ url, contentType, body string }{
+		{"/persons/import", "text/plain", "name,surname\nIvan,Ivanov\n"},
+		{"/persons/import?format=csv", "", "first,last\nIvan,Ivanov\n"},
+		{"/persons/import?format=csv", "", "name,surname\n"},
+		{"/persons/import?format=ndjson&dry_run=maybe", "", `{"name":"Ivan"}`},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tc.url, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", tc.contentType)
+		w := httptest.NewRecorder()
+		setupRouter(svc).ServeHTTP(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Code, tc.url)
+	}
+}
+
+func TestReadImport_Multipart(t *testing.T) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, err := mw.CreateFormFile("file", "persons.ndjson")
+	require.NoError(t, err)
+	_, _ = fw.Write([]byte("{\"name\":\"Anna\",\"surname\":\"Petrova\"}\n\nnot json\n"))
+	require.NoError(t, mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/persons/import", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rows, err := readImport(req)
+	require.NoError(t, err)
+	require.Equal(t, []model.ImportRow{
+		{Line: 1, Cmd: model.CreatePersonCommand{Name: "Anna", Surname: "Petrova"}},
+		{Line: 3, Errors: map[string]string{"row": "invalid JSON object"}},
+	}, rows)
 }
 
 func TestHandleUpdate_NoFields(t *testing.T) {
 	svc := new(MockPersonService)
+	// PUT заменяет запись целиком, имя и фамилия обязательны
 	req := httptest.NewRequest(http.MethodPut, "/persons/1", bytes.NewReader([]byte(`{}`)))
 	w := httptest.NewRecorder()
 	setupRouter(svc).ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, decodeProblem(t, w).Errors, "name")
 
+	req = httptest.NewRequest(http.MethodPatch, "/persons/1", bytes.NewReader([]byte(`{}`)))
+	w = httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
 	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, "no fields to update", decodeProblem(t, w).Detail)
+	svc.AssertNotCalled(t, "UpdatePerson", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestHandleUpdate_FullReplace(t *testing.T) {
+	svc := new(MockPersonService)
+	// пропущенные необязательные поля очищаются
+	cmd := model.UpdatePersonCommand{
+		Name:        model.Some("Anna"),
+		Surname:     model.Some("Petrova"),
+		Patronymic:  model.Null[string](),
+		Age:         model.Some(30),
+		Gender:      model.Null[string](),
+		Nationality: model.Null[string](),
+	}
+	svc.On("UpdatePerson", mock.Anything, int64(1), cmd).Return(model.Person{ID: 1, Name: "Anna", Surname: "Petrova", Version: 2}, nil)
+
+	req := httptest.NewRequest(http.MethodPut, "/persons/1", bytes.NewReader([]byte(`{"name":"Anna","surname":"Petrova","age":30,"gender":null}`)))
+	w := httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	svc.AssertExpectations(t)
+}
+
+func TestHandlePatch(t *testing.T) {
+	svc := new(MockPersonService)
+	// null очищает поле, пропущенное не меняется
+	cmd := model.UpdatePersonCommand{Patronymic: model.Null[string](), Age: model.Some(30)}
+	svc.On("UpdatePerson", mock.Anything, int64(1), cmd).Return(model.Person{ID: 1, Name: "Anna", Version: 2}, nil)
+
+	req := httptest.NewRequest(http.MethodPatch, "/persons/1", bytes.NewReader([]byte(`{"patronymic":null,"age":30}`)))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	w := httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	// имя и фамилию очистить нельзя
+	req = httptest.NewRequest(http.MethodPatch, "/persons/1", bytes.NewReader([]byte(`{"name":null,"surname":"1"}`)))
+	w = httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, map[string]string{
+		"name":    "name cannot be null",
+		"surname": "surname must contain only letters",
+	}, decodeProblem(t, w).Errors)
+
+	req = httptest.NewRequest(http.MethodPatch, "/persons/1", bytes.NewReader([]byte(`{"age":30}`)))
+	req.Header.Set("Content-Type", "text/plain")
+	w = httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+	require.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	svc.AssertNumberOfCalls(t, "UpdatePerson", 1)
+}
+
+func TestHandleUpdate_IfMatch(t *testing.T) {
+	svc := new(MockPersonService)
+	version := int64(3)
+	cmd := model.UpdatePersonCommand{Name: model.Some("Anna"), ExpectedVersion: &version}
+	svc.On("UpdatePerson", mock.Anything, int64(1), cmd).Return(model.Person{ID: 1, Name: "Anna", Version: 4}, nil).Once()
+	svc.On("UpdatePerson", mock.Anything, int64(1), cmd).Return(model.Person{}, personsvc.ErrVersionMismatch).Once()
+
+	req := httptest.NewRequest(http.MethodPatch, "/persons/1", bytes.NewReader([]byte(`{"name":"Anna"}`)))
+	req.Header.Set("If-Match", `"3"`)
+	w := httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, `"4"`, w.Header().Get("ETag"))
+
+	req = httptest.NewRequest(http.MethodPatch, "/persons/1", bytes.NewReader([]byte(`{"name":"Anna"}`)))
+	req.Header.Set("If-Match", `W/"3"`)
+	w = httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+	require.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	req = httptest.NewRequest(http.MethodPatch, "/persons/1", bytes.NewReader([]byte(`{"name":"Anna"}`)))
+	req.Header.Set("If-Match", `3`)
+	w = httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	svc.AssertExpectations(t)
+}
+
+func TestHandleDelete_IfMatch(t *testing.T) {
+	svc := new(MockPersonService)
+	version := int64(2)
+	svc.On("DeletePerson", mock.Anything, int64(5), model.DeletePersonCommand{ExpectedVersion: &version}).Return(personsvc.ErrVersionMismatch)
+	svc.On("DeletePerson", mock.Anything, int64(5), model.DeletePersonCommand{}).Return(nil)
+
+	req := httptest.NewRequest(http.MethodDelete, "/persons/5", nil)
+	req.Header.Set("If-Match", `"2"`)
+	w := httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+	require.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	req = httptest.NewRequest(http.MethodDelete, "/persons/5", nil)
+	req.Header.Set("If-Match", "*")
+	w = httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	svc.AssertExpectations(t)
 }
 
 func TestHandleDelete_InvalidID(t *testing.T) {
@@ -136,6 +759,48 @@ func TestHandleDelete_InvalidID(t *testing.T) {
 	require.Equal(t, http.StatusBadRequest, w.Code)
 }
 
+func TestHandleRestore(t *testing.T) {
+	svc := new(MockPersonService)
+	svc.On("RestorePerson", mock.Anything, int64(3)).Return(model.Person{ID: 3, Name: "Anna"}, nil)
+	svc.On("RestorePerson", mock.Anything, int64(4)).Return(model.Person{}, personsvc.ErrNotFound)
+
+	req := httptest.NewRequest(http.MethodPost, "/persons/3/restore", nil)
+	w := httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/persons/4/restore", nil)
+	w = httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+	require.Equal(t, http.StatusNotFound, w.Code)
+	svc.AssertExpectations(t)
+}
+
+func TestHandleHistory(t *testing.T) {
+	svc := new(MockPersonService)
+	entries := []model.HistoryEntry{
+		{ID: 1, PersonID: 3, Action: "create", Changes: map[string]model.FieldChange{"name": {Old: nil, New: "Anna"}}, ChangedAt: "2024-01-01T00:00:00Z"},
+		{ID: 2, PersonID: 3, Action: "update", Changes: map[string]model.FieldChange{"nationality": {Old: "RU", New: "KZ"}}, ChangedAt: "2024-02-01T00:00:00Z"},
+	}
+	svc.On("GetPersonHistory", mock.Anything, int64(3)).Return(entries, nil)
+	svc.On("GetPersonHistory", mock.Anything, int64(4)).Return([]model.HistoryEntry(nil), personsvc.ErrNotFound)
+
+	req := httptest.NewRequest(http.MethodGet, "/persons/3/history", nil)
+	w := httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var got PersonHistoryResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	require.Len(t, got.Entries, 2)
+	require.Equal(t, "KZ", got.Entries[1].Changes["nationality"].New)
+
+	req = httptest.NewRequest(http.MethodGet, "/persons/4/history", nil)
+	w = httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+	require.Equal(t, http.StatusNotFound, w.Code)
+	svc.AssertExpectations(t)
+}
+
 func TestParsePersonQuery_Default(t *testing.T) {
 	req := &http.Request{URL: &url.URL{RawQuery: ""}}
 	q, err := parsePersonQuery(req)
@@ -146,14 +811,16 @@ func TestParsePersonQuery_Default(t *testing.T) {
 
 func TestParsePersonQuery_AllFilters(t *testing.T) {
 	params := url.Values{
-		"page":        {"2"},
-		"page_size":   {"5"},
-		"name":        {"A"},
-		"surname":     {"B"},
-		"min_age":     {"10"},
-		"max_age":     {"20"},
-		"gender":      {"male"},
-		"nationality": {"US"},
+		"page":            {"2"},
+		"page_size":       {"5"},
+		"name":            {"A"},
+		"surname":         {"B"},
+		"min_age":         {"10"},
+		"max_age":         {"20"},
+		"gender":          {"male"},
+		"nationality":     {"US"},
+		"q":               {" Ivan "},
+		"include_deleted": {"true"},
 	}
 	req := &http.Request{URL: &url.URL{RawQuery: params.Encode()}}
 	q, err := parsePersonQuery(req)
@@ -164,8 +831,30 @@ func TestParsePersonQuery_AllFilters(t *testing.T) {
 	require.Equal(t, "B", *q.Surname)
 	require.Equal(t, 10, *q.MinAge)
 	require.Equal(t, 20, *q.MaxAge)
-	require.Equal(t, "male", *q.Gender)
-	require.Equal(t, "US", *q.Nationality)
+	require.Equal(t, []string{"male"}, q.Genders)
+	require.Equal(t, []string{"US"}, q.Nationalities)
+	require.Equal(t, "Ivan", *q.Search)
+	require.True(t, q.IncludeDeleted)
+}
+
+func TestParsePersonQuery_MultiValueFilters(t *testing.T) {
+	req := &http.Request{URL: &url.URL{RawQuery: "nationality=RU,KZ&nationality=BY&gender=male,female"}}
+	q, err := parsePersonQuery(req)
+	require.NoError(t, err)
+	require.Equal(t, []string{"RU", "KZ", "BY"}, q.Nationalities)
+	require.Equal(t, []string{"male", "female"}, q.Genders)
+}
+
+func TestParsePersonQuery_InvalidGenderAndNationality(t *testing.T) {
+	req := &http.Request{URL: &url.URL{RawQuery: "gender=unknown"}}
+	_, err := parsePersonQuery(req)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "gender must be 'male' or 'female'")
+
+	req = &http.Request{URL: &url.URL{RawQuery: "nationality=RU,kaz"}}
+	_, err = parsePersonQuery(req)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "nationality must be a 2-letter country code")
 }
 
 func TestParsePersonQuery_InvalidPage(t *testing.T) {
@@ -174,6 +863,52 @@ func TestParsePersonQuery_InvalidPage(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestParsePersonQuery_Cursor(t *testing.T) {
+	req := &http.Request{URL: &url.URL{RawQuery: "cursor=abc&include_total=false"}}
+	q, err := parsePersonQuery(req)
+	require.NoError(t, err)
+	require.Equal(t, "abc", *q.Cursor)
+	require.Equal(t, 0, q.Page)
+	require.True(t, q.SkipTotal)
+
+	req = &http.Request{URL: &url.URL{RawQuery: "cursor=abc&page=2"}}
+	_, err = parsePersonQuery(req)
+	require.Error(t, err)
+}
+
+func TestParsePersonQuery_Sort(t *testing.T) {
+	req := &http.Request{URL: &url.URL{RawQuery: "sort=-age:nulls_last,surname,+name:nulls_first"}}
+	q, err := parsePersonQuery(req)
+	require.NoError(t, err)
+	last, first := false, true
+	require.Equal(t, []model.SortField{
+		{Field: "age", Desc: true, NullsFirst: &last},
+		{Field: "surname"},
+		{Field: "name", NullsFirst: &first},
+	}, q.Sort)
+
+	req = &http.Request{URL: &url.URL{RawQuery: "sort=age:sideways"}}
+	_, err = parsePersonQuery(req)
+	require.Error(t, err)
+
+	req = &http.Request{URL: &url.URL{RawQuery: "sort=-"}}
+	_, err = parsePersonQuery(req)
+	require.Error(t, err)
+}
+
+func TestHandleList_InvalidCursor(t *testing.T) {
+	svc := new(MockPersonService)
+	svc.On("ListPersons", mock.Anything, mock.Anything).
+		Return(model.PagedPersons{}, fmt.Errorf("%w: malformed cursor", personsvc.ErrInvalidQuery))
+
+	req := httptest.NewRequest(http.MethodGet, "/persons?cursor=zzz", nil)
+	w := httptest.NewRecorder()
+	setupRouter(svc).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	svc.AssertExpectations(t)
+}
+
 func TestParsePersonQuery_InvalidMinAge(t *testing.T) {
 	req := &http.Request{URL: &url.URL{RawQuery: "min_age=-1"}}
 	_, err := parsePersonQuery(req)
@@ -196,22 +931,23 @@ func TestCreatePersonRequest_Validate(t *testing.T) {
 }
 
 func TestUpdatePersonRequest_Validate(t *testing.T) {
-	req := UpdatePersonRequest{Gender: ptr("female")}
+	req := UpdatePersonRequest{Name: "Anna", Surname: "Petrova", Gender: ptr("female")}
 	require.NoError(t, req.Validate())
+	require.Error(t, UpdatePersonRequest{Gender: ptr("female")}.Validate())
 
-	req2 := UpdatePersonRequest{Gender: ptr("unknown")}
+	req2 := UpdatePersonRequest{Name: "Anna", Surname: "Petrova", Gender: ptr("unknown")}
 	err := req2.Validate()
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "gender must be 'male' or 'female'")
 
 	neg := -5
-	req3 := UpdatePersonRequest{Age: &neg}
+	req3 := UpdatePersonRequest{Name: "Anna", Surname: "Petrova", Age: &neg}
 	err = req3.Validate()
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "age must be non-negative")
 
 	code := "XYZ"
-	req4 := UpdatePersonRequest{Nationality: &code}
+	req4 := UpdatePersonRequest{Name: "Anna", Surname: "Petrova", Nationality: &code}
 	err = req4.Validate()
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "nationality must be a 2-letter country code")
@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"person-api/internal/model"
+	"person-api/internal/services/person"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// replayedHeader отмечает ответ, повторённый из сохранённого.
+	replayedHeader       = "Idempotent-Replayed"
+	maxIdempotencyKeyLen = 255
+	// maxIdempotentBody — тело читается целиком, чтобы посчитать отпечаток запроса.
+	maxIdempotentBody = 1 << 20
+)
+
+// idempotentHeaders — заголовки ответа, которые сохраняются вместе с ним.
+var idempotentHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// idempotent выполняет запрос с заголовком Idempotency-Key один раз: ответ
+// сохраняется, и повтор с тем же ключом и телом получает его без выполнения
+// запроса. Тот же ключ с другим запросом — 422, пока первый запрос
+// выполняется — 409; ключ, ответ для которого так и не сохранили, сервис
+// через некоторое время отдаёт повтору. Ответы 5xx не сохраняются: такой
+// запрос можно повторить.
+func idempotent(svc person.Service) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLen {
+				respondError(w, r, http.StatusBadRequest, codeBadRequest,
+					fmt.Sprintf("Idempotency-Key must not exceed %d characters", maxIdempotencyKeyLen))
+				return
+			}
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBody))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					respondError(w, r, http.StatusRequestEntityTooLarge, codeInvalidPayload,
+						fmt.Sprintf("request body must not exceed %d MB", maxIdempotentBody>>20))
+					return
+				}
+				respondError(w, r, http.StatusBadRequest, codeInvalidPayload, "cannot read request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			fp := requestFingerprint(r, body)
+			rec, claimed, err := svc.ClaimIdempotencyKey(r.Context(), key, fp)
+			if err != nil {
+				respondServiceError(w, r, err, "cannot check Idempotency-Key")
+				return
+			}
+			if !claimed {
+				switch {
+				case rec.Fingerprint != fp:
+					respondError(w, r, http.StatusUnprocessableEntity, codeIdempotencyKeyReused,
+						"Idempotency-Key has already been used with a different request")
+				case rec.Status == 0:
+					respondError(w, r, http.StatusConflict, codeConflict,
+						"request with this Idempotency-Key is still in progress")
+				default:
+					replay(w, rec)
+				}
+				return
+			}
+
+			// ключ освобождается и при панике обработчика; контекст запроса
+			// к этому моменту может быть уже отменён
+			ctx := context.WithoutCancel(r.Context())
+			// если ключ займут заново по истечении аренды, ответ этого запроса
+			// не сохранится и ключ нового владельца не освободится
+			claim := rec.Claim
+			rw := &recordingWriter{ResponseWriter: w}
+			saved := false
+			defer func() {
+				if !saved {
+					_ = svc.ReleaseIdempotencyKey(ctx, key, claim)
+				}
+			}()
+			next.ServeHTTP(rw, r)
+
+			if rw.status == 0 || rw.status >= http.StatusInternalServerError {
+				return
+			}
+			rec = model.IdempotencyRecord{Status: rw.status, Header: map[string]string{}, Body: rw.body.Bytes(), Claim: claim}
+			for _, h := range idempotentHeaders {
+				if v := w.Header().Get(h); v != "" {
+					rec.Header[h] = v
+				}
+			}
+			// ответ уже отправлен; если сохранить его не удалось, ключ
+			// освобождается, и повтор выполнит запрос заново
+			saved = svc.CompleteIdempotencyKey(ctx, key, rec) == nil
+		})
+	}
+}
+
+// requestFingerprint — хеш метода, пути и тела. JSON-тело приводится к
+// каноническому виду, чтобы пробелы и порядок полей не меняли отпечаток.
+func requestFingerprint(r *http.Request, body []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err == nil {
+		if b, err := json.Marshal(v); err == nil {
+			body = b
+		}
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", r.Method, r.URL.Path)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, rec model.IdempotencyRecord) {
+	for k, v := range rec.Header {
+		w.Header().Set(k, v)
+	}
+	w.Header().Set(replayedHeader, "true")
+	w.WriteHeader(rec.Status)
+	_, _ = w.Write(rec.Body)
+}
+
+// recordingWriter запоминает статус и тело ответа, передавая их клиенту.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// Unwrap нужен http.ResponseController.
+func (rw *recordingWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"person-api/internal/model"
+)
+
+const (
+	maxImportBytes = 32 << 20
+	maxImportRows  = 100_000
+	// importSyncRows — файлы не длиннее этого обрабатываются прямо в запросе,
+	// длиннее — фоновой задачей.
+	importSyncRows = 100
+	// importReadTimeout заменяет общий ReadTimeout сервера на время загрузки файла.
+	importReadTimeout = 5 * time.Minute
+)
+
+// parseImportOptions читает dry_run, enrich (по умолчанию true) и allow_duplicates.
+func parseImportOptions(r *http.Request) (model.ImportOptions, error) {
+	opts := model.ImportOptions{Enrich: true}
+	for name, dst := range map[string]*bool{
+		"dry_run":          &opts.DryRun,
+		"enrich":           &opts.Enrich,
+		"allow_duplicates": &opts.AllowDuplicates,
+	} {
+		if v := r.URL.Query().Get(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return opts, fmt.Errorf("invalid %s parameter", name)
+			}
+			*dst = b
+		}
+	}
+	return opts, nil
+}
+
+// readImport читает строки из тела запроса или из поля file формы multipart.
+// Формат задаёт параметр format, иначе он определяется по типу содержимого
+// или расширению файла.
+func readImport(r *http.Request) ([]model.ImportRow, error) {
+	format := r.URL.Query().Get("format")
+	body := io.Reader(r.Body)
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mt == "multipart/form-data" {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			return nil, err
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return nil, errors.New("form has no file field")
+			}
+			if err != nil {
+				return nil, err
+			}
+			if part.FormName() == "file" {
+				body = part
+				if format == "" {
+					format = strings.TrimPrefix(path.Ext(part.FileName()), ".")
+				}
+				mt, _, _ = mime.ParseMediaType(part.Header.Get("Content-Type"))
+				break
+			}
+		}
+	}
+	if format == "" {
+		switch mt {
+		case "text/csv":
+			format = exportCSV
+		case "application/x-ndjson", "application/jsonl":
+			format = exportNDJSON
+		}
+	}
+
+	var rows []model.ImportRow
+	var err error
+	switch format {
+	case exportCSV:
+		rows, err = readCSVImport(body)
+	case exportNDJSON, "jsonl":
+		rows, err = readNDJSONImport(body)
+	default:
+		return nil, errors.New("format must be csv or ndjson")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("file has no rows")
+	}
+	return rows, nil
+}
+
+// readCSVImport ожидает строку заголовка с колонками name и surname;
+// patronymic необязательна, остальные колонки (например, из выгрузки) пропускаются.
+func readCSVImport(rd io.Reader) ([]model.ImportRow, error) {
+	cr := csv.NewReader(rd)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cols := make(map[string]int, len(header))
+	for i, h := range header {
+		cols[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+	}
+	if _, ok := cols["name"]; !ok {
+		return nil, errors.New("CSV header must contain name and surname columns")
+	}
+	if _, ok := cols["surname"]; !ok {
+		return nil, errors.New("CSV header must contain name and surname columns")
+	}
+
+	var rows []model.ImportRow
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == maxImportRows {
+			return nil, fmt.Errorf("file has more than %d rows", maxImportRows)
+		}
+		field := func(name string) string {
+			if i, ok := cols[name]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		req := CreatePersonRequest{Name: field("name"), Surname: field("surname")}
+		if p := field("patronymic"); p != "" {
+			req.Patronymic = &p
+		}
+		line, _ := cr.FieldPos(0)
+		rows = append(rows, importRow(line, req))
+	}
+}
+
+// readNDJSONImport читает по объекту CreatePersonRequest в строке; пустые строки пропускаются.
+func readNDJSONImport(rd io.Reader) ([]model.ImportRow, error) {
+	sc := bufio.NewScanner(rd)
+	sc.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	var rows []model.ImportRow
+	for line := 1; sc.Scan(); line++ {
+		text := bytes.TrimSpace(sc.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		if len(rows) == maxImportRows {
+			return nil, fmt.Errorf("file has more than %d rows", maxImportRows)
+		}
+		var req CreatePersonRequest
+		if err := json.Unmarshal(text, &req); err != nil {
+			rows = append(rows, model.ImportRow{Line: line, Errors: map[string]string{"row": "invalid JSON object"}})
+			continue
+		}
+		rows = append(rows, importRow(line, req))
+	}
+	return rows, sc.Err()
+}
+
+// importRow проверяет строку так же, как тело POST /persons.
+func importRow(line int, req CreatePersonRequest) model.ImportRow {
+	row := model.ImportRow{
+		Line: line,
+		Cmd:  model.CreatePersonCommand{Name: req.Name, Surname: req.Surname, Patronymic: req.Patronymic},
+	}
+	if err := req.Validate(); err != nil {
+		p := validationProblem(err)
+		row.Errors = p.Errors
+		if len(row.Errors) == 0 {
+			row.Errors = map[string]string{"row": p.Detail}
+		}
+	}
+	return row
+}
+
+func importReportResponse(rep model.ImportReport) ImportReportResponse {
+	out := ImportReportResponse{
+		DryRun:     rep.DryRun,
+		Total:      rep.Total,
+		Valid:      rep.Valid,
+		Invalid:    rep.Invalid,
+		Duplicates: rep.Duplicates,
+		Created:    rep.Created,
+		Failed:     rep.Failed,
+		Rows:       make([]ImportRowResult, len(rep.Rows)),
+	}
+	for i, r := range rep.Rows {
+		out.Rows[i] = ImportRowResult{
+			Line:            r.Line,
+			Status:          r.Status,
+			Errors:          r.Errors,
+			PersonID:        r.PersonID,
+			DuplicateOfID:   r.DuplicateOfID,
+			DuplicateOfLine: r.DuplicateOfLine,
+		}
+		if r.Err != nil {
+			p := serviceProblem(r.Err, "could not create person")
+			out.Rows[i].Error = &p
+		}
+	}
+	return out
+}
+
+func importJobResponse(job model.ImportJob) ImportJobResponse {
+	out := ImportJobResponse{
+		ID:         job.ID,
+		Status:     job.Status,
+		Total:      job.Total,
+		Processed:  job.Processed,
+		CreatedAt:  job.CreatedAt,
+		FinishedAt: job.FinishedAt,
+	}
+	if job.Report != nil {
+		rep := importReportResponse(*job.Report)
+		out.Report = &rep
+	}
+	if job.Err != nil {
+		p := serviceProblem(job.Err, "import failed")
+		out.Error = &p
+	}
+	return out
+}
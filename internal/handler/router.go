@@ -16,6 +16,8 @@ func NewRouter(svc person.Service) http.Handler {
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	r.NotFound(notFound)
+	r.MethodNotAllowed(methodNotAllowed)
 
 	// swagger
 	r.Get("/swagger/*", httpSwagger.Handler(
@@ -25,13 +27,23 @@ func NewRouter(svc person.Service) http.Handler {
 	// CRUD /persons
 	r.Route("/persons", func(r chi.Router) {
 		r.Get("/", handleList(svc))
-		r.Post("/", handleCreate(svc))
+		r.With(idempotent(svc)).Post("/", handleCreate(svc))
+		r.Post("/batch", handleCreateBatch(svc))
+		r.Get("/export", handleExport(svc))
+		r.Post("/import", handleImport(svc))
+		r.Get("/import/{jobID}", handleImportJob(svc))
 		r.Route("/{id}", func(r chi.Router) {
 			r.Get("/", handleGetByID(svc))
 			r.Put("/", handleUpdate(svc))
+			r.Patch("/", handlePatch(svc))
 			r.Delete("/", handleDelete(svc))
+			r.Post("/restore", handleRestore(svc))
+			r.Get("/history", handleHistory(svc))
 		})
 	})
 
+	r.Get("/enrichment/cache", handleCacheStats(svc))
+	r.Get("/enrichment/queue", handleQueueStats(svc))
+
 	return r
 }
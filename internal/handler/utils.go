@@ -3,21 +3,48 @@ package handler
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"person-api/internal/model"
 	"strconv"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
 )
 
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, status, data)
+}
+
+// writeJSON пишет тело с уже выставленным Content-Type.
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(data); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
-func respondError(w http.ResponseWriter, status int, message string) {
-	respondJSON(w, status, map[string]string{"error": message})
+// setETag выставляет ETag по версии записи.
+func setETag(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, version))
+}
+
+// parseIfMatch читает ожидаемую версию из If-Match. nil — заголовка нет или он равен "*".
+func parseIfMatch(r *http.Request) (*int64, error) {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "" || v == "*" {
+		return nil, nil
+	}
+	v = strings.TrimPrefix(v, "W/")
+	if len(v) < 2 || v[0] != '"' || v[len(v)-1] != '"' {
+		return nil, errors.New("invalid If-Match header")
+	}
+	version, err := strconv.ParseInt(v[1:len(v)-1], 10, 64)
+	if err != nil || version < 1 {
+		return nil, errors.New("invalid If-Match header")
+	}
+	return &version, nil
 }
 
 func parsePersonQuery(r *http.Request) (model.PersonQuery, error) {
@@ -36,12 +63,45 @@ func parsePersonQuery(r *http.Request) (model.PersonQuery, error) {
 			return q, errors.New("invalid page_size parameter")
 		}
 	}
+	if r.URL.Query().Has("cursor") {
+		if r.URL.Query().Has("page") {
+			return q, errors.New("page and cursor cannot be used together")
+		}
+		v := r.URL.Query().Get("cursor")
+		if v == "" {
+			return q, errors.New("invalid cursor parameter")
+		}
+		q.Cursor = &v
+		q.Page = 0
+	}
+	if v := splitList(r.URL.Query()["sort"]); len(v) > 0 {
+		q.Sort, err = parseSort(v)
+		if err != nil {
+			return q, err
+		}
+	}
+	if v := r.URL.Query().Get("include_total"); v != "" {
+		include, err2 := strconv.ParseBool(v)
+		if err2 != nil {
+			return q, errors.New("invalid include_total parameter")
+		}
+		q.SkipTotal = !include
+	}
+	if v := r.URL.Query().Get("include_deleted"); v != "" {
+		q.IncludeDeleted, err = strconv.ParseBool(v)
+		if err != nil {
+			return q, errors.New("invalid include_deleted parameter")
+		}
+	}
 	if v := r.URL.Query().Get("name"); v != "" {
 		q.Name = &v
 	}
 	if v := r.URL.Query().Get("surname"); v != "" {
 		q.Surname = &v
 	}
+	if v := strings.TrimSpace(r.URL.Query().Get("q")); v != "" {
+		q.Search = &v
+	}
 	if v := r.URL.Query().Get("min_age"); v != "" {
 		x, err2 := strconv.Atoi(v)
 		if err2 != nil || x < 0 {
@@ -56,11 +116,70 @@ func parsePersonQuery(r *http.Request) (model.PersonQuery, error) {
 		}
 		q.MaxAge = &x
 	}
-	if v := r.URL.Query().Get("gender"); v != "" {
-		q.Gender = &v
+	if v := splitList(r.URL.Query()["gender"]); len(v) > 0 {
+		for _, g := range v {
+			if err2 := validation.Validate(g, genderRule); err2 != nil {
+				return q, fmt.Errorf("invalid gender parameter: %w", err2)
+			}
+		}
+		q.Genders = v
 	}
-	if v := r.URL.Query().Get("nationality"); v != "" {
-		q.Nationality = &v
+	if v := splitList(r.URL.Query()["nationality"]); len(v) > 0 {
+		for _, n := range v {
+			if err2 := validation.Validate(n, nationalityRule); err2 != nil {
+				return q, fmt.Errorf("invalid nationality parameter: %w", err2)
+			}
+		}
+		q.Nationalities = v
 	}
 	return q, nil
 }
+
+// parseSort разбирает поля вида "-age", "surname:nulls_first".
+// Допустимость самих полей проверяет сервис.
+func parseSort(fields []string) ([]model.SortField, error) {
+	out := make([]model.SortField, 0, len(fields))
+	for _, f := range fields {
+		var sf model.SortField
+		name, nulls, hasNulls := strings.Cut(f, ":")
+		if strings.HasPrefix(name, "-") {
+			sf.Desc = true
+			name = name[1:]
+		} else {
+			name = strings.TrimPrefix(name, "+")
+		}
+		if name == "" {
+			return nil, errors.New("invalid sort parameter")
+		}
+		sf.Field = name
+		if hasNulls {
+			switch nulls {
+			case "nulls_first":
+				sf.NullsFirst = boolPtr(true)
+			case "nulls_last":
+				sf.NullsFirst = boolPtr(false)
+			default:
+				return nil, fmt.Errorf("invalid sort parameter: unknown modifier %q", nulls)
+			}
+		}
+		out = append(out, sf)
+	}
+	return out, nil
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// splitList собирает значения вида ?x=a,b&x=c в один срез, пропуская пустые.
+func splitList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
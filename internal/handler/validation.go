@@ -11,6 +11,10 @@ var (
 	letterRegex = regexp.MustCompile(`^[A-Za-zА-Яа-яЁё]+$`)
 	// для nationality — двухбуквенный код страны в верхнем регистре
 	nationalityRegex = regexp.MustCompile(`^[A-Z]{2}$`)
+
+	// общие правила для тела запроса и фильтров списка
+	genderRule      = validation.In("male", "female").Error("gender must be 'male' or 'female'")
+	nationalityRule = validation.Match(nationalityRegex).Error("nationality must be a 2-letter country code")
 )
 
 // Validate implements validation for CreatePersonRequest.
@@ -33,41 +37,65 @@ func (r CreatePersonRequest) Validate() error {
 // Validate implements validation for UpdatePersonRequest.
 func (r UpdatePersonRequest) Validate() error {
 	return validation.ValidateStruct(&r,
-		// имя
 		validation.Field(&r.Name,
-			validation.When(r.Name != nil,
-				validation.Match(letterRegex).Error("name must contain only letters"),
-			),
+			validation.Required.Error("name is required"),
+			validation.Match(letterRegex).Error("name must contain only letters"),
 		),
-		// фамилия
 		validation.Field(&r.Surname,
-			validation.When(r.Surname != nil,
-				validation.Match(letterRegex).Error("surname must contain only letters"),
-			),
+			validation.Required.Error("surname is required"),
+			validation.Match(letterRegex).Error("surname must contain only letters"),
 		),
-		// отчество
 		validation.Field(&r.Patronymic,
 			validation.When(r.Patronymic != nil,
 				validation.Match(letterRegex).Error("patronymic must contain only letters"),
 			),
 		),
-		// возраст
 		validation.Field(&r.Age,
 			validation.When(r.Age != nil,
 				validation.Min(0).Error("age must be non-negative"),
 			),
 		),
-		// пол
 		validation.Field(&r.Gender,
-			validation.When(r.Gender != nil,
-				validation.In("male", "female").Error("gender must be 'male' or 'female'"),
-			),
+			validation.When(r.Gender != nil, genderRule),
 		),
-		// национальность
 		validation.Field(&r.Nationality,
-			validation.When(r.Nationality != nil,
-				validation.Match(nationalityRegex).Error("nationality must be a 2-letter country code"),
-			),
+			validation.When(r.Nationality != nil, nationalityRule),
 		),
 	)
 }
+
+// Validate implements validation for PatchPersonRequest. ValidateStruct не
+// видит значения внутри Optional, поэтому поля проверяются по отдельности.
+func (r PatchPersonRequest) Validate() error {
+	errs := validation.Errors{}
+	// имя и фамилию можно заменить, но не очистить
+	if r.Name.Set {
+		errs["name"] = validation.Validate(r.Name.Value,
+			validation.NotNil.Error("name cannot be null"),
+			validation.Required.Error("name is required"),
+			validation.Match(letterRegex).Error("name must contain only letters"),
+		)
+	}
+	if r.Surname.Set {
+		errs["surname"] = validation.Validate(r.Surname.Value,
+			validation.NotNil.Error("surname cannot be null"),
+			validation.Required.Error("surname is required"),
+			validation.Match(letterRegex).Error("surname must contain only letters"),
+		)
+	}
+	if r.Patronymic.Set {
+		errs["patronymic"] = validation.Validate(r.Patronymic.Value,
+			validation.Match(letterRegex).Error("patronymic must contain only letters"),
+		)
+	}
+	if r.Age.Set {
+		errs["age"] = validation.Validate(r.Age.Value, validation.Min(0).Error("age must be non-negative"))
+	}
+	if r.Gender.Set {
+		errs["gender"] = validation.Validate(r.Gender.Value, genderRule)
+	}
+	if r.Nationality.Set {
+		errs["nationality"] = validation.Validate(r.Nationality.Value, nationalityRule)
+	}
+	return errs.Filter()
+}
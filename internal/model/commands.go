@@ -6,11 +6,19 @@ type CreatePersonCommand struct {
 	Patronymic *string
 }
 
+// UpdatePersonCommand описывает изменение записи: незаданное поле остаётся
+// как есть, null очищает его. PUT задаёт все поля, PATCH — только переданные.
 type UpdatePersonCommand struct {
-	Name        *string
-	Surname     *string
-	Patronymic  *string
-	Age         *int
-	Gender      *string
-	Nationality *string
+	Name        Optional[string]
+	Surname     Optional[string]
+	Patronymic  Optional[string]
+	Age         Optional[int]
+	Gender      Optional[string]
+	Nationality Optional[string]
+	// ExpectedVersion из If-Match; nil — без проверки версии.
+	ExpectedVersion *int64
+}
+
+type DeletePersonCommand struct {
+	ExpectedVersion *int64
 }
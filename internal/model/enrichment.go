@@ -0,0 +1,63 @@
+package model
+
+import "time"
+
+// Статусы обогащения атрибута.
+const (
+	// EnrichmentComplete — провайдеры ответили; значения нет, если имя им неизвестно.
+	EnrichmentComplete = "complete"
+	// EnrichmentPending — значение ещё запрашивается: запись ждёт в очереди
+	// обогащения или предыдущая попытка не удалась и назначен повтор на RetryAt.
+	EnrichmentPending = "pending"
+	// EnrichmentFailed — попытки исчерпаны, атрибут больше не запрашивается.
+	EnrichmentFailed = "failed"
+)
+
+// AttributeSource — откуда получен атрибут при обогащении и насколько он надёжен.
+type AttributeSource struct {
+	Status   string
+	Provider string
+	// Probability — уверенность провайдера от 0 до 1; nil — провайдер её не сообщает.
+	Probability *float64
+	// Count — по скольким записям провайдер сделал вывод.
+	Count *int
+	// Candidates — все варианты по убыванию вероятности (для nationality).
+	Candidates []Candidate
+	// Error — последняя ошибка провайдеров для pending и failed.
+	Error string
+	// Attempts — сколько раз подряд атрибут не удалось получить.
+	Attempts int
+	RetryAt  *time.Time
+}
+
+type Candidate struct {
+	Value       string
+	Probability float64
+}
+
+// CacheStats — статистика кеша ответов провайдеров обогащения с запуска сервиса.
+type CacheStats struct {
+	Enabled bool
+	// Entries — записей в памяти процесса, Capacity — их предел.
+	Entries  int
+	Capacity int
+	// MemoryHits и StoreHits — ответы из памяти и из базы; NegativeHits — те
+	// из них, где провайдер не знает имя.
+	MemoryHits   int64
+	StoreHits    int64
+	NegativeHits int64
+	// Misses — запросы, ушедшие к провайдеру.
+	Misses int64
+	// StoreErrors — неудачные чтения и записи кеша в базе.
+	StoreErrors int64
+}
+
+// QueueStats — состояние очереди асинхронного обогащения.
+type QueueStats struct {
+	Queued  int64
+	Running int64
+	// Dead — задания, для которых исчерпаны попытки.
+	Dead int64
+	// OldestQueued — когда создано самое старое ожидающее задание.
+	OldestQueued *time.Time
+}
@@ -0,0 +1,14 @@
+package model
+
+type FieldChange struct {
+	Old interface{}
+	New interface{}
+}
+
+type HistoryEntry struct {
+	ID        int64
+	PersonID  int64
+	Action    string
+	Changes   map[string]FieldChange
+	ChangedAt string
+}
@@ -0,0 +1,14 @@
+package model
+
+// IdempotencyRecord — сохранённый ответ на запрос с заголовком Idempotency-Key.
+type IdempotencyRecord struct {
+	// Fingerprint — хеш первого запроса с этим ключом.
+	Fingerprint string
+	// Status == 0 — первый запрос ещё выполняется.
+	Status int
+	Header map[string]string
+	Body   []byte
+	// Claim — номер захвата ключа: сохранить ответ и освободить ключ может
+	// только запрос, занявший его последним.
+	Claim int64
+}
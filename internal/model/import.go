@@ -0,0 +1,70 @@
+package model
+
+// Статусы строки импорта.
+const (
+	ImportValid     = "valid"     // прошла проверку (dry run)
+	ImportInvalid   = "invalid"   // не прошла проверку, подробности в Errors
+	ImportDuplicate = "duplicate" // похожа на существующую запись или строку выше
+	ImportCreated   = "created"
+	ImportFailed    = "failed" // не удалось обогатить или сохранить, причина в Err
+)
+
+// Статусы фонового импорта.
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// ImportRow — строка файла импорта после проверки.
+type ImportRow struct {
+	// Line — номер строки в файле, с единицы.
+	Line int
+	Cmd  CreatePersonCommand
+	// Errors — ошибки проверки по полям; непустые — строка не импортируется.
+	Errors map[string]string
+}
+
+type ImportOptions struct {
+	// DryRun только проверяет строки, ничего не записывая.
+	DryRun bool
+	Enrich bool
+	// AllowDuplicates создаёт и строки, похожие на существующие записи.
+	AllowDuplicates bool
+}
+
+type ImportRowResult struct {
+	Line   int
+	Status string
+	Errors map[string]string
+	Err    error
+	// PersonID — созданная запись.
+	PersonID int64
+	// DuplicateOfID или DuplicateOfLine — на что похожа строка.
+	DuplicateOfID   int64
+	DuplicateOfLine int
+}
+
+type ImportReport struct {
+	DryRun     bool
+	Total      int
+	Valid      int
+	Invalid    int
+	Duplicates int
+	Created    int
+	Failed     int
+	Rows       []ImportRowResult
+}
+
+type ImportJob struct {
+	ID         string
+	Status     string
+	Total      int
+	Processed  int
+	CreatedAt  string
+	FinishedAt *string
+	// Report заполняется, когда задача завершена.
+	Report *ImportReport
+	Err    error
+}
@@ -0,0 +1,46 @@
+package model
+
+import "encoding/json"
+
+// Optional различает три состояния поля: не передано (Set=false),
+// передан null (Set=true, Value=nil) и передано значение.
+// Нужен для PATCH, где null очищает поле, а отсутствие поля его не меняет.
+type Optional[T any] struct {
+	Set   bool
+	Value *T
+}
+
+// Some возвращает заданное значение.
+func Some[T any](v T) Optional[T] {
+	return Optional[T]{Set: true, Value: &v}
+}
+
+// Null возвращает явно очищенное значение.
+func Null[T any]() Optional[T] {
+	return Optional[T]{Set: true}
+}
+
+// OptionalOf переводит указатель в заданное значение: nil становится null.
+func OptionalOf[T any](v *T) Optional[T] {
+	return Optional[T]{Set: true, Value: v}
+}
+
+// UnmarshalJSON вызывается только для присутствующих в JSON полей.
+func (o *Optional[T]) UnmarshalJSON(b []byte) error {
+	o.Set = true
+	if string(b) == "null" {
+		o.Value = nil
+		return nil
+	}
+	var v T
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	o.Value = &v
+	return nil
+}
+
+// MarshalJSON пишет значение или null; пропуск незаданных полей — забота вызывающего.
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.Value)
+}
@@ -1,12 +1,27 @@
 package model
 
 type PersonQuery struct {
-	Name        *string
-	Surname     *string
-	Gender      *string
-	Nationality *string
-	MinAge      *int
-	MaxAge      *int
-	Page        int
-	PageSize    int
+	Name          *string
+	Surname       *string
+	Genders       []string
+	Nationalities []string
+	MinAge        *int
+	MaxAge        *int
+	// Search — нечёткий поиск по ФИО; без явной сортировки результаты идут по релевантности.
+	Search   *string
+	Sort     []SortField
+	Page     int
+	PageSize int
+	// Cursor — непрозрачный курсор из next_cursor; при нём Page не используется.
+	Cursor         *string
+	SkipTotal      bool
+	IncludeDeleted bool
+}
+
+// SortField — поле сортировки из ?sort=-age,surname:nulls_first.
+type SortField struct {
+	Field string
+	Desc  bool
+	// NullsFirst == nil — положение NULL по умолчанию: последними для ASC, первыми для DESC.
+	NullsFirst *bool
 }
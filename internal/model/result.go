@@ -9,11 +9,23 @@ type Person struct {
 	Gender      *string
 	Nationality *string
 	CreatedAt   string
+	DeletedAt   *string
+	Version     int64
+	Score       *float64
+	// Enrichment — как получены обогащённые атрибуты; ключ — атрибут.
+	Enrichment map[string]AttributeSource
+}
+
+// CreateResult — итог создания одной записи пакета: Person при успехе, иначе Err.
+type CreateResult struct {
+	Person Person
+	Err    error
 }
 
 type PagedPersons struct {
-	Persons  []Person
-	Total    int
-	Page     int
-	PageSize int
+	Persons    []Person
+	Total      *int
+	Page       int
+	PageSize   int
+	NextCursor string
 }
@@ -0,0 +1,369 @@
+package enrichment
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"person-api/internal/model"
+	"person-api/internal/storage"
+)
+
+// CacheStore хранит кеш между перезапусками; его реализует storage.Storage.
+type CacheStore interface {
+	GetEnrichmentCache(ctx context.Context, key string) (storage.EnrichmentCacheEntry, error)
+	PutEnrichmentCache(ctx context.Context, e storage.EnrichmentCacheEntry) error
+}
+
+type CacheConfig struct {
+	// Size — сколько ответов держать в памяти процесса.
+	Size int
+	// TTL — срок ответа с найденным значением, NegativeTTL — ответа
+	// «имя неизвестно».
+	TTL         time.Duration
+	NegativeTTL time.Duration
+}
+
+// Cache запоминает ответы провайдеров по нормализованному имени: сначала
+// в LRU в памяти, затем в store. Ошибки провайдеров не кешируются, ошибки
+// store только учитываются в статистике.
+type Cache struct {
+	cfg   CacheConfig
+	store CacheStore
+	lru   *lru
+
+	mu       sync.Mutex
+	inflight map[string]*lookupCall
+
+	memoryHits, storeHits, negativeHits, misses, storeErrors atomic.Int64
+}
+
+// lookupCall — запрос к провайдеру, которого ждут одновременные Lookup того же имени.
+type lookupCall struct {
+	done chan struct{}
+	res  Result
+	err  error
+}
+
+// NewCache создаёт кеш; store == nil — только память процесса.
+func NewCache(cfg CacheConfig, store CacheStore) *Cache {
+	return &Cache{cfg: cfg, store: store, lru: newLRU(cfg.Size), inflight: make(map[string]*lookupCall)}
+}
+
+// Wrap возвращает провайдер, который обращается к p только при промахе кеша.
+func (c *Cache) Wrap(p Provider) Provider {
+	return &cachedProvider{Provider: p, cache: c}
+}
+
+func (c *Cache) Stats() model.CacheStats {
+	return model.CacheStats{
+		Enabled:      true,
+		Entries:      c.lru.len(),
+		Capacity:     c.cfg.Size,
+		MemoryHits:   c.memoryHits.Load(),
+		StoreHits:    c.storeHits.Load(),
+		NegativeHits: c.negativeHits.Load(),
+		Misses:       c.misses.Load(),
+		StoreErrors:  c.storeErrors.Load(),
+	}
+}
+
+type cachedProvider struct {
+	Provider
+	cache *Cache
+}
+
+func (p *cachedProvider) Lookup(ctx context.Context, name string) (Result, error) {
+	return p.cache.lookup(ctx, p.Provider, name)
+}
+
+// BatchSize — у провайдера без пакетных запросов 1.
+func (p *cachedProvider) BatchSize() int {
+	if bp, ok := p.Provider.(BatchProvider); ok {
+		return bp.BatchSize()
+	}
+	return 1
+}
+
+// LookupBatch отправляет провайдеру одним запросом только промахи кеша.
+func (p *cachedProvider) LookupBatch(ctx context.Context, names []string) []BatchResult {
+	return p.cache.lookupBatch(ctx, p.Provider, names)
+}
+
+func (c *Cache) lookup(ctx context.Context, p Provider, name string) (Result, error) {
+	key := cacheKey(p, name)
+	now := time.Now()
+	if r, ok := c.lru.get(key, now); ok {
+		c.hit(&c.memoryHits, r)
+		return r, nil
+	}
+	// одновременные запросы одного имени (пакет из тысячи «Ivan») ждут первый
+	call, owner := c.claim(key)
+	if !owner {
+		return call.wait(ctx)
+	}
+	defer c.release(key, call)
+	if r, ok := c.stored(ctx, p, key, now); ok {
+		call.res = r
+		return r, nil
+	}
+	c.misses.Add(1)
+	call.res, call.err = p.Lookup(ctx, name)
+	if call.err == nil {
+		c.save(ctx, key, call.res)
+	}
+	return call.res, call.err
+}
+
+func (c *Cache) lookupBatch(ctx context.Context, p Provider, names []string) []BatchResult {
+	out := make([]BatchResult, len(names))
+	now := time.Now()
+	calls := make([]*lookupCall, len(names))
+	var misses []string
+	var missKeys []string
+	var missCalls []*lookupCall
+	for i, name := range names {
+		key := cacheKey(p, name)
+		if r, ok := c.lru.get(key, now); ok {
+			c.hit(&c.memoryHits, r)
+			out[i].Result = r
+			continue
+		}
+		call, owner := c.claim(key)
+		calls[i] = call
+		if !owner {
+			continue
+		}
+		if r, ok := c.stored(ctx, p, key, now); ok {
+			call.res = r
+			c.release(key, call)
+			continue
+		}
+		misses = append(misses, name)
+		missKeys = append(missKeys, key)
+		missCalls = append(missCalls, call)
+	}
+	if len(misses) > 0 {
+		c.misses.Add(int64(len(misses)))
+		for k, res := range lookupNames(ctx, p, misses) {
+			call := missCalls[k]
+			call.res, call.err = res.Result, res.Err
+			if res.Err == nil {
+				c.save(ctx, missKeys[k], res.Result)
+			}
+			c.release(missKeys[k], call)
+		}
+	}
+	// свои запросы уже завершены: ждём только чужие и повторы имён внутри пакета
+	for i, call := range calls {
+		if call != nil {
+			out[i].Result, out[i].Err = call.wait(ctx)
+		}
+	}
+	return out
+}
+
+// claim возвращает запрос key к провайдеру; owner == false — его уже
+// выполняет другой вызов и результат нужно ждать.
+func (c *Cache) claim(key string) (call *lookupCall, owner bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if call, ok := c.inflight[key]; ok {
+		return call, false
+	}
+	call = &lookupCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	return call, true
+}
+
+// release сообщает ждущим результат call.
+func (c *Cache) release(key string, call *lookupCall) {
+	c.mu.Lock()
+	delete(c.inflight, key)
+	c.mu.Unlock()
+	close(call.done)
+}
+
+func (call *lookupCall) wait(ctx context.Context) (Result, error) {
+	select {
+	case <-call.done:
+		return call.res, call.err
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	}
+}
+
+// stored ищет непросроченный ответ в store и переносит его в память.
+func (c *Cache) stored(ctx context.Context, p Provider, key string, now time.Time) (Result, bool) {
+	if c.store == nil {
+		return Result{}, false
+	}
+	e, err := c.store.GetEnrichmentCache(ctx, key)
+	switch {
+	case err == nil && e.ExpiresAt.After(now):
+		if r, err := decodeResult(p.Attribute(), e.Result); err == nil {
+			c.lru.put(key, r, e.ExpiresAt)
+			c.hit(&c.storeHits, r)
+			return r, true
+		}
+	case err != nil && !errors.Is(err, storage.ErrNotFound):
+		c.storeErrors.Add(1)
+	}
+	return Result{}, false
+}
+
+// save запоминает ответ провайдера в памяти и в store.
+func (c *Cache) save(ctx context.Context, key string, r Result) {
+	ttl := c.cfg.TTL
+	if r.Value == nil {
+		ttl = c.cfg.NegativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	expires := time.Now().Add(ttl)
+	c.lru.put(key, r, expires)
+	if c.store == nil {
+		return
+	}
+	b, err := encodeResult(r)
+	if err == nil {
+		// ответ провайдера уже получен: отмена запроса не должна мешать его сохранить
+		err = c.store.PutEnrichmentCache(context.WithoutCancel(ctx), storage.EnrichmentCacheEntry{Key: key, Result: b, ExpiresAt: expires})
+	}
+	if err != nil {
+		c.storeErrors.Add(1)
+	}
+}
+
+func (c *Cache) hit(counter *atomic.Int64, r Result) {
+	counter.Add(1)
+	if r.Value == nil {
+		c.negativeHits.Add(1)
+	}
+}
+
+// countryHinter — провайдер, ограниченный одной страной (параметр country_id).
+type countryHinter interface {
+	CountryHint() string
+}
+
+// cacheKey — провайдер, страна и имя без учёта регистра и лишних пробелов.
+func cacheKey(p Provider, name string) string {
+	country := ""
+	if h, ok := p.(countryHinter); ok {
+		country = strings.ToUpper(h.CountryHint())
+	}
+	return p.Name() + ":" + country + ":" + strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// cachedResult — Result в формате enrichment_cache.result.
+type cachedResult struct {
+	Value       json.RawMessage     `json:"value"`
+	Probability *float64            `json:"probability,omitempty"`
+	Count       *int                `json:"count,omitempty"`
+	Candidates  []storage.Candidate `json:"candidates,omitempty"`
+}
+
+func encodeResult(r Result) ([]byte, error) {
+	value, err := json.Marshal(r.Value)
+	if err != nil {
+		return nil, err
+	}
+	c := cachedResult{Value: value, Probability: r.Probability, Count: r.Count}
+	for _, cand := range r.Candidates {
+		c.Candidates = append(c.Candidates, storage.Candidate{Value: cand.Value, Probability: cand.Probability})
+	}
+	return json.Marshal(c)
+}
+
+// decodeResult восстанавливает тип Value по атрибуту: JSON его не сохраняет.
+func decodeResult(attr string, b []byte) (Result, error) {
+	var c cachedResult
+	if err := json.Unmarshal(b, &c); err != nil {
+		return Result{}, err
+	}
+	r := Result{Probability: c.Probability, Count: c.Count}
+	for _, cand := range c.Candidates {
+		r.Candidates = append(r.Candidates, model.Candidate{Value: cand.Value, Probability: cand.Probability})
+	}
+	if len(c.Value) == 0 || string(c.Value) == "null" {
+		return r, nil
+	}
+	var err error
+	if attr == AttrAge {
+		var n int
+		err = json.Unmarshal(c.Value, &n)
+		r.Value = n
+	} else {
+		var s string
+		err = json.Unmarshal(c.Value, &s)
+		r.Value = s
+	}
+	return r, err
+}
+
+// lru — ответы провайдеров в памяти; самые давно использованные вытесняются.
+type lru struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	res     Result
+	expires time.Time
+}
+
+func newLRU(size int) *lru {
+	return &lru{size: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (l *lru) get(key string, now time.Time) (Result, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	el, ok := l.items[key]
+	if !ok {
+		return Result{}, false
+	}
+	e := el.Value.(*lruEntry)
+	if !e.expires.After(now) {
+		l.order.Remove(el)
+		delete(l.items, key)
+		return Result{}, false
+	}
+	l.order.MoveToFront(el)
+	return e.res, true
+}
+
+func (l *lru) put(key string, r Result, expires time.Time) {
+	if l.size <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if el, ok := l.items[key]; ok {
+		el.Value = &lruEntry{key: key, res: r, expires: expires}
+		l.order.MoveToFront(el)
+		return
+	}
+	l.items[key] = l.order.PushFront(&lruEntry{key: key, res: r, expires: expires})
+	if l.order.Len() > l.size {
+		last := l.order.Back()
+		l.order.Remove(last)
+		delete(l.items, last.Value.(*lruEntry).key)
+	}
+}
+
+func (l *lru) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
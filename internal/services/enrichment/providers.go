@@ -0,0 +1,273 @@
+package enrichment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"person-api/internal/model"
+)
+
+// ProviderConfig — настройки встроенного провайдера.
+type ProviderConfig struct {
+	Name    string
+	BaseURL string
+	// APIKey передаётся в параметре apikey (платный тариф).
+	APIKey  string
+	Timeout time.Duration
+	Enabled bool
+	// BatchSize — сколько имён отправлять одним запросом (параметры name[]);
+	// 0 или 1 — по одному имени.
+	BatchSize int
+	Retry     RetryConfig
+	Breaker   BreakerConfig
+}
+
+// Providers создаёт включённые провайдеры из cfgs в том же порядке.
+// transport == nil — http.DefaultTransport.
+func Providers(cfgs []ProviderConfig, transport http.RoundTripper) ([]Provider, error) {
+	out := make([]Provider, 0, len(cfgs))
+	seen := make(map[string]bool, len(cfgs))
+	for _, cfg := range cfgs {
+		name := strings.ToLower(strings.TrimSpace(cfg.Name))
+		if seen[name] {
+			return nil, fmt.Errorf("enrichment provider %q is listed twice", name)
+		}
+		seen[name] = true
+		src := httpSource{
+			client:    &http.Client{Transport: transport, Timeout: cfg.Timeout},
+			baseURL:   cfg.BaseURL,
+			apiKey:    cfg.APIKey,
+			batchSize: max(cfg.BatchSize, 1),
+			retry:     cfg.Retry,
+			breaker:   newBreaker(cfg.Breaker),
+		}
+		var p Provider
+		switch name {
+		case "agify":
+			p = &agify{src}
+		case "genderize":
+			p = &genderize{src}
+		case "nationalize":
+			p = &nationalize{src}
+		default:
+			return nil, fmt.Errorf("unknown enrichment provider %q", name)
+		}
+		if cfg.Enabled {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+type agify struct{ httpSource }
+
+func (a *agify) Name() string      { return "agify" }
+func (a *agify) Attribute() string { return AttrAge }
+
+type agifyResponse struct {
+	Count *int `json:"count"`
+	Age   *int `json:"age"`
+}
+
+func (r agifyResponse) result() Result {
+	if r.Age == nil {
+		return Result{}
+	}
+	return Result{Value: *r.Age, Count: r.Count}
+}
+
+func (a *agify) Lookup(ctx context.Context, name string) (Result, error) {
+	return lookupOne[agifyResponse](ctx, a.httpSource, name)
+}
+
+func (a *agify) LookupBatch(ctx context.Context, names []string) []BatchResult {
+	return lookupMany[agifyResponse](ctx, a.httpSource, names)
+}
+
+type genderize struct{ httpSource }
+
+func (g *genderize) Name() string      { return "genderize" }
+func (g *genderize) Attribute() string { return AttrGender }
+
+type genderizeResponse struct {
+	Count       *int     `json:"count"`
+	Gender      *string  `json:"gender"`
+	Probability *float64 `json:"probability"`
+}
+
+func (r genderizeResponse) result() Result {
+	if r.Gender == nil {
+		return Result{}
+	}
+	return Result{Value: *r.Gender, Probability: r.Probability, Count: r.Count}
+}
+
+func (g *genderize) Lookup(ctx context.Context, name string) (Result, error) {
+	return lookupOne[genderizeResponse](ctx, g.httpSource, name)
+}
+
+func (g *genderize) LookupBatch(ctx context.Context, names []string) []BatchResult {
+	return lookupMany[genderizeResponse](ctx, g.httpSource, names)
+}
+
+type nationalize struct{ httpSource }
+
+func (n *nationalize) Name() string      { return "nationalize" }
+func (n *nationalize) Attribute() string { return AttrNationality }
+
+type nationalizeResponse struct {
+	Count   *int `json:"count"`
+	Country []struct {
+		CountryID   string  `json:"country_id"`
+		Probability float64 `json:"probability"`
+	} `json:"country"`
+}
+
+func (r nationalizeResponse) result() Result {
+	if len(r.Country) == 0 {
+		return Result{}
+	}
+	candidates := make([]model.Candidate, len(r.Country))
+	for i, c := range r.Country {
+		candidates[i] = model.Candidate{Value: c.CountryID, Probability: c.Probability}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Probability > candidates[j].Probability })
+	return Result{
+		Value:       candidates[0].Value,
+		Probability: &candidates[0].Probability,
+		Count:       r.Count,
+		Candidates:  candidates,
+	}
+}
+
+func (n *nationalize) Lookup(ctx context.Context, name string) (Result, error) {
+	return lookupOne[nationalizeResponse](ctx, n.httpSource, name)
+}
+
+func (n *nationalize) LookupBatch(ctx context.Context, names []string) []BatchResult {
+	return lookupMany[nationalizeResponse](ctx, n.httpSource, names)
+}
+
+// response — ответ API по одному имени.
+type response interface {
+	result() Result
+}
+
+func lookupOne[T response](ctx context.Context, h httpSource, name string) (Result, error) {
+	var resp T
+	if err := h.get(ctx, url.Values{"name": {name}}, &resp); err != nil {
+		return Result{}, err
+	}
+	return resp.result(), nil
+}
+
+// lookupMany запрашивает names одним запросом: API отвечает массивом в
+// порядке параметров name[]. Ошибка запроса достаётся всем именам.
+func lookupMany[T response](ctx context.Context, h httpSource, names []string) []BatchResult {
+	out := make([]BatchResult, len(names))
+	var resp []T
+	err := h.get(ctx, url.Values{"name[]": names}, &resp)
+	if err == nil && len(resp) != len(names) {
+		err = fmt.Errorf("batch response has %d results for %d names", len(resp), len(names))
+	}
+	for i := range out {
+		if err != nil {
+			out[i].Err = err
+			continue
+		}
+		out[i].Result = resp[i].result()
+	}
+	return out
+}
+
+// httpSource — API вида baseURL?name=<имя>[&apikey=<ключ>], для нескольких
+// имён — baseURL?name[]=<имя>&name[]=<имя>.
+type httpSource struct {
+	client    *http.Client
+	baseURL   string
+	apiKey    string
+	batchSize int
+	retry     RetryConfig
+	breaker   *breaker
+}
+
+func (h httpSource) BatchSize() int { return h.batchSize }
+
+// CountryHint — страна из параметра country_id адреса; ответы для разных
+// стран кешируются отдельно.
+func (h httpSource) CountryHint() string {
+	u, err := url.Parse(h.baseURL)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get("country_id")
+}
+
+// get запрашивает данные по именам из params и разбирает ответ в out,
+// повторяя запрос по h.retry не дольше h.retry.Budget. Пока провайдер
+// отключён, сразу возвращает ErrCircuitOpen.
+func (h httpSource) get(ctx context.Context, params url.Values, out interface{}) (err error) {
+	ok, probe := h.breaker.allow()
+	if !ok {
+		return ErrCircuitOpen
+	}
+	// провайдер, не уложившийся в Budget, для breaker — неответивший
+	defer func(ctx context.Context) { h.breaker.done(ctx, err, probe) }(ctx)
+	ctx, cancel := h.retry.withBudget(ctx)
+	defer cancel()
+	for attempt := 0; ; attempt++ {
+		err = h.fetch(ctx, params, out)
+		if err == nil || attempt >= h.retry.Retries || !retryable(ctx, err) {
+			return err
+		}
+		d, ok := h.retry.delay(attempt, err)
+		if !ok || !fits(ctx, d) {
+			return err
+		}
+		if sleep(ctx, d) != nil {
+			return err
+		}
+	}
+}
+
+// fetch — одна попытка get.
+func (h httpSource) fetch(ctx context.Context, params url.Values, out interface{}) error {
+	u, err := url.Parse(h.baseURL)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	if h.apiKey != "" {
+		q.Set("apikey", h.apiKey)
+	}
+	// в документации API скобки не экранированы: name[]=a&name[]=b
+	u.RawQuery = strings.ReplaceAll(q.Encode(), "name%5B%5D=", "name[]=")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		// ошибка сохраняется в записи и видна клиентам: без ключа API и имени
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			ue.URL = (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String()
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{Code: resp.StatusCode, RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
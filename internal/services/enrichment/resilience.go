@@ -0,0 +1,189 @@
+package enrichment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen — провайдер отключён после серии ошибок, запрос к нему не отправлялся.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// RetryConfig — повторы запроса к провайдеру при сетевых ошибках, 429 и 5xx.
+type RetryConfig struct {
+	// Retries — сколько повторов после первой попытки; 0 — без повторов.
+	Retries int
+	// BaseDelay удваивается с каждой попыткой (со случайным разбросом) до MaxDelay.
+	BaseDelay time.Duration
+	// MaxDelay ограничивает и паузу из Retry-After: если провайдер просит
+	// ждать дольше, запрос не повторяется.
+	MaxDelay time.Duration
+	// Budget ограничивает запрос к провайдеру целиком, со всеми попытками и
+	// паузами; повтор, который не успеет до конца срока, не начинается.
+	// 0 — без ограничения, кроме срока ctx.
+	Budget time.Duration
+}
+
+// BreakerConfig — отключение провайдера, который подряд не отвечает.
+type BreakerConfig struct {
+	// Threshold — сколько неудачных запросов подряд отключают провайдер; 0 — не отключать.
+	Threshold int
+	// Cooldown — на сколько отключается провайдер; затем пропускается один пробный запрос.
+	Cooldown time.Duration
+}
+
+// StatusError — провайдер ответил не 200.
+type StatusError struct {
+	Code int
+	// RetryAfter — пауза из заголовка Retry-After; 0 — заголовка нет.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string { return fmt.Sprintf("status %d", e.Code) }
+
+// retryable сообщает, стоит ли повторить запрос: сбой сети, лимит запросов
+// или ошибка на стороне провайдера. Отмена запроса клиентом не повторяется.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code == http.StatusTooManyRequests || se.Code >= 500
+	}
+	var ue *url.Error
+	return errors.As(err, &ue)
+}
+
+// delay — пауза перед повтором attempt (с нуля); ok == false — ждать дольше MaxDelay.
+func (c RetryConfig) delay(attempt int, err error) (d time.Duration, ok bool) {
+	var se *StatusError
+	if errors.As(err, &se) && se.RetryAfter > 0 {
+		return se.RetryAfter, c.MaxDelay <= 0 || se.RetryAfter <= c.MaxDelay
+	}
+	d = c.BaseDelay << attempt
+	if d <= 0 || (c.MaxDelay > 0 && d > c.MaxDelay) {
+		d = c.MaxDelay
+	}
+	if d <= 0 {
+		return 0, true
+	}
+	// половина паузы фиксирована, половина случайна — повторы разных запросов не совпадают
+	return d/2 + rand.N(d/2+1), true
+}
+
+// withBudget ограничивает ctx сроком c.Budget.
+func (c RetryConfig) withBudget(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.Budget <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.Budget)
+}
+
+// fits сообщает, закончится ли пауза d до срока ctx.
+func fits(ctx context.Context, d time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Now().Add(d).Before(deadline)
+}
+
+// parseRetryAfter разбирает Retry-After: число секунд или дата HTTP.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(v); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// breaker отключает провайдер после Threshold неудач подряд: до конца
+// Cooldown запросы сразу получают ErrCircuitOpen, затем один пробный запрос
+// решает, включить провайдер или отключить снова.
+type breaker struct {
+	cfg BreakerConfig
+	now func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newBreaker(cfg BreakerConfig) *breaker {
+	if cfg.Threshold <= 0 {
+		return nil
+	}
+	return &breaker{cfg: cfg, now: time.Now}
+}
+
+// allow решает, пропустить ли запрос. probe сообщает, что запрос занял
+// единственное место пробного: только он снимает его в done.
+func (b *breaker) allow() (ok, probe bool) {
+	if b == nil {
+		return true, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.cfg.Threshold {
+		return true, false
+	}
+	if b.probing || b.now().Before(b.openUntil) {
+		return false, false
+	}
+	b.probing = true
+	return true, true
+}
+
+// done учитывает итог запроса, пропущенного allow; probe — значение, которое
+// allow вернул этому запросу. Ошибки, в которых провайдер не виноват
+// (отмена запроса, 4xx), на состояние не влияют.
+func (b *breaker) done(ctx context.Context, err error, probe bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	switch {
+	case err == nil:
+		b.failures = 0
+	case retryable(ctx, err):
+		b.failures++
+		if b.failures >= b.cfg.Threshold {
+			until := b.now().Add(b.cfg.Cooldown)
+			// провайдер сам сказал, когда вернуться
+			var se *StatusError
+			if errors.As(err, &se) && b.now().Add(se.RetryAfter).After(until) {
+				until = b.now().Add(se.RetryAfter)
+			}
+			b.openUntil = until
+		}
+	}
+}
+
+// sleep ждёт d или отмены ctx.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -2,118 +2,275 @@ package enrichment
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
+	"slices"
+	"strings"
 	"sync"
-	"time"
 
 	"person-api/internal/model"
 )
 
+// Атрибуты Person, которые заполняют провайдеры.
+const (
+	AttrAge         = "age"
+	AttrGender      = "gender"
+	AttrNationality = "nationality"
+)
+
 type Service interface {
+	// Enrich заполняет атрибуты всех провайдеров и для каждого записывает в
+	// p.Enrichment статус: complete или failed с ошибкой провайдеров. Ошибку
+	// Enrich возвращает только при отмене ctx.
 	Enrich(ctx context.Context, p model.Person) (model.Person, error)
+	// EnrichAttributes — Enrich только для attrs. Атрибут без включённых
+	// провайдеров получает статус failed.
+	EnrichAttributes(ctx context.Context, p model.Person, attrs []string) (model.Person, error)
+	// EnrichBatch — EnrichAttributes для каждого запроса: имена уходят
+	// провайдерам пакетами. Результаты идут в порядке reqs.
+	EnrichBatch(ctx context.Context, reqs []Request) ([]model.Person, error)
+	// Attributes — атрибуты, которые заполняют провайдеры, без повторов.
+	Attributes() []string
+	// CacheStats — статистика кеша; Enabled == false, если кеш не настроен.
+	CacheStats() model.CacheStats
+}
+
+// Request — кого обогатить и какие атрибуты получить.
+type Request struct {
+	Person model.Person
+	Attrs  []string
+}
+
+// Provider — источник одного атрибута по имени человека.
+type Provider interface {
+	// Name — имя провайдера в конфигурации.
+	Name() string
+	// Attribute — атрибут, который заполняет провайдер (AttrAge, ...).
+	Attribute() string
+	Lookup(ctx context.Context, name string) (Result, error)
+}
+
+// BatchProvider — провайдер, который ищет несколько имён одним запросом.
+type BatchProvider interface {
+	Provider
+	// BatchSize — сколько имён принимает LookupBatch.
+	BatchSize() int
+	// LookupBatch — Lookup для каждого из names; результаты в порядке names.
+	LookupBatch(ctx context.Context, names []string) []BatchResult
+}
+
+// BatchResult — ответ по одному имени из LookupBatch.
+type BatchResult struct {
+	Result
+	Err error
+}
+
+// Result — ответ провайдера. Value имеет тип int для AttrAge и string для
+// остальных атрибутов; nil — провайдер не знает такого имени.
+type Result struct {
+	Value interface{}
+	// Probability — уверенность провайдера в Value; nil — провайдер её не сообщает.
+	Probability *float64
+	// Count — по скольким записям провайдер сделал вывод.
+	Count *int
+	// Candidates — все варианты по убыванию вероятности; Value — первый из них.
+	Candidates []model.Candidate
+}
+
+// registry опрашивает провайдеры одновременно. Если атрибут заполняют
+// несколько провайдеров, побеждает первый в списке, вернувший значение.
+type registry struct {
+	providers []Provider
+	cache     *Cache
 }
 
-type enrichmentService struct {
-	client *http.Client
+// NewService возвращает Service, опрашивающий providers; порядок задаёт
+// приоритет провайдеров одного атрибута.
+func NewService(providers ...Provider) Service {
+	return &registry{providers: providers}
 }
 
-func NewService() Service {
-	return &enrichmentService{
-		client: &http.Client{Timeout: 5 * time.Second},
+// NewCachedService — NewService, где провайдеры опрашиваются через cache.
+func NewCachedService(cache *Cache, providers ...Provider) Service {
+	wrapped := make([]Provider, len(providers))
+	for i, p := range providers {
+		wrapped[i] = cache.Wrap(p)
 	}
+	return &registry{providers: wrapped, cache: cache}
 }
 
-func (s *enrichmentService) Enrich(ctx context.Context, p model.Person) (model.Person, error) {
-	var (
-		wg    sync.WaitGroup
-		mu    sync.Mutex
-		first error
-	)
+func (s *registry) CacheStats() model.CacheStats {
+	if s.cache == nil {
+		return model.CacheStats{}
+	}
+	return s.cache.Stats()
+}
 
-	wg.Add(3)
-	// agify
-	go func() {
-		defer wg.Done()
-		var a struct {
-			Age int `json:"age"`
+func (s *registry) Attributes() []string {
+	var attrs []string
+	for _, pr := range s.providers {
+		if !slices.Contains(attrs, pr.Attribute()) {
+			attrs = append(attrs, pr.Attribute())
 		}
-		if err := s.call(ctx, fmt.Sprintf("https://api.agify.io/?name=%s", p.Name), &a); err != nil {
-			mu.Lock()
-			if first == nil {
-				first = err
+	}
+	return attrs
+}
+
+func (s *registry) Enrich(ctx context.Context, p model.Person) (model.Person, error) {
+	return s.enrichOne(ctx, Request{Person: p, Attrs: s.Attributes()})
+}
+
+func (s *registry) EnrichAttributes(ctx context.Context, p model.Person, attrs []string) (model.Person, error) {
+	return s.enrichOne(ctx, Request{Person: p, Attrs: attrs})
+}
+
+func (s *registry) enrichOne(ctx context.Context, r Request) (model.Person, error) {
+	out, err := s.EnrichBatch(ctx, []Request{r})
+	if err != nil {
+		return r.Person, err
+	}
+	return out[0], nil
+}
+
+// lookupWorkers ограничивает число одновременных запросов к провайдерам в
+// одном EnrichBatch.
+const lookupWorkers = 8
+
+func (s *registry) EnrichBatch(ctx context.Context, reqs []Request) ([]model.Person, error) {
+	// answers[j] — ответы провайдера j по именам; одно имя запрашивается один раз
+	answers := make([]map[string]BatchResult, len(s.providers))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, lookupWorkers)
+	for j, pr := range s.providers {
+		answers[j] = make(map[string]BatchResult)
+		var names []string
+		seen := make(map[string]bool)
+		for _, r := range reqs {
+			if slices.Contains(r.Attrs, pr.Attribute()) && !seen[r.Person.Name] {
+				seen[r.Person.Name] = true
+				names = append(names, r.Person.Name)
 			}
-			mu.Unlock()
-			return
 		}
-		mu.Lock()
-		p.Age = &a.Age
-		mu.Unlock()
-	}()
-
-	// genderize
-	go func() {
-		defer wg.Done()
-		var g struct {
-			Gender string `json:"gender"`
+		size := 1
+		if bp, ok := pr.(BatchProvider); ok {
+			size = max(bp.BatchSize(), 1)
 		}
-		if err := s.call(ctx, fmt.Sprintf("https://api.genderize.io/?name=%s", p.Name), &g); err != nil {
-			mu.Lock()
-			if first == nil {
-				first = err
-			}
-			mu.Unlock()
-			return
-		}
-		mu.Lock()
-		p.Gender = &g.Gender
-		mu.Unlock()
-	}()
-
-	// nationalize
-	go func() {
-		defer wg.Done()
-		var n struct {
-			Country []struct {
-				CountryID   string  `json:"country_id"`
-				Probability float64 `json:"probability"`
-			} `json:"country"`
+		for chunk := range slices.Chunk(names, size) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				res := lookupNames(ctx, pr, chunk)
+				mu.Lock()
+				defer mu.Unlock()
+				for k, name := range chunk {
+					answers[j][name] = res[k]
+				}
+			}()
 		}
-		if err := s.call(ctx, fmt.Sprintf("https://api.nationalize.io/?name=%s", p.Name), &n); err != nil {
-			mu.Lock()
-			if first == nil {
-				first = err
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]model.Person, len(reqs))
+	for i, r := range reqs {
+		var providers []Provider
+		var results []BatchResult
+		for j, pr := range s.providers {
+			if slices.Contains(r.Attrs, pr.Attribute()) {
+				providers = append(providers, pr)
+				results = append(results, answers[j][r.Person.Name])
 			}
-			mu.Unlock()
-			return
-		}
-		if len(n.Country) > 0 {
-			mu.Lock()
-			p.Nationality = &n.Country[0].CountryID
-			mu.Unlock()
 		}
-	}()
+		out[i] = assemble(r.Person, providers, results, r.Attrs)
+	}
+	return out, nil
+}
 
-	wg.Wait()
-	if first != nil {
-		return p, first
+// lookupNames — LookupBatch, если провайдер его поддерживает, иначе Lookup
+// по очереди.
+func lookupNames(ctx context.Context, pr Provider, names []string) []BatchResult {
+	if bp, ok := pr.(BatchProvider); ok && len(names) > 1 {
+		return bp.LookupBatch(ctx, names)
+	}
+	out := make([]BatchResult, len(names))
+	for i, name := range names {
+		out[i].Result, out[i].Err = pr.Lookup(ctx, name)
 	}
-	return p, nil
+	return out
 }
 
-func (s *enrichmentService) call(ctx context.Context, url string, out interface{}) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return err
+// assemble записывает в p ответы providers и статус каждого из attrs.
+func assemble(p model.Person, providers []Provider, results []BatchResult, attrs []string) model.Person {
+	covered := make(map[string]bool, len(providers))
+	filled := make(map[string]bool, len(providers))
+	failures := make(map[string][]string)
+	for i, pr := range providers {
+		attr := pr.Attribute()
+		covered[attr] = true
+		switch {
+		case filled[attr]:
+		case results[i].Err != nil:
+			failures[attr] = append(failures[attr], fmt.Sprintf("%s: %v", pr.Name(), results[i].Err))
+		case results[i].Value != nil && apply(&p, attr, results[i].Value):
+			filled[attr] = true
+			setStatus(&p, attr, model.AttributeSource{
+				Status:      model.EnrichmentComplete,
+				Provider:    pr.Name(),
+				Probability: results[i].Probability,
+				Count:       results[i].Count,
+				Candidates:  results[i].Candidates,
+			})
+		}
 	}
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return err
+	for _, attr := range attrs {
+		if !covered[attr] {
+			failures[attr] = []string{"no enabled provider"}
+		}
+	}
+	// ошибка провайдера не важна, если атрибут заполнил другой
+	for attr, errs := range failures {
+		if !filled[attr] {
+			setStatus(&p, attr, model.AttributeSource{Status: model.EnrichmentFailed, Error: strings.Join(errs, "; ")})
+		}
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("status %d", resp.StatusCode)
+	for attr := range covered {
+		if !filled[attr] && len(failures[attr]) == 0 {
+			// провайдеры не знают имя: атрибут обогащён, но пуст
+			setStatus(&p, attr, model.AttributeSource{Status: model.EnrichmentComplete})
+		}
+	}
+	return p
+}
+
+func setStatus(p *model.Person, attr string, src model.AttributeSource) {
+	if p.Enrichment == nil {
+		p.Enrichment = make(map[string]model.AttributeSource)
+	}
+	p.Enrichment[attr] = src
+}
+
+// apply записывает значение атрибута в p и сообщает, подошёл ли его тип.
+func apply(p *model.Person, attr string, v interface{}) bool {
+	switch attr {
+	case AttrAge:
+		if n, ok := v.(int); ok {
+			p.Age = &n
+			return true
+		}
+	case AttrGender:
+		if s, ok := v.(string); ok {
+			p.Gender = &s
+			return true
+		}
+	case AttrNationality:
+		if s, ok := v.(string); ok {
+			p.Nationality = &s
+			return true
+		}
 	}
-	return json.NewDecoder(resp.Body).Decode(out)
+	return false
 }
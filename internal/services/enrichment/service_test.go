@@ -7,11 +7,17 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"person-api/internal/model"
+	"person-api/internal/storage/memory"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type stubTransport struct {
@@ -38,6 +44,32 @@ func makeResp(body interface{}, status int) *http.Response {
 	}
 }
 
+func newTestService(t *testing.T, st http.RoundTripper, names ...string) Service {
+	if len(names) == 0 {
+		names = []string{"agify", "genderize", "nationalize"}
+	}
+	cfgs := make([]ProviderConfig, len(names))
+	for i, name := range names {
+		cfgs[i] = ProviderConfig{Name: name, BaseURL: "https://api." + name + ".io/", Enabled: true}
+	}
+	providers, err := Providers(cfgs, st)
+	require.NoError(t, err)
+	return NewService(providers...)
+}
+
+// stubProvider отвечает заданным значением или ошибкой.
+type stubProvider struct {
+	name, attr string
+	value      interface{}
+	err        error
+}
+
+func (p *stubProvider) Name() string      { return p.name }
+func (p *stubProvider) Attribute() string { return p.attr }
+func (p *stubProvider) Lookup(context.Context, string) (Result, error) {
+	return Result{Value: p.value}, p.err
+}
+
 func TestEnrich_Success(t *testing.T) {
 	ctx := context.Background()
 	base := model.Person{Name: "Test"}
@@ -50,8 +82,7 @@ func TestEnrich_Success(t *testing.T) {
 			}, 200),
 		},
 	}
-	svc := NewService().(*enrichmentService)
-	svc.client = &http.Client{Transport: st}
+	svc := newTestService(t, st)
 	got, err := svc.Enrich(ctx, base)
 	assert.NoError(t, err)
 	assert.Equal(t, 25, *got.Age)
@@ -71,8 +102,7 @@ func TestEnrich_PartialNoCountry(t *testing.T) {
 			}, 200),
 		},
 	}
-	svc := NewService().(*enrichmentService)
-	svc.client = &http.Client{Transport: st}
+	svc := newTestService(t, st)
 	got, err := svc.Enrich(ctx, base)
 	assert.NoError(t, err)
 	assert.Nil(t, got.Nationality)
@@ -82,11 +112,25 @@ func TestEnrich_ErrorFromCall(t *testing.T) {
 	ctx := context.Background()
 	base := model.Person{Name: "Err"}
 	st := &stubTransport{err: errors.New("network")}
-	svc := NewService().(*enrichmentService)
-	svc.client = &http.Client{Transport: st}
-	_, err := svc.Enrich(ctx, base)
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "network")
+	svc := newTestService(t, st)
+	// ошибки провайдеров не мешают записи: они в статусе атрибутов
+	got, err := svc.Enrich(ctx, base)
+	require.NoError(t, err)
+	require.Len(t, got.Enrichment, 3)
+	for _, src := range got.Enrichment {
+		assert.Equal(t, model.EnrichmentFailed, src.Status)
+		assert.Contains(t, src.Error, "network")
+	}
+}
+
+func TestEnrich_ErrorHidesAPIKey(t *testing.T) {
+	providers, err := Providers([]ProviderConfig{{
+		Name: "agify", BaseURL: "https://api.agify.io/?country_id=RU", APIKey: "secret", Enabled: true,
+	}}, &stubTransport{err: errors.New("network")})
+	require.NoError(t, err)
+	got, err := NewService(providers...).Enrich(context.Background(), model.Person{Name: "Ivan"})
+	require.NoError(t, err)
+	assert.Equal(t, `agify: Get "https://api.agify.io/": network`, got.Enrichment[AttrAge].Error)
 }
 
 func TestEnrich_Non200Status(t *testing.T) {
@@ -94,11 +138,626 @@ func TestEnrich_Non200Status(t *testing.T) {
 	base := model.Person{Name: "Bad"}
 	st := &stubTransport{
 		responses: map[string]*http.Response{
-			"api.agify.io": makeResp(map[string]int{"age": 50}, 500),
+			"api.agify.io":     makeResp(map[string]int{"age": 50}, 500),
+			"api.genderize.io": makeResp(map[string]string{"gender": "male"}, 200),
+			"api.nationalize.io": makeResp(map[string][]map[string]interface{}{
+				"country": {},
+			}, 200),
+		},
+	}
+	svc := newTestService(t, st)
+	got, err := svc.Enrich(ctx, base)
+	require.NoError(t, err)
+	assert.Nil(t, got.Age)
+	assert.Equal(t, "male", *got.Gender)
+	assert.Equal(t, model.AttributeSource{Status: model.EnrichmentFailed, Error: "agify: status 500"}, got.Enrichment[AttrAge])
+	assert.Equal(t, model.EnrichmentComplete, got.Enrichment[AttrGender].Status)
+	// имя неизвестно провайдеру: обогащение завершено, значения нет
+	assert.Equal(t, model.AttributeSource{Status: model.EnrichmentComplete}, got.Enrichment[AttrNationality])
+}
+
+func TestEnrich_CanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := NewService(&stubProvider{name: "agify", attr: AttrAge, value: 30}).Enrich(ctx, model.Person{Name: "Ivan"})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestEnrichAttributes(t *testing.T) {
+	ctx := context.Background()
+	age := &countingProvider{attr: AttrAge, values: map[string]interface{}{"Ivan": 40}}
+	gender := &stubProvider{name: "genderize", attr: AttrGender, value: "male"}
+
+	got, err := NewService(age, gender).EnrichAttributes(ctx, model.Person{Name: "Ivan"}, []string{AttrAge, AttrNationality})
+	require.NoError(t, err)
+	assert.Equal(t, 40, *got.Age)
+	assert.Nil(t, got.Gender, "gender was not requested")
+	assert.Equal(t, map[string]model.AttributeSource{
+		AttrAge:         {Status: model.EnrichmentComplete, Provider: "counting"},
+		AttrNationality: {Status: model.EnrichmentFailed, Error: "no enabled provider"},
+	}, got.Enrichment)
+}
+
+func TestEnrich_DisabledProvider(t *testing.T) {
+	st := &stubTransport{
+		responses: map[string]*http.Response{
+			"api.agify.io": makeResp(map[string]int{"age": 33}, 200),
 		},
 	}
-	svc := NewService().(*enrichmentService)
-	svc.client = &http.Client{Transport: st}
-	_, err := svc.Enrich(ctx, base)
+	// genderize и nationalize выключены: их сервисы не запрашиваются
+	got, err := newTestService(t, st, "agify").Enrich(context.Background(), model.Person{Name: "Ann"})
+	assert.NoError(t, err)
+	assert.Equal(t, 33, *got.Age)
+	assert.Nil(t, got.Gender)
+	assert.Nil(t, got.Nationality)
+}
+
+func TestAttributes(t *testing.T) {
+	svc := NewService(
+		&stubProvider{name: "primary", attr: AttrGender},
+		&stubProvider{name: "agify", attr: AttrAge},
+		&stubProvider{name: "fallback", attr: AttrGender},
+	)
+	assert.Equal(t, []string{AttrGender, AttrAge}, svc.Attributes())
+	assert.Empty(t, NewService().Attributes())
+}
+
+func TestEnrich_ProviderOrder(t *testing.T) {
+	ctx := context.Background()
+	primary := &stubProvider{name: "primary", attr: AttrGender, value: "female"}
+	fallback := &stubProvider{name: "fallback", attr: AttrGender, value: "male"}
+
+	got, err := NewService(primary, fallback).Enrich(ctx, model.Person{Name: "Sasha"})
+	require.NoError(t, err)
+	assert.Equal(t, "female", *got.Gender)
+
+	got, err = NewService(fallback, primary).Enrich(ctx, model.Person{Name: "Sasha"})
+	require.NoError(t, err)
+	assert.Equal(t, "male", *got.Gender)
+
+	// ошибку первого перекрывает значение второго
+	broken := &stubProvider{name: "broken", attr: AttrGender, err: errors.New("down")}
+	got, err = NewService(broken, fallback).Enrich(ctx, model.Person{Name: "Sasha"})
+	require.NoError(t, err)
+	assert.Equal(t, "male", *got.Gender)
+
+	also := &stubProvider{name: "also", attr: AttrGender, err: errors.New("timeout")}
+	got, err = NewService(broken, also).Enrich(ctx, model.Person{Name: "Sasha"})
+	require.NoError(t, err)
+	assert.Nil(t, got.Gender)
+	assert.Equal(t, model.AttributeSource{Status: model.EnrichmentFailed, Error: "broken: down; also: timeout"}, got.Enrichment[AttrGender])
+}
+
+func TestProviders_Config(t *testing.T) {
+	cfg := func(name string, enabled bool) ProviderConfig {
+		return ProviderConfig{Name: name, BaseURL: "http://localhost/", Enabled: enabled}
+	}
+	providers, err := Providers([]ProviderConfig{cfg("nationalize", true), cfg("genderize", false), cfg(" Agify ", true)}, nil)
+	require.NoError(t, err)
+	require.Len(t, providers, 2)
+	assert.Equal(t, "nationalize", providers[0].Name())
+	assert.Equal(t, AttrAge, providers[1].Attribute())
+
+	_, err = Providers([]ProviderConfig{cfg("agify", true), cfg("unknown", true)}, nil)
+	assert.ErrorContains(t, err, `unknown enrichment provider "unknown"`)
+	_, err = Providers([]ProviderConfig{cfg("agify", true), cfg("agify", false)}, nil)
 	assert.Error(t, err)
 }
+
+// recordTransport запоминает адрес запроса и отвечает заданным телом.
+type recordTransport struct {
+	url  string
+	body interface{}
+}
+
+func (r *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.url = req.URL.String()
+	return makeResp(r.body, 200), nil
+}
+
+func TestProviders_BaseURLAndAPIKey(t *testing.T) {
+	rt := &recordTransport{body: map[string]int{"age": 30}}
+	providers, err := Providers([]ProviderConfig{{
+		Name:    "agify",
+		BaseURL: "http://agify.local:8081/v1?country_id=RU",
+		APIKey:  "secret",
+		Enabled: true,
+	}}, rt)
+	require.NoError(t, err)
+
+	res, err := providers[0].Lookup(context.Background(), "Анна Мария")
+	require.NoError(t, err)
+	assert.Equal(t, 30, res.Value)
+	assert.Equal(t, "http://agify.local:8081/v1?apikey=secret&country_id=RU&name=%D0%90%D0%BD%D0%BD%D0%B0+%D0%9C%D0%B0%D1%80%D0%B8%D1%8F", rt.url)
+}
+
+func TestLookupBatch(t *testing.T) {
+	rt := &recordTransport{body: []map[string]interface{}{
+		{"name": "Ivan", "count": 10, "gender": "male", "probability": 0.99},
+		{"name": "Zzz", "count": 0, "gender": nil},
+	}}
+	providers, err := Providers([]ProviderConfig{{Name: "genderize", BaseURL: "https://api.genderize.io/", Enabled: true, BatchSize: 10}}, rt)
+	require.NoError(t, err)
+	bp, ok := providers[0].(BatchProvider)
+	require.True(t, ok)
+	assert.Equal(t, 10, bp.BatchSize())
+
+	got := bp.LookupBatch(context.Background(), []string{"Ivan", "Zzz"})
+	assert.Equal(t, "https://api.genderize.io/?name[]=Ivan&name[]=Zzz", rt.url)
+	require.Len(t, got, 2)
+	require.NoError(t, got[0].Err)
+	assert.Equal(t, "male", got[0].Value)
+	assert.Equal(t, 0.99, *got[0].Probability)
+	assert.Equal(t, BatchResult{}, got[1])
+
+	// ответ не на все имена: сопоставить нельзя
+	got = bp.LookupBatch(context.Background(), []string{"Ivan", "Zzz", "Anna"})
+	for _, r := range got {
+		assert.EqualError(t, r.Err, "batch response has 2 results for 3 names")
+	}
+}
+
+// batchProvider — countingProvider с пакетными запросами; batches — имена каждого запроса.
+type batchProvider struct {
+	*countingProvider
+	size    int
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (p *batchProvider) BatchSize() int { return p.size }
+func (p *batchProvider) LookupBatch(ctx context.Context, names []string) []BatchResult {
+	p.mu.Lock()
+	p.batches = append(p.batches, slices.Clone(names))
+	p.mu.Unlock()
+	out := make([]BatchResult, len(names))
+	for i, name := range names {
+		out[i].Result, out[i].Err = p.countingProvider.Lookup(ctx, name)
+	}
+	return out
+}
+
+func (p *batchProvider) sortedBatches() [][]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := slices.Clone(p.batches)
+	slices.SortFunc(out, func(a, b []string) int { return len(b) - len(a) })
+	return out
+}
+
+func TestEnrichBatch(t *testing.T) {
+	ages := &batchProvider{size: 2, countingProvider: &countingProvider{attr: AttrAge, values: map[string]interface{}{"Ivan": 40, "Anna": 30, "Oleg": 50}}}
+	genders := &stubProvider{name: "genderize", attr: AttrGender, value: "female"}
+	svc := NewService(ages, genders)
+
+	got, err := svc.EnrichBatch(context.Background(), []Request{
+		{Person: model.Person{Name: "Ivan"}, Attrs: []string{AttrAge, AttrGender}},
+		{Person: model.Person{Name: "Anna"}, Attrs: []string{AttrAge}},
+		{Person: model.Person{Name: "Ivan", Surname: "Other"}, Attrs: []string{AttrAge}},
+		{Person: model.Person{Name: "fail"}, Attrs: []string{AttrAge}},
+		{Person: model.Person{Name: "Oleg"}, Attrs: []string{AttrGender}},
+	})
+	require.NoError(t, err)
+	require.Len(t, got, 5)
+
+	// повтор имени не запрашивается, Oleg возраст не нужен; одно имя идёт через Lookup
+	assert.Equal(t, int32(3), ages.calls.Load())
+	assert.Equal(t, [][]string{{"Ivan", "Anna"}}, ages.sortedBatches())
+
+	assert.Equal(t, 40, *got[0].Age)
+	assert.Equal(t, "female", *got[0].Gender)
+	assert.Equal(t, 30, *got[1].Age)
+	assert.Nil(t, got[1].Gender)
+	assert.Equal(t, "Other", got[2].Surname)
+	assert.Equal(t, 40, *got[2].Age)
+	// ошибка одного имени не задевает остальные имена пакета
+	assert.Equal(t, model.AttributeSource{Status: model.EnrichmentFailed, Error: "counting: upstream down"}, got[3].Enrichment[AttrAge])
+	assert.Nil(t, got[4].Age)
+	assert.Equal(t, map[string]model.AttributeSource{AttrGender: {Status: model.EnrichmentComplete, Provider: "genderize"}}, got[4].Enrichment)
+}
+
+func TestEnrich_Confidence(t *testing.T) {
+	st := &stubTransport{
+		responses: map[string]*http.Response{
+			"api.agify.io":     makeResp(map[string]interface{}{"age": 41, "count": 1200}, 200),
+			"api.genderize.io": makeResp(map[string]interface{}{"gender": "female", "probability": 0.97, "count": 5300}, 200),
+			"api.nationalize.io": makeResp(map[string]interface{}{
+				"count": 800,
+				"country": []map[string]interface{}{
+					{"country_id": "UA", "probability": 0.3},
+					{"country_id": "RU", "probability": 0.5},
+				},
+			}, 200),
+		},
+	}
+	got, err := newTestService(t, st).Enrich(context.Background(), model.Person{Name: "Olga"})
+	require.NoError(t, err)
+
+	prob := func(v float64) *float64 { return &v }
+	count := func(v int) *int { return &v }
+	assert.Equal(t, map[string]model.AttributeSource{
+		AttrAge:    {Status: model.EnrichmentComplete, Provider: "agify", Count: count(1200)},
+		AttrGender: {Status: model.EnrichmentComplete, Provider: "genderize", Probability: prob(0.97), Count: count(5300)},
+		// варианты упорядочены по вероятности, значение — самый вероятный
+		AttrNationality: {Status: model.EnrichmentComplete, Provider: "nationalize", Probability: prob(0.5), Count: count(800), Candidates: []model.Candidate{
+			{Value: "RU", Probability: 0.5}, {Value: "UA", Probability: 0.3},
+		}},
+	}, got.Enrichment)
+	assert.Equal(t, "RU", *got.Nationality)
+}
+
+// countingProvider считает обращения и отвечает values[name] (nil — имя неизвестно).
+type countingProvider struct {
+	attr   string
+	values map[string]interface{}
+	calls  atomic.Int32
+	// release, если задан, задерживает ответ до закрытия.
+	release chan struct{}
+}
+
+func (p *countingProvider) Name() string      { return "counting" }
+func (p *countingProvider) Attribute() string { return p.attr }
+func (p *countingProvider) Lookup(_ context.Context, name string) (Result, error) {
+	p.calls.Add(1)
+	if p.release != nil {
+		<-p.release
+	}
+	if name == "fail" {
+		return Result{}, errors.New("upstream down")
+	}
+	return Result{Value: p.values[name]}, nil
+}
+
+func TestCache_HitsAndMisses(t *testing.T) {
+	ctx := context.Background()
+	prov := &countingProvider{attr: AttrAge, values: map[string]interface{}{"Ivan": 40}}
+	cache := NewCache(CacheConfig{Size: 10, TTL: time.Hour, NegativeTTL: time.Hour}, nil)
+	svc := NewCachedService(cache, prov)
+
+	for _, name := range []string{"Ivan", " ivan ", "IVAN"} {
+		got, err := svc.Enrich(ctx, model.Person{Name: name})
+		require.NoError(t, err)
+		require.NotNil(t, got.Age)
+		assert.Equal(t, 40, *got.Age)
+	}
+	// имя неизвестно: ответ тоже запоминается
+	for i := 0; i < 2; i++ {
+		got, err := svc.Enrich(ctx, model.Person{Name: "Zzyzx"})
+		require.NoError(t, err)
+		assert.Nil(t, got.Age)
+	}
+	// ошибки не кешируются
+	for i := 0; i < 2; i++ {
+		got, err := svc.Enrich(ctx, model.Person{Name: "fail"})
+		require.NoError(t, err)
+		assert.Equal(t, model.EnrichmentFailed, got.Enrichment[AttrAge].Status)
+	}
+
+	assert.Equal(t, int32(4), prov.calls.Load())
+	assert.Equal(t, model.CacheStats{
+		Enabled: true, Entries: 2, Capacity: 10, MemoryHits: 3, NegativeHits: 1, Misses: 4,
+	}, svc.CacheStats())
+	assert.False(t, NewService(prov).CacheStats().Enabled)
+}
+
+func TestCache_Store(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewMemoryStorage()
+	cfg := CacheConfig{Size: 10, TTL: time.Hour, NegativeTTL: time.Hour}
+
+	prob := 0.6
+	nat := &stubProvider{name: "nationalize", attr: AttrNationality}
+	first := NewCache(cfg, store)
+	_, err := first.Wrap(&resultProvider{stubProvider: nat, res: Result{
+		Value: "RU", Probability: &prob, Candidates: []model.Candidate{{Value: "RU", Probability: 0.6}},
+	}}).Lookup(ctx, "Anna")
+	require.NoError(t, err)
+
+	// новый процесс: память пуста, ответ берётся из базы с исходными типами
+	second := NewCache(cfg, store)
+	res, err := second.Wrap(&resultProvider{stubProvider: nat, err: errors.New("must not be called")}).Lookup(ctx, "anna")
+	require.NoError(t, err)
+	assert.Equal(t, Result{Value: "RU", Probability: &prob, Candidates: []model.Candidate{{Value: "RU", Probability: 0.6}}}, res)
+	assert.Equal(t, int64(1), second.Stats().StoreHits)
+
+	// возраст после JSON снова int
+	age := NewCache(cfg, store)
+	_, err = age.Wrap(&countingProvider{attr: AttrAge, values: map[string]interface{}{"Oleg": 35}}).Lookup(ctx, "Oleg")
+	require.NoError(t, err)
+	res, err = NewCache(cfg, store).Wrap(&countingProvider{attr: AttrAge}).Lookup(ctx, "oleg")
+	require.NoError(t, err)
+	assert.Equal(t, 35, res.Value)
+}
+
+// resultProvider отвечает заданным Result.
+type resultProvider struct {
+	*stubProvider
+	res Result
+	err error
+}
+
+func (p *resultProvider) Lookup(context.Context, string) (Result, error) { return p.res, p.err }
+
+func TestCache_ExpiryAndEviction(t *testing.T) {
+	ctx := context.Background()
+	prov := &countingProvider{attr: AttrAge, values: map[string]interface{}{"A": 1, "B": 2, "C": 3}}
+
+	// отрицательный ответ не кешируется при NegativeTTL = 0
+	cache := NewCache(CacheConfig{Size: 2, TTL: time.Hour}, nil)
+	p := cache.Wrap(prov)
+	for _, name := range []string{"X", "X", "A", "B", "C", "A"} {
+		_, err := p.Lookup(ctx, name)
+		require.NoError(t, err)
+	}
+	// X дважды, A вытеснен C и запрошен заново
+	assert.Equal(t, int32(6), prov.calls.Load())
+	assert.Equal(t, 2, cache.Stats().Entries)
+
+	prov.calls.Store(0)
+	short := NewCache(CacheConfig{Size: 2, TTL: time.Millisecond}, nil).Wrap(prov)
+	_, _ = short.Lookup(ctx, "A")
+	time.Sleep(5 * time.Millisecond)
+	_, _ = short.Lookup(ctx, "A")
+	assert.Equal(t, int32(2), prov.calls.Load())
+}
+
+func TestCache_ConcurrentLookupsShareCall(t *testing.T) {
+	prov := &countingProvider{attr: AttrAge, values: map[string]interface{}{"Ivan": 40}, release: make(chan struct{})}
+	p := NewCache(CacheConfig{Size: 10, TTL: time.Hour}, nil).Wrap(prov)
+
+	var wg sync.WaitGroup
+	results := make([]Result, 8)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = p.Lookup(context.Background(), "Ivan")
+		}()
+	}
+	// ждём, пока первый запрос дойдёт до провайдера, и отпускаем его
+	require.Eventually(t, func() bool { return prov.calls.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	close(prov.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), prov.calls.Load())
+	for _, r := range results {
+		assert.Equal(t, 40, r.Value)
+	}
+}
+
+func TestCache_LookupBatch(t *testing.T) {
+	ctx := context.Background()
+	prov := &batchProvider{size: 10, countingProvider: &countingProvider{attr: AttrAge, values: map[string]interface{}{"Ivan": 40, "Anna": 30}}}
+	cache := NewCache(CacheConfig{Size: 10, TTL: time.Hour, NegativeTTL: time.Hour}, memory.NewMemoryStorage())
+	p := cache.Wrap(prov).(BatchProvider)
+	assert.Equal(t, 10, p.BatchSize())
+
+	got := p.LookupBatch(ctx, []string{"Ivan", "Oleg", "IVAN", "fail"})
+	require.Len(t, got, 4)
+	assert.Equal(t, 40, got[0].Value)
+	assert.Nil(t, got[1].Value)
+	assert.Equal(t, 40, got[2].Value)
+	assert.EqualError(t, got[3].Err, "upstream down")
+	// «IVAN» — тот же ключ кеша, что и «Ivan»
+	assert.Equal(t, [][]string{{"Ivan", "Oleg", "fail"}}, prov.sortedBatches())
+
+	// к провайдеру уходят только промахи; ошибки не кешируются, пустой ответ — да
+	got = p.LookupBatch(ctx, []string{"Ivan", "Anna", "oleg", "fail"})
+	assert.Equal(t, 40, got[0].Value)
+	assert.Equal(t, 30, got[1].Value)
+	assert.Nil(t, got[2].Value)
+	assert.Equal(t, [][]string{{"Ivan", "Oleg", "fail"}, {"Anna", "fail"}}, prov.sortedBatches())
+	st := cache.Stats()
+	assert.Equal(t, int64(5), st.Misses)
+	assert.Equal(t, int64(2), st.MemoryHits)
+	assert.Equal(t, int64(1), st.NegativeHits)
+
+	// без пакетов у провайдера — запросы по одному
+	single := cache.Wrap(&stubProvider{name: "single", attr: AttrGender, value: "male"}).(BatchProvider)
+	assert.Equal(t, 1, single.BatchSize())
+}
+
+func TestCacheKey_CountryHint(t *testing.T) {
+	providers, err := Providers([]ProviderConfig{
+		{Name: "agify", BaseURL: "https://api.agify.io/?country_id=us", Enabled: true},
+		{Name: "genderize", BaseURL: "https://api.genderize.io/", Enabled: true},
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "agify:US:anna maria", cacheKey(providers[0], "  Anna   MARIA "))
+	assert.Equal(t, "genderize::anna", cacheKey(providers[1], "Anna"))
+}
+
+// seqTransport отдаёт ответы по очереди, последний — на все остальные запросы.
+type seqTransport struct {
+	mu        sync.Mutex
+	responses []func() (*http.Response, error)
+	calls     int
+}
+
+func (s *seqTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := min(s.calls, len(s.responses)-1)
+	s.calls++
+	return s.responses[i]()
+}
+
+func (s *seqTransport) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func status(code int, header ...string) func() (*http.Response, error) {
+	return func() (*http.Response, error) {
+		resp := makeResp(map[string]int{"age": 30}, code)
+		for i := 0; i+1 < len(header); i += 2 {
+			resp.Header.Set(header[i], header[i+1])
+		}
+		return resp, nil
+	}
+}
+
+func newAgify(t *testing.T, st http.RoundTripper, retry RetryConfig, br BreakerConfig) Provider {
+	providers, err := Providers([]ProviderConfig{{
+		Name: "agify", BaseURL: "https://api.agify.io/", Enabled: true, Retry: retry, Breaker: br,
+	}}, st)
+	require.NoError(t, err)
+	return providers[0]
+}
+
+func TestRetry(t *testing.T) {
+	retry := RetryConfig{Retries: 2, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+	netErr := func() (*http.Response, error) { return nil, errors.New("connection reset") }
+
+	tests := []struct {
+		name      string
+		responses []func() (*http.Response, error)
+		wantErr   bool
+		wantCalls int
+	}{
+		{"5xx then ok", []func() (*http.Response, error){status(503), status(200)}, false, 2},
+		{"network error then ok", []func() (*http.Response, error){netErr, status(200)}, false, 2},
+		{"429 honors Retry-After", []func() (*http.Response, error){status(429, "Retry-After", "0"), status(200)}, false, 2},
+		{"gives up after retries", []func() (*http.Response, error){status(500)}, true, 3},
+		{"4xx not retried", []func() (*http.Response, error){status(401)}, true, 1},
+		{"Retry-After above max", []func() (*http.Response, error){status(429, "Retry-After", "60"), status(200)}, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &seqTransport{responses: tt.responses}
+			res, err := newAgify(t, st, retry, BreakerConfig{}).Lookup(context.Background(), "Ivan")
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, 30, res.Value)
+			}
+			assert.Equal(t, tt.wantCalls, st.count())
+		})
+	}
+
+	t.Run("status error keeps code", func(t *testing.T) {
+		st := &seqTransport{responses: []func() (*http.Response, error){status(429, "Retry-After", "120")}}
+		_, err := newAgify(t, st, RetryConfig{}, BreakerConfig{}).Lookup(context.Background(), "Ivan")
+		var se *StatusError
+		require.ErrorAs(t, err, &se)
+		assert.Equal(t, StatusError{Code: 429, RetryAfter: 2 * time.Minute}, *se)
+	})
+}
+
+func TestRetry_Budget(t *testing.T) {
+	retry := RetryConfig{Retries: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Second, Budget: 500 * time.Millisecond}
+
+	t.Run("Retry-After beyond budget", func(t *testing.T) {
+		st := &seqTransport{responses: []func() (*http.Response, error){status(429, "Retry-After", "2"), status(200)}}
+		start := time.Now()
+		_, err := newAgify(t, st, retry, BreakerConfig{}).Lookup(context.Background(), "Ivan")
+		var se *StatusError
+		require.ErrorAs(t, err, &se)
+		assert.Equal(t, 1, st.count())
+		assert.Less(t, time.Since(start), time.Second, "does not wait for a retry it cannot finish")
+	})
+
+	t.Run("caller deadline", func(t *testing.T) {
+		st := &seqTransport{responses: []func() (*http.Response, error){status(429, "Retry-After", "1"), status(200)}}
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		_, err := newAgify(t, st, RetryConfig{Retries: 3, MaxDelay: 10 * time.Second}, BreakerConfig{}).Lookup(ctx, "Ivan")
+		assert.Error(t, err)
+		assert.Equal(t, 1, st.count())
+	})
+
+	t.Run("retries within budget", func(t *testing.T) {
+		st := &seqTransport{responses: []func() (*http.Response, error){status(503), status(200)}}
+		res, err := newAgify(t, st, retry, BreakerConfig{}).Lookup(context.Background(), "Ivan")
+		require.NoError(t, err)
+		assert.Equal(t, 30, res.Value)
+		assert.Equal(t, 2, st.count())
+	})
+}
+
+func TestRetryConfig_Delay(t *testing.T) {
+	c := RetryConfig{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, upper := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		d, ok := c.delay(attempt, errors.New("x"))
+		require.True(t, ok)
+		assert.GreaterOrEqual(t, d, upper*time.Millisecond/2)
+		assert.LessOrEqual(t, d, upper*time.Millisecond)
+	}
+	d, ok := c.delay(0, &StatusError{Code: 429, RetryAfter: 500 * time.Millisecond})
+	assert.True(t, ok)
+	assert.Equal(t, 500*time.Millisecond, d)
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 90*time.Second, parseRetryAfter(now.Add(90*time.Second).Format(http.TimeFormat), now))
+	assert.Zero(t, parseRetryAfter("soon", now))
+}
+
+func TestBreaker(t *testing.T) {
+	st := &seqTransport{responses: []func() (*http.Response, error){status(500), status(500), status(200)}}
+	p := newAgify(t, st, RetryConfig{}, BreakerConfig{Threshold: 2, Cooldown: time.Minute})
+	br := p.(*agify).breaker
+	now := time.Now()
+	br.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := p.Lookup(ctx, "Ivan")
+		var se *StatusError
+		assert.ErrorAs(t, err, &se)
+	}
+	// провайдер отключён: запрос не отправляется
+	_, err := p.Lookup(ctx, "Ivan")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 2, st.count())
+
+	// после Cooldown пробный запрос удался — провайдер снова включён
+	now = now.Add(time.Minute)
+	for i := 0; i < 2; i++ {
+		res, err := p.Lookup(ctx, "Ivan")
+		require.NoError(t, err)
+		assert.Equal(t, 30, res.Value)
+	}
+	assert.Equal(t, 4, st.count())
+}
+
+func TestBreaker_SingleProbe(t *testing.T) {
+	br := newBreaker(BreakerConfig{Threshold: 1, Cooldown: time.Minute})
+	now := time.Now()
+	br.now = func() time.Time { return now }
+	ctx := context.Background()
+	fail := &StatusError{Code: 500}
+
+	// запрос, начатый до отключения, завершится уже во время пробы
+	ok, stale := br.allow()
+	require.True(t, ok)
+	ok, probe := br.allow()
+	require.True(t, ok)
+	br.done(ctx, fail, probe)
+
+	now = now.Add(time.Minute)
+	ok, probe = br.allow()
+	require.True(t, ok)
+	require.True(t, probe)
+
+	br.done(ctx, fail, stale)
+	ok, _ = br.allow()
+	assert.False(t, ok, "stale request must not free the probe slot")
+
+	br.done(ctx, nil, probe)
+	ok, probe = br.allow()
+	assert.True(t, ok)
+	assert.False(t, probe, "breaker closed after successful probe")
+}
+
+func TestBreaker_IgnoresClientErrors(t *testing.T) {
+	st := &seqTransport{responses: []func() (*http.Response, error){status(400)}}
+	p := newAgify(t, st, RetryConfig{}, BreakerConfig{Threshold: 1, Cooldown: time.Minute})
+	for i := 0; i < 3; i++ {
+		_, err := p.Lookup(context.Background(), "Ivan")
+		assert.NotErrorIs(t, err, ErrCircuitOpen)
+	}
+	assert.Equal(t, 3, st.count())
+}
@@ -0,0 +1,56 @@
+package person
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"person-api/internal/storage"
+)
+
+type cursorPayload struct {
+	Sort   string    `json:"s"`
+	Values []*string `json:"v"`
+}
+
+// encodeCursor упаковывает позицию в непрозрачную для клиента строку.
+// Вместе со значениями сохраняется порядок сортировки, чтобы курсор
+// нельзя было применить к другому порядку.
+func encodeCursor(sort []storage.SortField, last storage.PersonEntity) string {
+	p := cursorPayload{Sort: sortSignature(sort), Values: make([]*string, len(sort))}
+	for i, f := range sort {
+		p.Values[i] = storage.SortValue(last, f.Column)
+	}
+	b, _ := json.Marshal(p)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string, sort []storage.SortField) (storage.Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return storage.Cursor{}, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	var p cursorPayload
+	if err := json.Unmarshal(b, &p); err != nil || len(p.Values) != len(sort) {
+		return storage.Cursor{}, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	if p.Sort != sortSignature(sort) {
+		return storage.Cursor{}, fmt.Errorf("%w: cursor does not match sort", ErrInvalidQuery)
+	}
+	return storage.Cursor{Values: p.Values}, nil
+}
+
+func sortSignature(sort []storage.SortField) string {
+	parts := make([]string, len(sort))
+	for i, f := range sort {
+		parts[i] = f.Column
+		if f.Desc {
+			parts[i] = "-" + parts[i]
+		}
+		if f.NullsFirst {
+			parts[i] += ":nf"
+		}
+	}
+	return strings.Join(parts, ",")
+}
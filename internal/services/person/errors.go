@@ -0,0 +1,69 @@
+package person
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"person-api/internal/storage"
+)
+
+// Ошибки сервиса. Обработчики сопоставляют их статусам HTTP через errors.Is.
+var (
+	// ErrNotFound — человека с таким id нет.
+	ErrNotFound = errors.New("person not found")
+
+	// ErrJobNotFound — задачи импорта нет или она уже удалена.
+	ErrJobNotFound = errors.New("import job not found")
+
+	// ErrInvalidQuery возвращается, когда параметры выборки нельзя применить
+	// (например, повреждённый курсор).
+	ErrInvalidQuery = errors.New("invalid query")
+
+	// ErrValidation — данные отвергнуты хранилищем (ограничения, длина полей).
+	ErrValidation = errors.New("invalid person data")
+
+	// ErrVersionMismatch возвращается, когда ожидаемая версия записи (If-Match)
+	// не совпала с текущей.
+	ErrVersionMismatch = errors.New("version mismatch")
+
+	// ErrConflict — изменение конфликтует с уже сохранёнными данными.
+	ErrConflict = errors.New("conflict")
+
+	// ErrUnavailable — недоступна база или внешний API обогащения.
+	ErrUnavailable = errors.New("upstream unavailable")
+
+	// ErrTimeout — база или внешний API не ответили вовремя.
+	ErrTimeout = errors.New("upstream timeout")
+)
+
+// storageError переводит ошибки хранилища в ошибки сервиса, сохраняя исходную в цепочке.
+func storageError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, storage.ErrNotFound):
+		return ErrNotFound
+	case errors.Is(err, storage.ErrVersionConflict):
+		return ErrVersionMismatch
+	case errors.Is(err, storage.ErrConflict):
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	case errors.Is(err, storage.ErrInvalid):
+		return fmt.Errorf("%w: %w", ErrValidation, err)
+	case errors.Is(err, storage.ErrUnavailable):
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	case errors.Is(err, storage.ErrTimeout):
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
+
+// enrichmentError классифицирует ошибку внешних API: таймаут или недоступность.
+func enrichmentError(err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("%w: enrichment: %w", ErrTimeout, err)
+	}
+	return fmt.Errorf("%w: enrichment: %w", ErrUnavailable, err)
+}
@@ -0,0 +1,64 @@
+package person
+
+import (
+	"context"
+	"time"
+
+	"person-api/internal/model"
+	"person-api/internal/storage"
+)
+
+// DefaultIdempotencyLease — сколько ключ без ответа считается занятым
+// выполняющимся запросом.
+const DefaultIdempotencyLease = time.Minute
+
+// WithIdempotencyLease задаёт, через сколько ключ без ответа можно занять
+// снова: первый запрос, скорее всего, прервался вместе с процессом.
+// 0 — ключ без ответа остаётся занятым, пока его не удалит очистка.
+func WithIdempotencyLease(d time.Duration) Option {
+	return func(s *personService) { s.idempotencyLease = d }
+}
+
+func (s *personService) ClaimIdempotencyKey(ctx context.Context, key, fingerprint string) (model.IdempotencyRecord, bool, error) {
+	var staleBefore time.Time
+	if s.idempotencyLease > 0 {
+		staleBefore = time.Now().Add(-s.idempotencyLease)
+	}
+	k, claimed, err := s.st.ClaimIdempotencyKey(ctx, key, fingerprint, staleBefore)
+	if err != nil {
+		return model.IdempotencyRecord{}, false, storageError(err)
+	}
+	return model.IdempotencyRecord{
+		Fingerprint: k.Fingerprint,
+		Status:      k.Status,
+		Header:      k.Header,
+		Body:        k.Body,
+		Claim:       k.Claim,
+	}, claimed, nil
+}
+
+func (s *personService) CompleteIdempotencyKey(ctx context.Context, key string, rec model.IdempotencyRecord) error {
+	err := s.st.CompleteIdempotencyKey(ctx, storage.IdempotencyKey{
+		Key:    key,
+		Status: rec.Status,
+		Header: rec.Header,
+		Body:   rec.Body,
+		Claim:  rec.Claim,
+	})
+	return storageError(err)
+}
+
+func (s *personService) ReleaseIdempotencyKey(ctx context.Context, key string, claim int64) error {
+	return storageError(s.st.DeleteIdempotencyKey(ctx, key, claim))
+}
+
+// PurgeIdempotencyKeys удаляет ключи старше ttl: после этого запрос с тем же
+// ключом выполняется заново.
+func (s *personService) PurgeIdempotencyKeys(ctx context.Context, ttl time.Duration) (int64, error) {
+	n, err := s.st.PurgeIdempotencyKeys(ctx, time.Now().Add(-ttl))
+	if err != nil {
+		return 0, storageError(err)
+	}
+	s.logger.Info("PurgeIdempotencyKeys", "purged", n)
+	return n, nil
+}
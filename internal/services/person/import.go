@@ -0,0 +1,237 @@
+package person
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"person-api/internal/model"
+	"person-api/internal/storage"
+)
+
+const (
+	// importChunk — сколько строк проверяется и создаётся за один шаг;
+	// после каждого шага обновляется прогресс фоновой задачи.
+	importChunk = 100
+	// importJobRetention — сколько хранить завершённые задачи импорта.
+	importJobRetention = 24 * time.Hour
+)
+
+func (s *personService) ImportPersons(ctx context.Context, rows []model.ImportRow, opts model.ImportOptions) (model.ImportReport, error) {
+	s.logger.Info("ImportPersons", "rows", len(rows), "opts", opts)
+	return s.importRows(ctx, rows, opts, func(int) {})
+}
+
+func (s *personService) StartImport(ctx context.Context, rows []model.ImportRow, opts model.ImportOptions) model.ImportJob {
+	job := s.jobs.add(len(rows))
+	s.logger.Info("StartImport", "job", job.ID, "rows", len(rows), "opts", opts)
+	// задача переживает запрос, который её создал
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		s.jobs.update(job.ID, func(j *model.ImportJob) { j.Status = model.JobRunning })
+		report, err := s.importRows(ctx, rows, opts, func(n int) {
+			s.jobs.update(job.ID, func(j *model.ImportJob) { j.Processed = n })
+		})
+		if err != nil {
+			s.logger.Error("import job failed", "job", job.ID, "err", err)
+		}
+		s.jobs.finish(job.ID, report, err)
+	}()
+	return job
+}
+
+func (s *personService) GetImportJob(_ context.Context, id string) (model.ImportJob, error) {
+	job, ok := s.jobs.get(id)
+	if !ok {
+		return model.ImportJob{}, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// importRows обрабатывает строки шагами по importChunk и после каждого шага
+// сообщает progress число обработанных строк.
+func (s *personService) importRows(ctx context.Context, rows []model.ImportRow, opts model.ImportOptions, progress func(int)) (model.ImportReport, error) {
+	report := model.ImportReport{DryRun: opts.DryRun, Total: len(rows), Rows: make([]model.ImportRowResult, len(rows))}
+	// первая строка файла с таким ФИО
+	seen := make(map[string]int, len(rows))
+
+	for start := 0; start < len(rows); start += importChunk {
+		end := min(start+importChunk, len(rows))
+		// строки шага, которые сверяются с базой одним запросом
+		var lookup []model.CreatePersonCommand
+		for i := start; i < end; i++ {
+			row, res := rows[i], &report.Rows[i]
+			res.Line = row.Line
+			if len(row.Errors) > 0 {
+				res.Status, res.Errors = model.ImportInvalid, row.Errors
+				continue
+			}
+			res.Status = model.ImportValid
+			key := duplicateKey(row.Cmd)
+			if line, ok := seen[key]; ok {
+				res.Status, res.DuplicateOfLine = model.ImportDuplicate, line
+			} else {
+				seen[key] = row.Line
+				lookup = append(lookup, row.Cmd)
+			}
+		}
+		existing, err := s.findDuplicates(ctx, lookup)
+		if err != nil {
+			return model.ImportReport{}, err
+		}
+		var create []int
+		for i := start; i < end; i++ {
+			res := &report.Rows[i]
+			if res.Status == model.ImportInvalid {
+				continue
+			}
+			if id, ok := existing[duplicateKey(rows[i].Cmd)]; ok && res.Status == model.ImportValid {
+				res.Status, res.DuplicateOfID = model.ImportDuplicate, id
+			}
+			if res.Status == model.ImportValid || opts.AllowDuplicates {
+				create = append(create, i)
+			}
+		}
+
+		if !opts.DryRun && len(create) > 0 {
+			cmds := make([]model.CreatePersonCommand, len(create))
+			for k, i := range create {
+				cmds[k] = rows[i].Cmd
+			}
+			for k, r := range s.createBatch(ctx, cmds, opts.Enrich) {
+				res := &report.Rows[create[k]]
+				if r.Err != nil {
+					res.Status, res.Err = model.ImportFailed, r.Err
+					continue
+				}
+				res.Status, res.PersonID = model.ImportCreated, r.Person.ID
+			}
+		}
+		progress(end)
+	}
+
+	for _, r := range report.Rows {
+		switch r.Status {
+		case model.ImportValid:
+			report.Valid++
+		case model.ImportInvalid:
+			report.Invalid++
+		case model.ImportDuplicate:
+			report.Duplicates++
+		case model.ImportCreated:
+			report.Created++
+		case model.ImportFailed:
+			report.Failed++
+		}
+	}
+	return report, nil
+}
+
+// findDuplicates ищет сохранённые записи с тем же ФИО без учёта регистра
+// одним запросом; ключ — duplicateKey, значение — id самой ранней записи.
+func (s *personService) findDuplicates(ctx context.Context, cmds []model.CreatePersonCommand) (map[string]int64, error) {
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+	names := make([]storage.FullName, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = storage.FullName{Name: cmd.Name, Surname: cmd.Surname, Patronymic: deref(cmd.Patronymic)}
+	}
+	found, err := s.st.FindPersonsByNames(ctx, names)
+	if err != nil {
+		return nil, storageError(err)
+	}
+	out := make(map[string]int64, len(found))
+	for _, p := range found {
+		key := fullNameKey(p.Name, p.Surname, deref(p.Patronymic))
+		if _, ok := out[key]; !ok {
+			out[key] = p.ID
+		}
+	}
+	return out, nil
+}
+
+func duplicateKey(cmd model.CreatePersonCommand) string {
+	return fullNameKey(cmd.Name, cmd.Surname, deref(cmd.Patronymic))
+}
+
+func fullNameKey(name, surname, patronymic string) string {
+	return strings.ToLower(name + "\x00" + surname + "\x00" + patronymic)
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// importJobs хранит задачи импорта в памяти процесса: после перезапуска они теряются.
+type importJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*model.ImportJob
+	// finished — когда задача завершилась; по нему удаляются старые задачи.
+	finished map[string]time.Time
+}
+
+func newImportJobs() *importJobs {
+	return &importJobs{jobs: make(map[string]*model.ImportJob), finished: make(map[string]time.Time)}
+}
+
+func (j *importJobs) add(total int) model.ImportJob {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	job := &model.ImportJob{
+		ID:        hex.EncodeToString(b[:]),
+		Status:    model.JobPending,
+		Total:     total,
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for id, at := range j.finished {
+		if time.Since(at) > importJobRetention {
+			delete(j.jobs, id)
+			delete(j.finished, id)
+		}
+	}
+	j.jobs[job.ID] = job
+	return *job
+}
+
+func (j *importJobs) update(id string, fn func(*model.ImportJob)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if job, ok := j.jobs[id]; ok {
+		fn(job)
+	}
+}
+
+func (j *importJobs) finish(id string, report model.ImportReport, err error) {
+	now := time.Now()
+	j.update(id, func(job *model.ImportJob) {
+		finishedAt := now.Format(time.RFC3339)
+		job.FinishedAt = &finishedAt
+		if err != nil {
+			job.Status, job.Err = model.JobFailed, err
+			return
+		}
+		job.Status, job.Report, job.Processed = model.JobDone, &report, job.Total
+	})
+	j.mu.Lock()
+	j.finished[id] = now
+	j.mu.Unlock()
+}
+
+func (j *importJobs) get(id string) (model.ImportJob, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	if !ok {
+		return model.ImportJob{}, false
+	}
+	return *job, true
+}
@@ -0,0 +1,33 @@
+package person
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// RunPurger раз в interval окончательно удаляет записи, помеченные удалёнными
+// дольше retention, и ключи идемпотентности старше keyTTL. Нулевой срок
+// отключает соответствующую очистку. Блокируется до отмены ctx.
+func RunPurger(ctx context.Context, logger *slog.Logger, svc Service, interval, retention, keyTTL time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if retention > 0 {
+				if _, err := svc.PurgeDeleted(ctx, retention); err != nil && ctx.Err() == nil {
+					logger.Error("purge deleted persons", "err", err)
+				}
+			}
+			if keyTTL > 0 {
+				if _, err := svc.PurgeIdempotencyKeys(ctx, keyTTL); err != nil && ctx.Err() == nil {
+					logger.Error("purge idempotency keys", "err", err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package person
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"person-api/internal/model"
+	"person-api/internal/services/enrichment"
+	"person-api/internal/storage"
+)
+
+// jobLease — сколько задание очереди обогащения закреплено за обработчиком.
+// Если обработчик упал, по истечении аренды задание берёт другой.
+const jobLease = 5 * time.Minute
+
+// jobTimeout — сколько выполняются задания: запас до конца аренды оставлен,
+// чтобы успеть записать итог, пока задание не взял другой обработчик.
+const jobTimeout = jobLease - 30*time.Second
+
+// WithAsyncEnrichment включает асинхронное обогащение: записи сохраняются
+// сразу с атрибутами в статусе pending, а обогащает их RunEnrichmentWorkers.
+func WithAsyncEnrichment() Option {
+	return func(s *personService) { s.async = true }
+}
+
+// queueing сообщает, ставить ли новые записи в очередь обогащения.
+func (s *personService) queueing() bool {
+	return s.async && len(s.es.Attributes()) > 0
+}
+
+// queued — запись из команды, атрибуты которой ждут очереди обогащения.
+func (s *personService) queued(cmd model.CreatePersonCommand) storage.PersonEntity {
+	pe := storage.PersonEntity{Name: cmd.Name, Surname: cmd.Surname, Patronymic: cmd.Patronymic}
+	en := make(map[string]model.AttributeSource)
+	for _, attr := range s.es.Attributes() {
+		en[attr] = model.AttributeSource{Status: model.EnrichmentPending}
+	}
+	setEnrichment(&pe, en)
+	return pe
+}
+
+func (s *personService) createQueued(ctx context.Context, e storage.PersonEntity) (storage.PersonEntity, error) {
+	saved, err := s.st.CreatePersonsQueued(ctx, []storage.PersonEntity{e})
+	if err != nil {
+		return storage.PersonEntity{}, err
+	}
+	return saved[0], nil
+}
+
+// queuedAttributes — атрибуты, которые ждут очереди (см. awaitsQueue).
+func queuedAttributes(en map[string]model.AttributeSource) []string {
+	var attrs []string
+	for attr, src := range en {
+		if awaitsQueue(src) {
+			attrs = append(attrs, attr)
+		}
+	}
+	sort.Strings(attrs)
+	return attrs
+}
+
+// awaitsQueue: pending без RetryAt (повторы с RetryAt выполняет RepairEnrichment).
+func awaitsQueue(src model.AttributeSource) bool {
+	return src.Status == model.EnrichmentPending && src.RetryAt == nil
+}
+
+// jobBatchSize — сколько заданий обработчик берёт за раз: имена их записей
+// уходят провайдерам общими пакетами.
+const jobBatchSize = 50
+
+// ProcessEnrichmentJobs берёт из очереди до jobBatchSize заданий и выполняет
+// их. Неудачное задание повторяется по s.repair, после последней попытки
+// переходит в dead, а его атрибуты — в failed. Возвращает число взятых заданий.
+func (s *personService) ProcessEnrichmentJobs(ctx context.Context) (int, error) {
+	jobs, err := s.st.ClaimEnrichmentJobs(ctx, jobBatchSize, jobLease)
+	if err != nil {
+		return 0, storageError(err)
+	}
+	if len(jobs) == 0 {
+		return 0, nil
+	}
+	jobCtx, cancel := context.WithTimeout(ctx, jobTimeout)
+	defer cancel()
+	var firstErr error
+	for i, err := range s.runJobs(jobCtx, jobs) {
+		if err := s.finishJob(ctx, jobs[i], err); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return len(jobs), storageError(firstErr)
+}
+
+// finishJob удаляет, повторяет или хоронит задание по итогу runJobs. Если
+// аренда истекла и задание уже взял другой обработчик, задание не меняется.
+func (s *personService) finishJob(ctx context.Context, job storage.EnrichmentJob, err error) error {
+	switch {
+	case err == nil:
+		return s.st.CompleteEnrichmentJob(ctx, job)
+	case ctx.Err() != nil:
+		// сервис останавливается: задание сразу возвращается в очередь, не дожидаясь конца аренды
+		return s.st.RetryEnrichmentJob(context.WithoutCancel(ctx), job, time.Now(), err.Error())
+	case job.Attempts >= s.repair.Attempts:
+		s.logger.Warn("ProcessEnrichmentJobs: attempts exhausted", "job", job.ID, "person", job.PersonID, "err", err)
+		if ferr := s.failQueued(ctx, job, err); ferr != nil {
+			s.logger.Warn("ProcessEnrichmentJobs: mark attributes failed", "person", job.PersonID, "err", ferr)
+		}
+		return s.st.BuryEnrichmentJob(ctx, job, err.Error())
+	default:
+		s.logger.Info("ProcessEnrichmentJobs: retry scheduled", "job", job.ID, "attempts", job.Attempts, "err", err)
+		return s.st.RetryEnrichmentJob(ctx, job, time.Now().Add(s.repair.delay(job.Attempts)), err.Error())
+	}
+}
+
+// runJobs обогащает атрибуты записей jobs, ждущие очереди, одним вызовом
+// EnrichBatch. errs[i] != nil — часть атрибутов записи получить не удалось и
+// задание нужно повторить.
+func (s *personService) runJobs(ctx context.Context, jobs []storage.EnrichmentJob) []error {
+	errs := make([]error, len(jobs))
+	var idx []int
+	var reqs []enrichment.Request
+	for i, job := range jobs {
+		e, err := s.st.GetPersonByID(ctx, job.PersonID)
+		if errors.Is(err, storage.ErrNotFound) {
+			// запись удалена: задание не нужно, RestorePerson поставит новое
+			continue
+		}
+		if err != nil {
+			errs[i] = storageError(err)
+			continue
+		}
+		attrs := queuedAttributes(fromStorageEnrichment(e.Enrichment))
+		if len(attrs) == 0 {
+			continue
+		}
+		idx = append(idx, i)
+		reqs = append(reqs, enrichment.Request{Person: model.Person{Name: e.Name, Surname: e.Surname, Patronymic: e.Patronymic}, Attrs: attrs})
+	}
+	if len(reqs) == 0 {
+		return errs
+	}
+	got, err := s.es.EnrichBatch(ctx, reqs)
+	for k, i := range idx {
+		if err != nil {
+			errs[i] = enrichmentError(err)
+			continue
+		}
+		errs[i] = s.applyJob(ctx, jobs[i], reqs[k].Attrs, got[k])
+	}
+	return errs
+}
+
+// applyJob сохраняет полученные атрибуты attrs; не полученные ждут следующей
+// попытки задания. Запись перечитывается под блокировкой: атрибут, который
+// за время запроса к провайдерам задали вручную, не трогается.
+func (s *personService) applyJob(ctx context.Context, job storage.EnrichmentJob, attrs []string, got model.Person) error {
+	var failures []string
+	_, err := s.st.UpdateEnrichment(ctx, job.PersonID, func(e *storage.PersonEntity) {
+		en := fromStorageEnrichment(e.Enrichment)
+		for _, attr := range attrs {
+			if !awaitsQueue(en[attr]) {
+				continue
+			}
+			src := got.Enrichment[attr]
+			if src.Status == model.EnrichmentComplete {
+				setAttribute(e, attr, got)
+			} else {
+				// ошибку видно в ответе API до следующей попытки
+				src.Status = model.EnrichmentPending
+				src.Attempts = job.Attempts
+				failures = append(failures, src.Error)
+			}
+			en[attr] = src
+		}
+		setEnrichment(e, en)
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		// запись удалили во время запроса: RestorePerson поставит новое задание
+		return nil
+	}
+	if err != nil {
+		return storageError(err)
+	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// failQueued переводит атрибуты, ждущие очереди, в failed.
+func (s *personService) failQueued(ctx context.Context, job storage.EnrichmentJob, cause error) error {
+	_, err := s.st.UpdateEnrichment(ctx, job.PersonID, func(e *storage.PersonEntity) {
+		en := fromStorageEnrichment(e.Enrichment)
+		for _, attr := range queuedAttributes(en) {
+			src := en[attr]
+			src.Status = model.EnrichmentFailed
+			src.Attempts = job.Attempts
+			if src.Error == "" {
+				src.Error = cause.Error()
+			}
+			en[attr] = src
+		}
+		setEnrichment(e, en)
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *personService) EnrichmentQueueStats(ctx context.Context) (model.QueueStats, error) {
+	st, err := s.st.EnrichmentQueueStats(ctx)
+	if err != nil {
+		return model.QueueStats{}, storageError(err)
+	}
+	return model.QueueStats{Queued: st.Queued, Running: st.Running, Dead: st.Dead, OldestQueued: st.OldestQueued}, nil
+}
+
+// RunEnrichmentWorkers запускает workers обработчиков очереди обогащения:
+// каждый берёт задания пачками подряд, а пустую очередь проверяет раз в poll.
+// Блокируется до отмены ctx и завершения текущих заданий.
+func RunEnrichmentWorkers(ctx context.Context, logger *slog.Logger, svc Service, workers int, poll time.Duration) {
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				n, err := svc.ProcessEnrichmentJobs(ctx)
+				if err != nil && ctx.Err() == nil {
+					logger.Error("enrichment jobs", "err", err)
+				}
+				if n > 0 && err == nil {
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(poll):
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,189 @@
+package person
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"person-api/internal/model"
+	"person-api/internal/services/enrichment"
+	"person-api/internal/storage"
+)
+
+// RepairPolicy — повторное обогащение атрибутов, которые не удалось получить
+// при создании записи.
+type RepairPolicy struct {
+	// Attempts — сколько всего попыток, считая первую; после последней
+	// атрибут получает статус failed.
+	Attempts int
+	// Delay — пауза после первой неудачи; дальше она удваивается до MaxDelay.
+	Delay    time.Duration
+	MaxDelay time.Duration
+}
+
+// DefaultRepairPolicy используется, если NewPersonService не передан WithRepairPolicy.
+var DefaultRepairPolicy = RepairPolicy{Attempts: 5, Delay: time.Minute, MaxDelay: time.Hour}
+
+type Option func(*personService)
+
+func WithRepairPolicy(p RepairPolicy) Option {
+	return func(s *personService) { s.repair = p }
+}
+
+// repairBatchSize — сколько записей RepairEnrichment берёт за раз.
+const repairBatchSize = 100
+
+// schedule назначает повтор атрибуту, который не удалось получить: статус
+// pending и RetryAt, либо failed, если попытки исчерпаны. attempts — неудачи
+// до этой.
+func (p RepairPolicy) schedule(src model.AttributeSource, attempts int, now time.Time) model.AttributeSource {
+	if src.Status != model.EnrichmentFailed {
+		return src
+	}
+	src.Attempts = attempts + 1
+	if src.Attempts >= p.Attempts {
+		return src
+	}
+	at := now.Add(p.delay(src.Attempts))
+	src.Status = model.EnrichmentPending
+	src.RetryAt = &at
+	return src
+}
+
+// delay — пауза после attempts неудач подряд (attempts >= 1).
+func (p RepairPolicy) delay(attempts int) time.Duration {
+	d := p.Delay << (attempts - 1)
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// setEnrichment записывает в e статусы обогащения и время ближайшего повтора.
+func setEnrichment(e *storage.PersonEntity, en map[string]model.AttributeSource) {
+	e.Enrichment = toStorageEnrichment(en)
+	e.EnrichmentRetryAt = e.Enrichment.NextRetry()
+}
+
+// setAttribute копирует в e значение атрибута attr из обогащённой p.
+func setAttribute(e *storage.PersonEntity, attr string, p model.Person) {
+	switch attr {
+	case enrichment.AttrAge:
+		e.Age = p.Age
+	case enrichment.AttrGender:
+		e.Gender = p.Gender
+	case enrichment.AttrNationality:
+		e.Nationality = p.Nationality
+	}
+}
+
+// RepairEnrichment повторно запрашивает атрибуты со статусом pending, чей
+// RetryAt уже наступил, и возвращает число обновлённых записей. Имена всех
+// записей уходят провайдерам одним пакетом. Ошибка одной записи не мешает
+// остальным.
+func (s *personService) RepairEnrichment(ctx context.Context) (int, error) {
+	now := time.Now()
+	items, err := s.st.ListEnrichmentRetries(ctx, now, repairBatchSize)
+	if err != nil {
+		return 0, storageError(err)
+	}
+	due := make([][]string, len(items))
+	var reqs []enrichment.Request
+	for i, e := range items {
+		due[i] = dueAttributes(fromStorageEnrichment(e.Enrichment), now)
+		if len(due[i]) > 0 {
+			reqs = append(reqs, enrichment.Request{Person: model.Person{Name: e.Name, Surname: e.Surname, Patronymic: e.Patronymic}, Attrs: due[i]})
+		}
+	}
+	var got []model.Person
+	if len(reqs) > 0 {
+		if got, err = s.es.EnrichBatch(ctx, reqs); err != nil {
+			return 0, enrichmentError(err)
+		}
+	}
+	n := 0
+	for i, e := range items {
+		var enriched model.Person
+		if len(due[i]) > 0 {
+			enriched, got = got[0], got[1:]
+		}
+		if err := s.repairPerson(ctx, e.ID, due[i], enriched, now); err != nil {
+			if ctx.Err() != nil {
+				return n, ctx.Err()
+			}
+			s.logger.Warn("RepairEnrichment", "id", e.ID, "err", err)
+			continue
+		}
+		n++
+	}
+	if n > 0 {
+		s.logger.Info("RepairEnrichment", "repaired", n)
+	}
+	return n, nil
+}
+
+// dueAttributes — атрибуты, которые пора повторить (см. isDue).
+func dueAttributes(en map[string]model.AttributeSource, now time.Time) []string {
+	var attrs []string
+	for attr, src := range en {
+		if isDue(src, now) {
+			attrs = append(attrs, attr)
+		}
+	}
+	sort.Strings(attrs)
+	return attrs
+}
+
+// isDue: pending, и RetryAt наступил к now.
+func isDue(src model.AttributeSource, now time.Time) bool {
+	return src.Status == model.EnrichmentPending && src.RetryAt != nil && !src.RetryAt.After(now)
+}
+
+// repairPerson сохраняет ответ got по атрибутам attrs. Запись перечитывается
+// под блокировкой: атрибут, который за время запроса задали вручную, не
+// трогается; версия и история не меняются.
+func (s *personService) repairPerson(ctx context.Context, id int64, attrs []string, got model.Person, now time.Time) error {
+	_, err := s.st.UpdateEnrichment(ctx, id, func(e *storage.PersonEntity) {
+		en := fromStorageEnrichment(e.Enrichment)
+		for _, attr := range attrs {
+			if !isDue(en[attr], now) {
+				continue
+			}
+			src := s.repair.schedule(got.Enrichment[attr], en[attr].Attempts, now)
+			en[attr] = src
+			if src.Status == model.EnrichmentComplete {
+				setAttribute(e, attr, got)
+			}
+		}
+		// без attrs колонка устарела: просто пересчитываем её
+		setEnrichment(e, en)
+	})
+	return storageError(err)
+}
+
+// RunEnrichmentRepairer раз в interval вызывает RepairEnrichment, пока есть
+// записи, которые пора дообогатить. Блокируется до отмены ctx.
+func RunEnrichmentRepairer(ctx context.Context, logger *slog.Logger, svc Service, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				n, err := svc.RepairEnrichment(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						logger.Error("repair enrichment", "err", err)
+					}
+					break
+				}
+				if n < repairBatchSize {
+					break
+				}
+			}
+		}
+	}
+}
@@ -2,6 +2,8 @@ package person
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"person-api/internal/services/enrichment"
 	"time"
 
@@ -12,28 +14,181 @@ import (
 
 type Service interface {
 	CreatePerson(ctx context.Context, cmd model.CreatePersonCommand) (model.Person, error)
+	// CreatePersons создаёт записи пакетом; ошибка одной записи не мешает
+	// остальным. Результаты идут в порядке cmds.
+	CreatePersons(ctx context.Context, cmds []model.CreatePersonCommand) []model.CreateResult
 	UpdatePerson(ctx context.Context, id int64, cmd model.UpdatePersonCommand) (model.Person, error)
-	DeletePerson(ctx context.Context, id int64) error
+	DeletePerson(ctx context.Context, id int64, cmd model.DeletePersonCommand) error
+	RestorePerson(ctx context.Context, id int64) (model.Person, error)
+	PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error)
+	// RepairEnrichment повторно запрашивает атрибуты, которые не удалось
+	// получить, и возвращает число обновлённых записей.
+	RepairEnrichment(ctx context.Context) (int, error)
+	// ProcessEnrichmentJobs выполняет пачку заданий очереди обогащения и
+	// возвращает их число; 0 — готовых заданий нет.
+	ProcessEnrichmentJobs(ctx context.Context) (int, error)
+	EnrichmentQueueStats(ctx context.Context) (model.QueueStats, error)
 	GetPersonByID(ctx context.Context, id int64) (model.Person, error)
+	GetPersonHistory(ctx context.Context, id int64) ([]model.HistoryEntry, error)
 	ListPersons(ctx context.Context, q model.PersonQuery) (model.PagedPersons, error)
+	// ImportPersons сверяет проверенные строки файла с базой и между собой и,
+	// если это не DryRun, создаёт записи. Отчёт идёт в порядке rows.
+	ImportPersons(ctx context.Context, rows []model.ImportRow, opts model.ImportOptions) (model.ImportReport, error)
+	// StartImport выполняет ImportPersons в фоне; ход выполнения отдаёт GetImportJob.
+	StartImport(ctx context.Context, rows []model.ImportRow, opts model.ImportOptions) model.ImportJob
+	GetImportJob(ctx context.Context, id string) (model.ImportJob, error)
+	// ExportPersons передаёт в fn все записи, подходящие под фильтры и
+	// сортировку q, без пагинации. Ошибка fn прерывает выгрузку.
+	ExportPersons(ctx context.Context, q model.PersonQuery, fn func(model.Person) error) error
+	// EnrichmentCacheStats — статистика кеша ответов провайдеров обогащения.
+	EnrichmentCacheStats() model.CacheStats
+	// ClaimIdempotencyKey занимает ключ за запросом с отпечатком fingerprint и
+	// возвращает true. Если ключ уже занят, возвращает его запись и false.
+	ClaimIdempotencyKey(ctx context.Context, key, fingerprint string) (model.IdempotencyRecord, bool, error)
+	// CompleteIdempotencyKey сохраняет ответ для повторов запроса.
+	CompleteIdempotencyKey(ctx context.Context, key string, rec model.IdempotencyRecord) error
+	// ReleaseIdempotencyKey освобождает ключ с номером захвата claim, если запрос не удался.
+	ReleaseIdempotencyKey(ctx context.Context, key string, claim int64) error
+	PurgeIdempotencyKeys(ctx context.Context, ttl time.Duration) (int64, error)
 }
 
 type personService struct {
 	logger slog.Logger
 	es     enrichment.Service
 	st     storage.Storage
+	jobs   *importJobs
+	repair RepairPolicy
+	// async — обогащать новые записи через очередь, а не в запросе.
+	async bool
+	// idempotencyLease — через сколько ключ без ответа можно занять снова.
+	idempotencyLease time.Duration
 }
 
-func NewPersonService(logger *slog.Logger, es enrichment.Service, st storage.Storage) Service {
-	return &personService{logger: *logger, es: es, st: st}
+func NewPersonService(logger *slog.Logger, es enrichment.Service, st storage.Storage, opts ...Option) Service {
+	s := &personService{
+		logger: *logger, es: es, st: st, jobs: newImportJobs(),
+		repair: DefaultRepairPolicy, idempotencyLease: DefaultIdempotencyLease,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *personService) CreatePerson(ctx context.Context, cmd model.CreatePersonCommand) (model.Person, error) {
 	s.logger.Info("CreatePerson", "cmd", cmd)
+	if s.queueing() {
+		saved, err := s.createQueued(ctx, s.queued(cmd))
+		if err != nil {
+			return model.Person{}, storageError(err)
+		}
+		return mapEntity(saved), nil
+	}
+	pe, err := s.enrich(ctx, cmd)
+	if err != nil {
+		return model.Person{}, err
+	}
+	saved, err := s.st.CreatePerson(ctx, pe)
+	if err != nil {
+		return model.Person{}, storageError(err)
+	}
+	return mapEntity(saved), nil
+}
+
+func (s *personService) CreatePersons(ctx context.Context, cmds []model.CreatePersonCommand) []model.CreateResult {
+	s.logger.Info("CreatePersons", "count", len(cmds))
+	return s.createBatch(ctx, cmds, true)
+}
+
+// createBatch при enrich обогащает записи одним пакетом запросов к
+// провайдерам (в асинхронном режиме — ставит в очередь), затем сохраняет их
+// одним запросом.
+func (s *personService) createBatch(ctx context.Context, cmds []model.CreatePersonCommand, enrich bool) []model.CreateResult {
+	results := make([]model.CreateResult, len(cmds))
+	entities := make([]storage.PersonEntity, len(cmds))
+	insert, insertOne := s.st.CreatePersons, s.st.CreatePerson
+	switch {
+	case enrich && s.queueing():
+		for i, cmd := range cmds {
+			entities[i] = s.queued(cmd)
+		}
+		insert, insertOne = s.st.CreatePersonsQueued, s.createQueued
+	case enrich:
+		var err error
+		if entities, err = s.enrichBatch(ctx, cmds); err != nil {
+			for i := range results {
+				results[i].Err = err
+			}
+			return results
+		}
+	default:
+		for i, cmd := range cmds {
+			entities[i] = storage.PersonEntity{Name: cmd.Name, Surname: cmd.Surname, Patronymic: cmd.Patronymic}
+		}
+	}
+	if len(entities) == 0 {
+		return results
+	}
+
+	saved, err := insert(ctx, entities)
+	if errors.Is(err, storage.ErrInvalid) || errors.Is(err, storage.ErrConflict) {
+		// база отвергла данные одной из записей: сохраняем по одной, чтобы
+		// ошибка досталась только ей
+		s.logger.Warn("CreatePersons: batch rejected, inserting one by one", "err", err)
+		for i := range entities {
+			p, err := insertOne(ctx, entities[i])
+			if err != nil {
+				results[i].Err = storageError(err)
+				continue
+			}
+			results[i].Person = mapEntity(p)
+		}
+		return results
+	}
+	for i := range results {
+		if err != nil {
+			results[i].Err = storageError(err)
+			continue
+		}
+		results[i].Person = mapEntity(saved[i])
+	}
+	return results
+}
+
+// enrich дополняет данные команды возрастом, полом и национальностью.
+// Атрибуты, которые не удалось получить, запрашиваются позже по s.repair.
+func (s *personService) enrich(ctx context.Context, cmd model.CreatePersonCommand) (storage.PersonEntity, error) {
 	pr := model.Person{Name: cmd.Name, Surname: cmd.Surname, Patronymic: cmd.Patronymic}
 	enriched, err := s.es.Enrich(ctx, pr)
 	if err != nil {
-		return model.Person{}, err
+		return storage.PersonEntity{}, enrichmentError(err)
+	}
+	return s.enrichedEntity(enriched, time.Now()), nil
+}
+
+// enrichBatch — enrich для пакета: имена уходят провайдерам пакетами.
+func (s *personService) enrichBatch(ctx context.Context, cmds []model.CreatePersonCommand) ([]storage.PersonEntity, error) {
+	attrs := s.es.Attributes()
+	reqs := make([]enrichment.Request, len(cmds))
+	for i, cmd := range cmds {
+		reqs[i] = enrichment.Request{Person: model.Person{Name: cmd.Name, Surname: cmd.Surname, Patronymic: cmd.Patronymic}, Attrs: attrs}
+	}
+	got, err := s.es.EnrichBatch(ctx, reqs)
+	if err != nil {
+		return nil, enrichmentError(err)
+	}
+	now := time.Now()
+	out := make([]storage.PersonEntity, len(got))
+	for i, enriched := range got {
+		out[i] = s.enrichedEntity(enriched, now)
+	}
+	return out, nil
+}
+
+// enrichedEntity — запись из обогащённой p с повторами для неудавшихся атрибутов.
+func (s *personService) enrichedEntity(enriched model.Person, now time.Time) storage.PersonEntity {
+	for attr, src := range enriched.Enrichment {
+		enriched.Enrichment[attr] = s.repair.schedule(src, 0, now)
 	}
 	pe := storage.PersonEntity{
 		Name:        enriched.Name,
@@ -43,85 +198,259 @@ func (s *personService) CreatePerson(ctx context.Context, cmd model.CreatePerson
 		Gender:      enriched.Gender,
 		Nationality: enriched.Nationality,
 	}
-	saved, err := s.st.CreatePerson(ctx, pe)
-	if err != nil {
-		return model.Person{}, err
-	}
-	return mapEntity(saved), nil
+	setEnrichment(&pe, enriched.Enrichment)
+	return pe
 }
 
+// updateAttempts — сколько раз UpdatePerson без ExpectedVersion перечитывает
+// запись, если её изменили между чтением и записью.
+const updateAttempts = 3
+
 func (s *personService) UpdatePerson(ctx context.Context, id int64, cmd model.UpdatePersonCommand) (model.Person, error) {
 	s.logger.Info("UpdatePerson", "id", id, "cmd", cmd)
-	old, err := s.st.GetPersonByID(ctx, id)
-	if err != nil {
-		return model.Person{}, err
+	for attempt := 1; ; attempt++ {
+		old, err := s.st.GetPersonByID(ctx, id)
+		if err != nil {
+			return model.Person{}, storageError(err)
+		}
+		if cmd.ExpectedVersion != nil && *cmd.ExpectedVersion != old.Version {
+			return model.Person{}, ErrVersionMismatch
+		}
+		if err := applyUpdate(&old, cmd); err != nil {
+			return model.Person{}, err
+		}
+		// версия прочитанной записи защищает от изменений между чтением и записью
+		updated, err := s.st.UpdatePerson(ctx, id, old)
+		if errors.Is(err, storage.ErrVersionConflict) && cmd.ExpectedVersion == nil {
+			// клиент версию не задавал: применяем его изменения к новой версии
+			if attempt < updateAttempts {
+				continue
+			}
+			return model.Person{}, fmt.Errorf("%w: person is being modified concurrently", ErrConflict)
+		}
+		if err != nil {
+			return model.Person{}, storageError(err)
+		}
+		return mapEntity(updated), nil
 	}
-	if cmd.Name != nil {
-		old.Name = *cmd.Name
+}
+
+// applyUpdate переносит в e поля, заданные в cmd.
+func applyUpdate(e *storage.PersonEntity, cmd model.UpdatePersonCommand) error {
+	// имя и фамилия обязательны, очистить их нельзя
+	if cmd.Name.Set {
+		if cmd.Name.Value == nil {
+			return fmt.Errorf("%w: name cannot be null", ErrValidation)
+		}
+		e.Name = *cmd.Name.Value
 	}
-	if cmd.Surname != nil {
-		old.Surname = *cmd.Surname
+	if cmd.Surname.Set {
+		if cmd.Surname.Value == nil {
+			return fmt.Errorf("%w: surname cannot be null", ErrValidation)
+		}
+		e.Surname = *cmd.Surname.Value
 	}
-	if cmd.Patronymic != nil {
-		old.Patronymic = cmd.Patronymic
+	if cmd.Patronymic.Set {
+		e.Patronymic = cmd.Patronymic.Value
 	}
-	if cmd.Age != nil {
-		old.Age = cmd.Age
+	// значение, заданное вручную, больше не результат обогащения
+	if cmd.Age.Set {
+		e.Age = cmd.Age.Value
+		delete(e.Enrichment, enrichment.AttrAge)
 	}
-	if cmd.Gender != nil {
-		old.Gender = cmd.Gender
+	if cmd.Gender.Set {
+		e.Gender = cmd.Gender.Value
+		delete(e.Enrichment, enrichment.AttrGender)
 	}
-	if cmd.Nationality != nil {
-		old.Nationality = cmd.Nationality
+	if cmd.Nationality.Set {
+		e.Nationality = cmd.Nationality.Value
+		delete(e.Enrichment, enrichment.AttrNationality)
+	}
+	e.EnrichmentRetryAt = e.Enrichment.NextRetry()
+	return nil
+}
+
+func (s *personService) DeletePerson(ctx context.Context, id int64, cmd model.DeletePersonCommand) error {
+	s.logger.Info("DeletePerson", "id", id, "cmd", cmd)
+	var version int64
+	if cmd.ExpectedVersion != nil {
+		version = *cmd.ExpectedVersion
+	}
+	return storageError(s.st.DeletePerson(ctx, id, version))
+}
+
+func (s *personService) RestorePerson(ctx context.Context, id int64) (model.Person, error) {
+	s.logger.Info("RestorePerson", "id", id)
+	e, err := s.st.RestorePerson(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return model.Person{}, fmt.Errorf("deleted %w", ErrNotFound)
 	}
-	updated, err := s.st.UpdatePerson(ctx, id, old)
 	if err != nil {
-		return model.Person{}, err
+		return model.Person{}, storageError(err)
+	}
+	return mapEntity(e), nil
+}
+
+// PurgeDeleted удаляет записи, которые пролежали удалёнными дольше retention.
+func (s *personService) PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	n, err := s.st.PurgeDeleted(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return 0, storageError(err)
 	}
-	return mapEntity(updated), nil
+	s.logger.Info("PurgeDeleted", "purged", n)
+	return n, nil
 }
 
-func (s *personService) DeletePerson(ctx context.Context, id int64) error {
-	s.logger.Info("DeletePerson", "id", id)
-	return s.st.DeletePerson(ctx, id)
+func (s *personService) EnrichmentCacheStats() model.CacheStats {
+	return s.es.CacheStats()
 }
 
 func (s *personService) GetPersonByID(ctx context.Context, id int64) (model.Person, error) {
 	s.logger.Info("GetPersonByID", "id", id)
 	e, err := s.st.GetPersonByID(ctx, id)
 	if err != nil {
-		return model.Person{}, err
+		return model.Person{}, storageError(err)
 	}
 	return mapEntity(e), nil
 }
 
+func (s *personService) GetPersonHistory(ctx context.Context, id int64) ([]model.HistoryEntry, error) {
+	s.logger.Info("GetPersonHistory", "id", id)
+	items, err := s.st.GetPersonHistory(ctx, id)
+	if err != nil {
+		return nil, storageError(err)
+	}
+	out := make([]model.HistoryEntry, len(items))
+	for i, h := range items {
+		changes := make(map[string]model.FieldChange, len(h.Changes))
+		for field, c := range h.Changes {
+			changes[field] = model.FieldChange{Old: c.Old, New: c.New}
+		}
+		out[i] = model.HistoryEntry{
+			ID:        h.ID,
+			PersonID:  h.PersonID,
+			Action:    h.Action,
+			Changes:   changes,
+			ChangedAt: h.ChangedAt.Format(time.RFC3339),
+		}
+	}
+	return out, nil
+}
+
 func (s *personService) ListPersons(ctx context.Context, q model.PersonQuery) (model.PagedPersons, error) {
 	s.logger.Info("ListPersons", "query", q)
-	params := storage.ListParams{
-		Offset: q.PageSize * (q.Page - 1),
-		Limit:  q.PageSize,
-	}
-	params.NameContains = q.Name
-	params.SurnameContains = q.Surname
-	params.MinAge = q.MinAge
-	params.MaxAge = q.MaxAge
-	res, err := s.st.ListPersons(ctx, params)
+	params, err := listParams(q)
 	if err != nil {
 		return model.PagedPersons{}, err
 	}
+	params.Offset = q.PageSize * (q.Page - 1)
+	params.Limit = q.PageSize
+	params.SkipCount = q.SkipTotal
+	fullSort := storage.NormalizeSort(params.Sort)
+	if q.Cursor != nil {
+		after, err := decodeCursor(*q.Cursor, fullSort)
+		if err != nil {
+			return model.PagedPersons{}, err
+		}
+		params.After = &after
+		params.Offset = 0
+	}
+	res, err := s.st.ListPersons(ctx, params)
+	if errors.Is(err, storage.ErrInvalid) {
+		return model.PagedPersons{}, fmt.Errorf("%w: %w", ErrInvalidQuery, err)
+	}
+	if err != nil {
+		return model.PagedPersons{}, storageError(err)
+	}
 	out := make([]model.Person, len(res.Items))
 	for i, e := range res.Items {
 		out[i] = mapEntity(e)
 	}
-	return model.PagedPersons{
+	paged := model.PagedPersons{
 		Persons:  out,
-		Total:    int(res.TotalCount),
 		Page:     q.Page,
 		PageSize: q.PageSize,
+	}
+	if !q.SkipTotal {
+		total := int(res.TotalCount)
+		paged.Total = &total
+	}
+	if res.HasMore && len(res.Items) > 0 {
+		paged.NextCursor = encodeCursor(fullSort, res.Items[len(res.Items)-1])
+	}
+	return paged, nil
+}
+
+func (s *personService) ExportPersons(ctx context.Context, q model.PersonQuery, fn func(model.Person) error) error {
+	s.logger.Info("ExportPersons", "query", q)
+	params, err := listParams(q)
+	if err != nil {
+		return err
+	}
+	var fnErr error
+	err = s.st.ExportPersons(ctx, params, func(e storage.PersonEntity) error {
+		fnErr = fn(mapEntity(e))
+		return fnErr
+	})
+	// ошибку обработчика (например, клиент закрыл соединение) отдаём как есть
+	if fnErr != nil {
+		return fnErr
+	}
+	if errors.Is(err, storage.ErrInvalid) {
+		return fmt.Errorf("%w: %w", ErrInvalidQuery, err)
+	}
+	return storageError(err)
+}
+
+// listParams переводит фильтры и сортировку запроса в параметры хранилища;
+// пагинацию заполняет вызывающий.
+func listParams(q model.PersonQuery) (storage.ListParams, error) {
+	sort, err := mapSort(q.Sort, q.Search != nil)
+	if err != nil {
+		return storage.ListParams{}, err
+	}
+	if q.Search != nil && len(sort) == 0 {
+		sort = []storage.SortField{{Column: storage.ScoreColumn, Desc: true, NullsFirst: true}}
+	}
+	return storage.ListParams{
+		NameContains:    q.Name,
+		SurnameContains: q.Surname,
+		Genders:         q.Genders,
+		Nationalities:   q.Nationalities,
+		MinAge:          q.MinAge,
+		MaxAge:          q.MaxAge,
+		Search:          q.Search,
+		Sort:            sort,
+		IncludeDeleted:  q.IncludeDeleted,
 	}, nil
 }
 
+func mapSort(fields []model.SortField, search bool) ([]storage.SortField, error) {
+	var out []storage.SortField
+	seen := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if !storage.IsSortable(f.Field) && !(search && f.Field == storage.ScoreColumn) {
+			return nil, fmt.Errorf("%w: cannot sort by %q", ErrInvalidQuery, f.Field)
+		}
+		if seen[f.Field] {
+			return nil, fmt.Errorf("%w: duplicate sort field %q", ErrInvalidQuery, f.Field)
+		}
+		seen[f.Field] = true
+		sf := storage.SortField{Column: f.Field, Desc: f.Desc, NullsFirst: f.Desc}
+		if f.NullsFirst != nil {
+			sf.NullsFirst = *f.NullsFirst
+		}
+		out = append(out, sf)
+	}
+	return out, nil
+}
+
 func mapEntity(e storage.PersonEntity) model.Person {
+	var deletedAt *string
+	if e.DeletedAt != nil {
+		v := e.DeletedAt.Format(time.RFC3339)
+		deletedAt = &v
+	}
 	return model.Person{
 		ID:          e.ID,
 		Name:        e.Name,
@@ -131,5 +460,58 @@ func mapEntity(e storage.PersonEntity) model.Person {
 		Gender:      e.Gender,
 		Nationality: e.Nationality,
 		CreatedAt:   e.CreatedAt.Format(time.RFC3339),
+		DeletedAt:   deletedAt,
+		Version:     e.Version,
+		Score:       e.Score,
+		Enrichment:  fromStorageEnrichment(e.Enrichment),
+	}
+}
+
+func toStorageEnrichment(in map[string]model.AttributeSource) storage.Enrichment {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make(storage.Enrichment, len(in))
+	for attr, src := range in {
+		s := storage.AttributeSource{
+			Status:      src.Status,
+			Provider:    src.Provider,
+			Probability: src.Probability,
+			Count:       src.Count,
+			Error:       src.Error,
+			Attempts:    src.Attempts,
+			RetryAt:     src.RetryAt,
+		}
+		for _, c := range src.Candidates {
+			s.Candidates = append(s.Candidates, storage.Candidate{Value: c.Value, Probability: c.Probability})
+		}
+		out[attr] = s
+	}
+	return out
+}
+
+func fromStorageEnrichment(in storage.Enrichment) map[string]model.AttributeSource {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make(map[string]model.AttributeSource, len(in))
+	for attr, src := range in {
+		s := model.AttributeSource{
+			Status:      src.Status,
+			Provider:    src.Provider,
+			Probability: src.Probability,
+			Count:       src.Count,
+			Error:       src.Error,
+			Attempts:    src.Attempts,
+			RetryAt:     src.RetryAt,
+		}
+		if s.Status == "" {
+			s.Status = model.EnrichmentComplete
+		}
+		for _, c := range src.Candidates {
+			s.Candidates = append(s.Candidates, model.Candidate{Value: c.Value, Probability: c.Probability})
+		}
+		out[attr] = s
 	}
+	return out
 }
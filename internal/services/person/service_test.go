@@ -3,16 +3,21 @@ package person
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"maps"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/exp/slog"
 
 	"person-api/internal/model"
 	"person-api/internal/services/enrichment"
 	"person-api/internal/storage"
+	"person-api/internal/storage/memory"
 )
 
 type mockEnr struct {
@@ -23,30 +28,141 @@ func (m *mockEnr) Enrich(ctx context.Context, p model.Person) (model.Person, err
 	args := m.Called(ctx, p)
 	return args.Get(0).(model.Person), args.Error(1)
 }
+func (m *mockEnr) EnrichAttributes(ctx context.Context, p model.Person, attrs []string) (model.Person, error) {
+	args := m.Called(ctx, p, attrs)
+	return args.Get(0).(model.Person), args.Error(1)
+}
+func (m *mockEnr) EnrichBatch(ctx context.Context, reqs []enrichment.Request) ([]model.Person, error) {
+	args := m.Called(ctx, reqs)
+	out, _ := args.Get(0).([]model.Person)
+	return out, args.Error(1)
+}
+func (m *mockEnr) Attributes() []string {
+	return m.Called().Get(0).([]string)
+}
+func (m *mockEnr) CacheStats() model.CacheStats {
+	return m.Called().Get(0).(model.CacheStats)
+}
 
 type mockStore struct {
 	mock.Mock
+	// enriched — записи, сохранённые через UpdateEnrichment.
+	enriched []storage.PersonEntity
 }
 
 func (m *mockStore) CreatePerson(ctx context.Context, p storage.PersonEntity) (storage.PersonEntity, error) {
 	args := m.Called(ctx, p)
 	return args.Get(0).(storage.PersonEntity), args.Error(1)
 }
+func (m *mockStore) CreatePersons(ctx context.Context, ps []storage.PersonEntity) ([]storage.PersonEntity, error) {
+	args := m.Called(ctx, ps)
+	out, _ := args.Get(0).([]storage.PersonEntity)
+	return out, args.Error(1)
+}
+func (m *mockStore) ExportPersons(ctx context.Context, params storage.ListParams, fn func(storage.PersonEntity) error) error {
+	args := m.Called(ctx, params)
+	for _, p := range args.Get(0).([]storage.PersonEntity) {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
 func (m *mockStore) UpdatePerson(ctx context.Context, id int64, p storage.PersonEntity) (storage.PersonEntity, error) {
 	args := m.Called(ctx, id, p)
 	return args.Get(0).(storage.PersonEntity), args.Error(1)
 }
-func (m *mockStore) DeletePerson(ctx context.Context, id int64) error {
-	return m.Called(ctx, id).Error(0)
+func (m *mockStore) DeletePerson(ctx context.Context, id int64, version int64) error {
+	return m.Called(ctx, id, version).Error(0)
+}
+func (m *mockStore) RestorePerson(ctx context.Context, id int64) (storage.PersonEntity, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(storage.PersonEntity), args.Error(1)
+}
+func (m *mockStore) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
+func (m *mockStore) ClaimIdempotencyKey(ctx context.Context, key, fingerprint string, staleBefore time.Time) (storage.IdempotencyKey, bool, error) {
+	args := m.Called(ctx, key, fingerprint, staleBefore)
+	return args.Get(0).(storage.IdempotencyKey), args.Bool(1), args.Error(2)
+}
+func (m *mockStore) CompleteIdempotencyKey(ctx context.Context, k storage.IdempotencyKey) error {
+	return m.Called(ctx, k).Error(0)
+}
+func (m *mockStore) DeleteIdempotencyKey(ctx context.Context, key string, claim int64) error {
+	return m.Called(ctx, key, claim).Error(0)
+}
+func (m *mockStore) PurgeIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
+func (m *mockStore) GetEnrichmentCache(ctx context.Context, key string) (storage.EnrichmentCacheEntry, error) {
+	args := m.Called(ctx, key)
+	return args.Get(0).(storage.EnrichmentCacheEntry), args.Error(1)
+}
+func (m *mockStore) PutEnrichmentCache(ctx context.Context, e storage.EnrichmentCacheEntry) error {
+	return m.Called(ctx, e).Error(0)
+}
+
+// UpdateEnrichment применяет fn к записи, которую вернул мок, и запоминает
+// результат в enriched.
+func (m *mockStore) UpdateEnrichment(ctx context.Context, id int64, fn func(*storage.PersonEntity)) (storage.PersonEntity, error) {
+	args := m.Called(ctx, id)
+	if err := args.Error(1); err != nil {
+		return storage.PersonEntity{}, err
+	}
+	e := args.Get(0).(storage.PersonEntity)
+	e.Enrichment = maps.Clone(e.Enrichment)
+	fn(&e)
+	m.enriched = append(m.enriched, e)
+	return e, nil
+}
+func (m *mockStore) ListEnrichmentRetries(ctx context.Context, before time.Time, limit int) ([]storage.PersonEntity, error) {
+	args := m.Called(ctx, before, limit)
+	return args.Get(0).([]storage.PersonEntity), args.Error(1)
+}
+func (m *mockStore) CreatePersonsQueued(ctx context.Context, ps []storage.PersonEntity) ([]storage.PersonEntity, error) {
+	args := m.Called(ctx, ps)
+	out, _ := args.Get(0).([]storage.PersonEntity)
+	return out, args.Error(1)
+}
+func (m *mockStore) ClaimEnrichmentJobs(ctx context.Context, limit int, lease time.Duration) ([]storage.EnrichmentJob, error) {
+	args := m.Called(ctx, limit, lease)
+	out, _ := args.Get(0).([]storage.EnrichmentJob)
+	return out, args.Error(1)
+}
+
+// Задания в моках — по ID и Attempts: Attempts закрепляет задание за обработчиком.
+func (m *mockStore) CompleteEnrichmentJob(ctx context.Context, job storage.EnrichmentJob) error {
+	return m.Called(ctx, job.ID, job.Attempts).Error(0)
+}
+func (m *mockStore) RetryEnrichmentJob(ctx context.Context, job storage.EnrichmentJob, runAt time.Time, lastErr string) error {
+	return m.Called(ctx, job.ID, job.Attempts, runAt, lastErr).Error(0)
+}
+func (m *mockStore) BuryEnrichmentJob(ctx context.Context, job storage.EnrichmentJob, lastErr string) error {
+	return m.Called(ctx, job.ID, job.Attempts, lastErr).Error(0)
+}
+func (m *mockStore) EnrichmentQueueStats(ctx context.Context) (storage.EnrichmentQueueStats, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(storage.EnrichmentQueueStats), args.Error(1)
 }
 func (m *mockStore) GetPersonByID(ctx context.Context, id int64) (storage.PersonEntity, error) {
 	args := m.Called(ctx, id)
 	return args.Get(0).(storage.PersonEntity), args.Error(1)
 }
+func (m *mockStore) GetPersonHistory(ctx context.Context, id int64) ([]storage.HistoryEntity, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).([]storage.HistoryEntity), args.Error(1)
+}
 func (m *mockStore) ListPersons(ctx context.Context, params storage.ListParams) (storage.PagedResult, error) {
 	args := m.Called(ctx, params)
 	return args.Get(0).(storage.PagedResult), args.Error(1)
 }
+func (m *mockStore) FindPersonsByNames(ctx context.Context, names []storage.FullName) ([]storage.PersonEntity, error) {
+	args := m.Called(ctx, names)
+	return args.Get(0).([]storage.PersonEntity), args.Error(1)
+}
 
 func makeService(enr enrichment.Service, st storage.Storage) Service {
 	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
@@ -59,7 +175,12 @@ func TestCreatePerson_Success(t *testing.T) {
 	storeMock := new(mockStore)
 
 	cmd := model.CreatePersonCommand{Name: "John", Surname: "Doe", Patronymic: nil}
-	enriched := model.Person{Name: "John", Surname: "Doe", Patronymic: nil, Age: intPtr(30), Gender: strPtr("male"), Nationality: strPtr("US")}
+	enriched := model.Person{Name: "John", Surname: "Doe", Patronymic: nil, Age: intPtr(30), Gender: strPtr("male"), Nationality: strPtr("US"),
+		Enrichment: map[string]model.AttributeSource{
+			"nationality": {Status: model.EnrichmentComplete, Provider: "nationalize", Probability: floatPtr(0.7), Count: intPtr(500), Candidates: []model.Candidate{
+				{Value: "US", Probability: 0.7}, {Value: "GB", Probability: 0.2},
+			}},
+		}}
 	enrMock.
 		On("Enrich", ctx, model.Person{Name: cmd.Name, Surname: cmd.Surname, Patronymic: cmd.Patronymic}).
 		Return(enriched, nil)
@@ -70,6 +191,11 @@ func TestCreatePerson_Success(t *testing.T) {
 		Age:         enriched.Age,
 		Gender:      enriched.Gender,
 		Nationality: enriched.Nationality,
+		Enrichment: storage.Enrichment{
+			"nationality": {Status: model.EnrichmentComplete, Provider: "nationalize", Probability: floatPtr(0.7), Count: intPtr(500), Candidates: []storage.Candidate{
+				{Value: "US", Probability: 0.7}, {Value: "GB", Probability: 0.2},
+			}},
+		},
 	}
 	outEntity := inEntity
 	outEntity.ID = 1
@@ -85,11 +211,88 @@ func TestCreatePerson_Success(t *testing.T) {
 	assert.Equal(t, *enriched.Age, *got.Age)
 	assert.Equal(t, *enriched.Gender, *got.Gender)
 	assert.Equal(t, *enriched.Nationality, *got.Nationality)
+	assert.Equal(t, enriched.Enrichment, got.Enrichment)
 
 	enrMock.AssertExpectations(t)
 	storeMock.AssertExpectations(t)
 }
 
+func TestCreatePersons(t *testing.T) {
+	ctx := context.Background()
+	enrMock := new(mockEnr)
+	storeMock := new(mockStore)
+
+	enrMock.On("Attributes").Return([]string{"age"})
+	// все имена пакета обогащаются одним вызовом
+	enrMock.On("EnrichBatch", ctx, []enrichment.Request{
+		{Person: model.Person{Name: "A", Surname: "X"}, Attrs: []string{"age"}},
+		{Person: model.Person{Name: "B", Surname: "X"}, Attrs: []string{"age"}},
+	}).Return([]model.Person{
+		{Name: "A", Surname: "X", Age: intPtr(30), Enrichment: map[string]model.AttributeSource{"age": {Status: model.EnrichmentComplete, Provider: "agify"}}},
+		{Name: "B", Surname: "X", Enrichment: map[string]model.AttributeSource{"age": {Status: model.EnrichmentFailed, Error: "agify: timeout"}}},
+	}, nil)
+	var saved []storage.PersonEntity
+	storeMock.On("CreatePersons", ctx, mock.Anything).Run(func(args mock.Arguments) {
+		saved = args.Get(1).([]storage.PersonEntity)
+	}).Return([]storage.PersonEntity{
+		{ID: 1, Name: "A", Surname: "X", Age: intPtr(30)},
+		{ID: 2, Name: "B", Surname: "X"},
+	}, nil)
+
+	svc := makeService(enrMock, storeMock)
+	res := svc.CreatePersons(ctx, []model.CreatePersonCommand{{Name: "A", Surname: "X"}, {Name: "B", Surname: "X"}})
+
+	require.Len(t, res, 2)
+	assert.NoError(t, res[0].Err)
+	assert.Equal(t, int64(1), res[0].Person.ID)
+	assert.NoError(t, res[1].Err)
+	assert.Equal(t, int64(2), res[1].Person.ID)
+	// возраст B запросим позже
+	require.Len(t, saved, 2)
+	assert.Equal(t, intPtr(30), saved[0].Age)
+	assert.Equal(t, model.EnrichmentPending, saved[1].Enrichment["age"].Status)
+	assert.NotNil(t, saved[1].EnrichmentRetryAt)
+	storeMock.AssertExpectations(t)
+}
+
+func TestCreatePersons_EnrichError(t *testing.T) {
+	ctx := context.Background()
+	enrMock := new(mockEnr)
+	storeMock := new(mockStore)
+	enrMock.On("Attributes").Return([]string{"age"})
+	enrMock.On("EnrichBatch", ctx, mock.Anything).Return(nil, context.DeadlineExceeded)
+
+	res := makeService(enrMock, storeMock).CreatePersons(ctx, []model.CreatePersonCommand{{Name: "A", Surname: "X"}, {Name: "B", Surname: "X"}})
+
+	require.Len(t, res, 2)
+	assert.ErrorIs(t, res[0].Err, ErrTimeout)
+	assert.ErrorIs(t, res[1].Err, ErrTimeout)
+	storeMock.AssertNotCalled(t, "CreatePersons", mock.Anything, mock.Anything)
+}
+
+func TestCreatePersons_BatchRejected(t *testing.T) {
+	ctx := context.Background()
+	enrMock := new(mockEnr)
+	storeMock := new(mockStore)
+	enrMock.On("Attributes").Return([]string{})
+	enrMock.On("EnrichBatch", ctx, mock.Anything).Return([]model.Person{{Name: "A", Surname: "X"}, {Name: "B", Surname: "X"}}, nil)
+
+	good := storage.PersonEntity{Name: "A", Surname: "X"}
+	bad := storage.PersonEntity{Name: "B", Surname: "X"}
+	storeMock.On("CreatePersons", ctx, mock.Anything).Return(nil, storage.ErrInvalid)
+	storeMock.On("CreatePerson", ctx, good).Return(storage.PersonEntity{ID: 1, Name: "A", Surname: "X"}, nil)
+	storeMock.On("CreatePerson", ctx, bad).Return(storage.PersonEntity{}, storage.ErrInvalid)
+
+	svc := makeService(enrMock, storeMock)
+	res := svc.CreatePersons(ctx, []model.CreatePersonCommand{{Name: "A", Surname: "X"}, {Name: "B", Surname: "X"}})
+
+	// отвергнутая база запись не мешает остальным
+	assert.NoError(t, res[0].Err)
+	assert.Equal(t, int64(1), res[0].Person.ID)
+	assert.ErrorIs(t, res[1].Err, ErrValidation)
+	storeMock.AssertExpectations(t)
+}
+
 func TestCreatePerson_EnrichError(t *testing.T) {
 	ctx := context.Background()
 	enrMock := new(mockEnr)
@@ -103,10 +306,368 @@ func TestCreatePerson_EnrichError(t *testing.T) {
 	svc := makeService(enrMock, storeMock)
 	_, err := svc.CreatePerson(ctx, cmd)
 
-	assert.EqualError(t, err, "api failure")
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.ErrorContains(t, err, "api failure")
 	enrMock.AssertExpectations(t)
 }
 
+func TestCreatePerson_PartialEnrichment(t *testing.T) {
+	ctx := context.Background()
+	enrMock := new(mockEnr)
+	storeMock := new(mockStore)
+	enrMock.On("Enrich", ctx, model.Person{Name: "Jane", Surname: "Smith"}).Return(model.Person{
+		Name: "Jane", Surname: "Smith", Gender: strPtr("female"),
+		Enrichment: map[string]model.AttributeSource{
+			"age":    {Status: model.EnrichmentFailed, Error: "agify: status 503"},
+			"gender": {Status: model.EnrichmentComplete, Provider: "genderize"},
+		},
+	}, nil)
+	var saved storage.PersonEntity
+	storeMock.On("CreatePerson", ctx, mock.Anything).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(storage.PersonEntity)
+	}).Return(storage.PersonEntity{ID: 1, Name: "Jane", Surname: "Smith", Gender: strPtr("female")}, nil)
+
+	before := time.Now()
+	got, err := makeService(enrMock, storeMock).CreatePerson(ctx, model.CreatePersonCommand{Name: "Jane", Surname: "Smith"})
+	require.NoError(t, err)
+
+	// запись сохранена с тем, что удалось получить; возраст запросим позже
+	assert.Equal(t, "female", *got.Gender)
+	age := saved.Enrichment["age"]
+	assert.Equal(t, model.EnrichmentPending, age.Status)
+	assert.Equal(t, "agify: status 503", age.Error)
+	assert.Equal(t, 1, age.Attempts)
+	require.NotNil(t, age.RetryAt)
+	assert.WithinDuration(t, before.Add(DefaultRepairPolicy.Delay), *age.RetryAt, time.Second)
+	assert.Equal(t, age.RetryAt, saved.EnrichmentRetryAt)
+}
+
+func TestRepairEnrichment(t *testing.T) {
+	ctx := context.Background()
+	enrMock := new(mockEnr)
+	storeMock := new(mockStore)
+	due := time.Now().Add(-time.Second)
+	later := time.Now().Add(time.Hour)
+	person := storage.PersonEntity{ID: 5, Name: "Jane", Surname: "Smith", Version: 2,
+		Enrichment: storage.Enrichment{
+			"age":         {Status: model.EnrichmentPending, Error: "agify: status 503", Attempts: 1, RetryAt: &due},
+			"gender":      {Status: model.EnrichmentPending, Error: "genderize: status 429", Attempts: 2, RetryAt: &later},
+			"nationality": {Status: model.EnrichmentPending, Error: "nationalize: status 500", Attempts: 4, RetryAt: &due},
+		},
+		EnrichmentRetryAt: &due,
+	}
+	// повторы ещё не наступили, но колонка устарела
+	stale := storage.PersonEntity{ID: 6, Name: "John", Surname: "Doe", Version: 1,
+		Enrichment:        storage.Enrichment{"gender": {Status: model.EnrichmentPending, Attempts: 1, RetryAt: &later}},
+		EnrichmentRetryAt: &due,
+	}
+	storeMock.On("ListEnrichmentRetries", ctx, mock.Anything, repairBatchSize).Return([]storage.PersonEntity{stale, person}, nil)
+	// в пакет попадают только записи, которым есть что повторить
+	enrMock.On("EnrichBatch", ctx, []enrichment.Request{
+		{Person: model.Person{Name: "Jane", Surname: "Smith"}, Attrs: []string{"age", "nationality"}},
+	}).Return([]model.Person{{
+		Name: "Jane", Surname: "Smith", Age: intPtr(33),
+		Enrichment: map[string]model.AttributeSource{
+			"age":         {Status: model.EnrichmentComplete, Provider: "agify"},
+			"nationality": {Status: model.EnrichmentFailed, Error: "nationalize: status 500"},
+		},
+	}}, nil)
+	fixed := stale
+	fixed.EnrichmentRetryAt = &later
+	storeMock.On("UpdateEnrichment", ctx, int64(6)).Return(stale, nil)
+
+	want := person
+	want.Age = intPtr(33)
+	want.Enrichment = storage.Enrichment{
+		"age":    {Status: model.EnrichmentComplete, Provider: "agify"},
+		"gender": person.Enrichment["gender"],
+		// пятая неудача: попытки исчерпаны
+		"nationality": {Status: model.EnrichmentFailed, Error: "nationalize: status 500", Attempts: 5},
+	}
+	want.EnrichmentRetryAt = &later
+	storeMock.On("UpdateEnrichment", ctx, int64(5)).Return(person, nil).Once()
+
+	svc := makeService(enrMock, storeMock)
+	n, err := svc.RepairEnrichment(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	// версия не меняется: повтор — работа сервиса, а не пользователя
+	assert.Equal(t, []storage.PersonEntity{fixed, want}, storeMock.enriched)
+
+	// пока шёл запрос к провайдерам, возраст задали вручную: его не трогаем
+	edited := person
+	edited.Version, edited.Age = 3, intPtr(40)
+	edited.Enrichment = storage.Enrichment{
+		"gender":      person.Enrichment["gender"],
+		"nationality": person.Enrichment["nationality"],
+	}
+	storeMock.On("UpdateEnrichment", ctx, int64(5)).Return(edited, nil).Once()
+	storeMock.enriched = nil
+	n, err = svc.RepairEnrichment(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	wantEdited := edited
+	wantEdited.Enrichment = storage.Enrichment{
+		"gender":      person.Enrichment["gender"],
+		"nationality": want.Enrichment["nationality"],
+	}
+	wantEdited.EnrichmentRetryAt = &later
+	assert.Equal(t, []storage.PersonEntity{fixed, wantEdited}, storeMock.enriched)
+	storeMock.AssertExpectations(t)
+	enrMock.AssertExpectations(t)
+}
+
+func TestCreatePerson_Async(t *testing.T) {
+	ctx := context.Background()
+	enrMock := new(mockEnr)
+	storeMock := new(mockStore)
+	enrMock.On("Attributes").Return([]string{"age", "gender"})
+	queued := storage.PersonEntity{Name: "Jane", Surname: "Smith", Enrichment: storage.Enrichment{
+		"age":    {Status: model.EnrichmentPending},
+		"gender": {Status: model.EnrichmentPending},
+	}}
+	saved := queued
+	saved.ID, saved.Version = 3, 1
+	storeMock.On("CreatePersonsQueued", ctx, []storage.PersonEntity{queued}).Return([]storage.PersonEntity{saved}, nil)
+
+	svc := NewPersonService(slog.New(slog.NewTextHandler(io.Discard, nil)), enrMock, storeMock, WithAsyncEnrichment())
+	got, err := svc.CreatePerson(ctx, model.CreatePersonCommand{Name: "Jane", Surname: "Smith"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), got.ID)
+	assert.Equal(t, model.EnrichmentPending, got.Enrichment["age"].Status)
+	// провайдеры не опрашиваются в запросе
+	enrMock.AssertNotCalled(t, "Enrich", mock.Anything, mock.Anything)
+	storeMock.AssertExpectations(t)
+}
+
+func TestProcessEnrichmentJobs(t *testing.T) {
+	ctx := context.Background()
+	queued := storage.PersonEntity{ID: 7, Name: "Jane", Surname: "Smith", Version: 1, Enrichment: storage.Enrichment{
+		"age":    {Status: model.EnrichmentPending},
+		"gender": {Status: model.EnrichmentPending},
+	}}
+	enriched := model.Person{Name: "Jane", Surname: "Smith", Age: intPtr(33), Enrichment: map[string]model.AttributeSource{
+		"age":    {Status: model.EnrichmentComplete, Provider: "agify"},
+		"gender": {Status: model.EnrichmentFailed, Error: "genderize: status 503"},
+	}}
+	policy := RepairPolicy{Attempts: 3, Delay: time.Minute, MaxDelay: time.Hour}
+
+	setup := func(attempts int, got model.Person) (*mockStore, Service) {
+		enrMock := new(mockEnr)
+		storeMock := new(mockStore)
+		storeMock.On("ClaimEnrichmentJobs", ctx, jobBatchSize, jobLease).
+			Return([]storage.EnrichmentJob{{ID: 1, PersonID: 7, Status: storage.JobRunning, Attempts: attempts}}, nil).Once()
+		storeMock.On("GetPersonByID", mock.Anything, int64(7)).Return(queued, nil).Once()
+		enrMock.On("EnrichBatch", mock.Anything, []enrichment.Request{
+			{Person: model.Person{Name: "Jane", Surname: "Smith"}, Attrs: []string{"age", "gender"}},
+		}).Return([]model.Person{got}, nil)
+		svc := NewPersonService(slog.New(slog.NewTextHandler(io.Discard, nil)), enrMock, storeMock, WithRepairPolicy(policy))
+		return storeMock, svc
+	}
+	partial := queued
+	partial.Age = intPtr(33)
+	partial.Enrichment = storage.Enrichment{
+		"age":    {Status: model.EnrichmentComplete, Provider: "agify"},
+		"gender": {Status: model.EnrichmentPending, Error: "genderize: status 503", Attempts: 2},
+	}
+
+	t.Run("retry", func(t *testing.T) {
+		storeMock, svc := setup(2, enriched)
+		storeMock.On("UpdateEnrichment", mock.Anything, int64(7)).Return(queued, nil)
+		before := time.Now()
+		storeMock.On("RetryEnrichmentJob", ctx, int64(1), 2, mock.MatchedBy(func(at time.Time) bool {
+			// вторая неудача: пауза удваивается
+			return at.Sub(before) >= 2*time.Minute && at.Sub(before) < 2*time.Minute+time.Second
+		}), "genderize: status 503").Return(nil)
+
+		n, err := svc.ProcessEnrichmentJobs(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, []storage.PersonEntity{partial}, storeMock.enriched)
+		storeMock.AssertExpectations(t)
+	})
+
+	t.Run("dead", func(t *testing.T) {
+		storeMock, svc := setup(3, enriched)
+		partial := partial
+		partial.Enrichment = maps.Clone(partial.Enrichment)
+		partial.Enrichment["gender"] = storage.AttributeSource{Status: model.EnrichmentPending, Error: "genderize: status 503", Attempts: 3}
+		storeMock.On("UpdateEnrichment", mock.Anything, int64(7)).Return(queued, nil).Once()
+		storeMock.On("UpdateEnrichment", ctx, int64(7)).Return(partial, nil).Once()
+		failed := partial
+		failed.Enrichment = maps.Clone(partial.Enrichment)
+		failed.Enrichment["gender"] = storage.AttributeSource{Status: model.EnrichmentFailed, Error: "genderize: status 503", Attempts: 3}
+		storeMock.On("BuryEnrichmentJob", ctx, int64(1), 3, "genderize: status 503").Return(nil)
+
+		n, err := svc.ProcessEnrichmentJobs(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, []storage.PersonEntity{partial, failed}, storeMock.enriched)
+		storeMock.AssertExpectations(t)
+	})
+
+	t.Run("complete", func(t *testing.T) {
+		full := enriched
+		full.Gender = strPtr("female")
+		full.Enrichment = map[string]model.AttributeSource{
+			"age":    {Status: model.EnrichmentComplete, Provider: "agify"},
+			"gender": {Status: model.EnrichmentComplete, Provider: "genderize"},
+		}
+		storeMock, svc := setup(1, full)
+		done := queued
+		done.Age, done.Gender = intPtr(33), strPtr("female")
+		done.Enrichment = storage.Enrichment{
+			"age":    {Status: model.EnrichmentComplete, Provider: "agify"},
+			"gender": {Status: model.EnrichmentComplete, Provider: "genderize"},
+		}
+		storeMock.On("UpdateEnrichment", mock.Anything, int64(7)).Return(queued, nil)
+		storeMock.On("CompleteEnrichmentJob", ctx, int64(1), 1).Return(nil)
+
+		n, err := svc.ProcessEnrichmentJobs(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, []storage.PersonEntity{done}, storeMock.enriched)
+		storeMock.AssertExpectations(t)
+	})
+
+	t.Run("edited meanwhile", func(t *testing.T) {
+		storeMock, svc := setup(1, enriched)
+		// пока шёл запрос к провайдерам, пол задали вручную
+		edited := queued
+		edited.Version, edited.Gender = 2, strPtr("male")
+		edited.Enrichment = storage.Enrichment{"age": {Status: model.EnrichmentPending}}
+		storeMock.On("UpdateEnrichment", mock.Anything, int64(7)).Return(edited, nil)
+		storeMock.On("CompleteEnrichmentJob", ctx, int64(1), 1).Return(nil)
+
+		n, err := svc.ProcessEnrichmentJobs(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		want := edited
+		want.Age = intPtr(33)
+		want.Enrichment = storage.Enrichment{"age": {Status: model.EnrichmentComplete, Provider: "agify"}}
+		assert.Equal(t, []storage.PersonEntity{want}, storeMock.enriched)
+		storeMock.AssertExpectations(t)
+	})
+
+	t.Run("deleted person", func(t *testing.T) {
+		storeMock := new(mockStore)
+		storeMock.On("ClaimEnrichmentJobs", ctx, jobBatchSize, jobLease).
+			Return([]storage.EnrichmentJob{{ID: 2, PersonID: 8, Status: storage.JobRunning, Attempts: 1}}, nil)
+		storeMock.On("GetPersonByID", mock.Anything, int64(8)).Return(storage.PersonEntity{}, storage.ErrNotFound)
+		storeMock.On("CompleteEnrichmentJob", ctx, int64(2), 1).Return(nil)
+		enrMock := new(mockEnr)
+
+		n, err := makeService(enrMock, storeMock).ProcessEnrichmentJobs(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		enrMock.AssertNotCalled(t, "EnrichBatch", mock.Anything, mock.Anything)
+		storeMock.AssertExpectations(t)
+	})
+
+	t.Run("empty queue", func(t *testing.T) {
+		storeMock := new(mockStore)
+		storeMock.On("ClaimEnrichmentJobs", ctx, jobBatchSize, jobLease).Return(nil, nil)
+		n, err := makeService(new(mockEnr), storeMock).ProcessEnrichmentJobs(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, n)
+	})
+}
+
+func TestProcessEnrichmentJobs_RestoredPerson(t *testing.T) {
+	ctx := context.Background()
+	enrMock := new(mockEnr)
+	enrMock.On("Attributes").Return([]string{"age"})
+	enrMock.On("EnrichBatch", mock.Anything, []enrichment.Request{
+		{Person: model.Person{Name: "Jane", Surname: "Smith"}, Attrs: []string{"age"}},
+	}).Return([]model.Person{{Name: "Jane", Surname: "Smith", Age: intPtr(33), Enrichment: map[string]model.AttributeSource{
+		"age": {Status: model.EnrichmentComplete, Provider: "agify"},
+	}}}, nil)
+	svc := NewPersonService(slog.New(slog.NewTextHandler(io.Discard, nil)), enrMock, memory.NewMemoryStorage(), WithAsyncEnrichment())
+
+	p, err := svc.CreatePerson(ctx, model.CreatePersonCommand{Name: "Jane", Surname: "Smith"})
+	require.NoError(t, err)
+	require.NoError(t, svc.DeletePerson(ctx, p.ID, model.DeletePersonCommand{}))
+	// задание удалённой записи завершается, ничего не запрашивая
+	n, err := svc.ProcessEnrichmentJobs(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	enrMock.AssertNotCalled(t, "EnrichBatch", mock.Anything, mock.Anything)
+
+	restored, err := svc.RestorePerson(ctx, p.ID)
+	require.NoError(t, err)
+	n, err = svc.ProcessEnrichmentJobs(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	got, err := svc.GetPersonByID(ctx, p.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got.Age)
+	assert.Equal(t, 33, *got.Age)
+	assert.Equal(t, model.EnrichmentComplete, got.Enrichment["age"].Status)
+	// обогащение не меняет версию: ETag клиента остаётся верным
+	assert.Equal(t, restored.Version, got.Version)
+}
+
+func TestRepairPolicy_Schedule(t *testing.T) {
+	p := RepairPolicy{Attempts: 4, Delay: time.Minute, MaxDelay: 3 * time.Minute}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	failed := model.AttributeSource{Status: model.EnrichmentFailed, Error: "down"}
+	for attempts, delay := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		got := p.schedule(failed, attempts, now)
+		assert.Equal(t, model.EnrichmentPending, got.Status)
+		assert.Equal(t, attempts+1, got.Attempts)
+		assert.Equal(t, now.Add(delay), *got.RetryAt)
+	}
+	got := p.schedule(failed, 3, now)
+	assert.Equal(t, model.AttributeSource{Status: model.EnrichmentFailed, Error: "down", Attempts: 4}, got)
+
+	complete := model.AttributeSource{Status: model.EnrichmentComplete, Provider: "agify"}
+	assert.Equal(t, complete, p.schedule(complete, 2, now))
+}
+
+func TestCreatePerson_EnrichTimeout(t *testing.T) {
+	ctx := context.Background()
+	enrMock := new(mockEnr)
+	enrMock.On("Enrich", ctx, mock.Anything).Return(model.Person{}, fmt.Errorf("agify: %w", context.DeadlineExceeded))
+
+	svc := makeService(enrMock, new(mockStore))
+	_, err := svc.CreatePerson(ctx, model.CreatePersonCommand{Name: "Jane", Surname: "Smith"})
+
+	assert.ErrorIs(t, err, ErrTimeout)
+}
+
+func TestStorageErrorsAreTranslated(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		storeErr error
+		want     error
+	}{
+		{storage.ErrNotFound, ErrNotFound},
+		{storage.ErrVersionConflict, ErrVersionMismatch},
+		{fmt.Errorf("%w: duplicate key", storage.ErrConflict), ErrConflict},
+		{fmt.Errorf("%w: value too long", storage.ErrInvalid), ErrValidation},
+		{fmt.Errorf("%w: connection refused", storage.ErrUnavailable), ErrUnavailable},
+		{fmt.Errorf("%w: statement timeout", storage.ErrTimeout), ErrTimeout},
+	}
+	for _, tc := range tests {
+		t.Run(tc.want.Error(), func(t *testing.T) {
+			storeMock := new(mockStore)
+			storeMock.On("GetPersonByID", ctx, int64(1)).Return(storage.PersonEntity{}, tc.storeErr)
+			storeMock.On("DeletePerson", ctx, int64(1), int64(0)).Return(tc.storeErr)
+			svc := makeService(nil, storeMock)
+
+			_, err := svc.GetPersonByID(ctx, 1)
+			assert.ErrorIs(t, err, tc.want)
+			assert.ErrorIs(t, svc.DeletePerson(ctx, 1, model.DeletePersonCommand{}), tc.want)
+		})
+	}
+
+	storeMock := new(mockStore)
+	storeMock.On("RestorePerson", ctx, int64(1)).Return(storage.PersonEntity{}, storage.ErrNotFound)
+	_, err := makeService(nil, storeMock).RestorePerson(ctx, 1)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.EqualError(t, err, "deleted person not found")
+}
+
 func TestUpdatePerson_Success(t *testing.T) {
 	ctx := context.Background()
 	enrMock := new(mockEnr)
@@ -116,10 +677,10 @@ func TestUpdatePerson_Success(t *testing.T) {
 	old := storage.PersonEntity{ID: id, Name: "Old", Surname: "Name", Patronymic: nil, Age: intPtr(20), Gender: strPtr("female"), Nationality: strPtr("GB")}
 	storeMock.On("GetPersonByID", ctx, id).Return(old, nil)
 
-	cmd := model.UpdatePersonCommand{Name: strPtr("New"), Age: intPtr(25)}
+	cmd := model.UpdatePersonCommand{Name: model.Some("New"), Age: model.Some(25)}
 	updatedEntity := old
-	updatedEntity.Name = *cmd.Name
-	updatedEntity.Age = cmd.Age
+	updatedEntity.Name = "New"
+	updatedEntity.Age = intPtr(25)
 
 	outEntity := updatedEntity
 	storeMock.On("UpdatePerson", ctx, id, updatedEntity).Return(outEntity, nil)
@@ -133,6 +694,118 @@ func TestUpdatePerson_Success(t *testing.T) {
 	storeMock.AssertExpectations(t)
 }
 
+func TestUpdatePerson_ClearFields(t *testing.T) {
+	ctx := context.Background()
+	storeMock := new(mockStore)
+	old := storage.PersonEntity{ID: 7, Name: "A", Surname: "B", Patronymic: strPtr("C"), Age: intPtr(40), Gender: strPtr("male")}
+	storeMock.On("GetPersonByID", ctx, int64(7)).Return(old, nil)
+
+	// null очищает поле, незаданное поле не меняется
+	want := old
+	want.Patronymic = nil
+	want.Age = nil
+	storeMock.On("UpdatePerson", ctx, int64(7), want).Return(want, nil)
+
+	svc := makeService(nil, storeMock)
+	got, err := svc.UpdatePerson(ctx, 7, model.UpdatePersonCommand{Patronymic: model.Null[string](), Age: model.Null[int]()})
+	assert.NoError(t, err)
+	assert.Nil(t, got.Patronymic)
+	assert.Nil(t, got.Age)
+	assert.Equal(t, "male", *got.Gender)
+
+	_, err = svc.UpdatePerson(ctx, 7, model.UpdatePersonCommand{Name: model.Null[string]()})
+	assert.ErrorIs(t, err, ErrValidation)
+	storeMock.AssertNumberOfCalls(t, "UpdatePerson", 1)
+}
+
+func TestUpdatePerson_DropsEnrichmentOfSetFields(t *testing.T) {
+	ctx := context.Background()
+	storeMock := new(mockStore)
+	retryAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	old := storage.PersonEntity{ID: 7, Name: "A", Surname: "B", Gender: strPtr("male"),
+		Enrichment: storage.Enrichment{
+			"age":    {Status: model.EnrichmentPending, Error: "agify: status 503", Attempts: 1, RetryAt: &retryAt},
+			"gender": {Provider: "genderize", Probability: floatPtr(0.9)},
+		},
+		EnrichmentRetryAt: &retryAt,
+	}
+	storeMock.On("GetPersonByID", ctx, int64(7)).Return(old, nil)
+
+	// возраст задан вручную: сведения о его обогащении больше не верны, повторять нечего
+	want := old
+	want.Age = intPtr(41)
+	want.Enrichment = storage.Enrichment{"gender": {Provider: "genderize", Probability: floatPtr(0.9)}}
+	want.EnrichmentRetryAt = nil
+	storeMock.On("UpdatePerson", ctx, int64(7), want).Return(want, nil)
+
+	svc := makeService(nil, storeMock)
+	got, err := svc.UpdatePerson(ctx, 7, model.UpdatePersonCommand{Age: model.Some(41)})
+	require.NoError(t, err)
+	// записи без статуса сделаны до его появления
+	assert.Equal(t, map[string]model.AttributeSource{
+		"gender": {Status: model.EnrichmentComplete, Provider: "genderize", Probability: floatPtr(0.9)},
+	}, got.Enrichment)
+	storeMock.AssertExpectations(t)
+}
+
+func TestUpdatePerson_VersionMismatch(t *testing.T) {
+	ctx := context.Background()
+	storeMock := new(mockStore)
+	old := storage.PersonEntity{ID: 3, Name: "A", Surname: "B", Version: 5}
+	storeMock.On("GetPersonByID", ctx, int64(3)).Return(old, nil)
+
+	svc := makeService(nil, storeMock)
+	stale := int64(4)
+	_, err := svc.UpdatePerson(ctx, 3, model.UpdatePersonCommand{Name: model.Some("X"), ExpectedVersion: &stale})
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+
+	// запись изменили между чтением и записью
+	updated := old
+	updated.Name = "X"
+	storeMock.On("UpdatePerson", ctx, int64(3), updated).Return(storage.PersonEntity{}, storage.ErrVersionConflict)
+	current := int64(5)
+	_, err = svc.UpdatePerson(ctx, 3, model.UpdatePersonCommand{Name: model.Some("X"), ExpectedVersion: &current})
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+
+	storeMock.On("DeletePerson", ctx, int64(3), int64(4)).Return(storage.ErrVersionConflict)
+	err = svc.DeletePerson(ctx, 3, model.DeletePersonCommand{ExpectedVersion: &stale})
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+	storeMock.AssertExpectations(t)
+}
+
+func TestUpdatePerson_RetriesWithoutPrecondition(t *testing.T) {
+	ctx := context.Background()
+	storeMock := new(mockStore)
+	v5 := storage.PersonEntity{ID: 3, Name: "A", Surname: "B", Version: 5}
+	// между чтением и записью кто-то поменял фамилию
+	v6 := storage.PersonEntity{ID: 3, Name: "A", Surname: "C", Version: 6}
+	storeMock.On("GetPersonByID", ctx, int64(3)).Return(v5, nil).Once()
+	storeMock.On("GetPersonByID", ctx, int64(3)).Return(v6, nil).Once()
+	stale := v5
+	stale.Name = "X"
+	storeMock.On("UpdatePerson", ctx, int64(3), stale).Return(storage.PersonEntity{}, storage.ErrVersionConflict).Once()
+	fresh := v6
+	fresh.Name = "X"
+	saved := fresh
+	saved.Version = 7
+	storeMock.On("UpdatePerson", ctx, int64(3), fresh).Return(saved, nil).Once()
+
+	svc := makeService(nil, storeMock)
+	got, err := svc.UpdatePerson(ctx, 3, model.UpdatePersonCommand{Name: model.Some("X")})
+	require.NoError(t, err)
+	assert.Equal(t, "X", got.Name)
+	assert.Equal(t, "C", got.Surname)
+	assert.Equal(t, int64(7), got.Version)
+
+	// запись меняют непрерывно: без If-Match это не 412
+	storeMock.On("GetPersonByID", ctx, int64(3)).Return(v6, nil)
+	storeMock.On("UpdatePerson", ctx, int64(3), fresh).Return(storage.PersonEntity{}, storage.ErrVersionConflict).Times(updateAttempts)
+	_, err = svc.UpdatePerson(ctx, 3, model.UpdatePersonCommand{Name: model.Some("X")})
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.NotErrorIs(t, err, ErrVersionMismatch)
+	storeMock.AssertExpectations(t)
+}
+
 func TestUpdatePerson_GetError(t *testing.T) {
 	ctx := context.Background()
 	storeMock := new(mockStore)
@@ -152,7 +825,7 @@ func TestUpdatePerson_UpdateError(t *testing.T) {
 	storeMock.On("UpdatePerson", ctx, id, mock.Anything).Return(storage.PersonEntity{}, errors.New("write error"))
 
 	svc := makeService(nil, storeMock)
-	_, err := svc.UpdatePerson(ctx, id, model.UpdatePersonCommand{Name: strPtr("X")})
+	_, err := svc.UpdatePerson(ctx, id, model.UpdatePersonCommand{Name: model.Some("X")})
 	assert.EqualError(t, err, "write error")
 }
 
@@ -167,8 +840,8 @@ func TestGetAndDeleteAndList(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, int64(5), p.ID)
 
-	storeMock.On("DeletePerson", ctx, int64(7)).Return(nil)
-	err = svc.DeletePerson(ctx, 7)
+	storeMock.On("DeletePerson", ctx, int64(7), int64(0)).Return(nil)
+	err = svc.DeletePerson(ctx, 7, model.DeletePersonCommand{})
 	assert.NoError(t, err)
 
 	params := storage.ListParams{Offset: 0, Limit: 10}
@@ -184,5 +857,325 @@ func TestGetAndDeleteAndList(t *testing.T) {
 	storeMock.AssertExpectations(t)
 }
 
-func strPtr(s string) *string { return &s }
-func intPtr(i int) *int       { return &i }
+func TestListPersons_PassesFilters(t *testing.T) {
+	ctx := context.Background()
+	storeMock := new(mockStore)
+
+	params := storage.ListParams{
+		Genders:       []string{"female"},
+		Nationalities: []string{"RU", "KZ"},
+		Offset:        10,
+		Limit:         10,
+	}
+	storeMock.On("ListPersons", ctx, params).Return(storage.PagedResult{}, nil)
+
+	svc := makeService(nil, storeMock)
+	_, err := svc.ListPersons(ctx, model.PersonQuery{
+		Genders:       []string{"female"},
+		Nationalities: []string{"RU", "KZ"},
+		Page:          2,
+		PageSize:      10,
+	})
+	assert.NoError(t, err)
+	storeMock.AssertExpectations(t)
+}
+
+func TestListPersons_CursorRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	storeMock := new(mockStore)
+
+	first := storage.ListParams{Limit: 2}
+	storeMock.On("ListPersons", ctx, first).Return(storage.PagedResult{
+		Items:      []storage.PersonEntity{{ID: 3}, {ID: 5}},
+		TotalCount: 4,
+		HasMore:    true,
+	}, nil)
+
+	svc := makeService(nil, storeMock)
+	res, err := svc.ListPersons(ctx, model.PersonQuery{Page: 1, PageSize: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, *res.Total)
+	assert.NotEmpty(t, res.NextCursor)
+
+	second := storage.ListParams{Limit: 2, After: &storage.Cursor{Values: []*string{strPtr("5")}}, SkipCount: true}
+	storeMock.On("ListPersons", ctx, second).Return(storage.PagedResult{
+		Items: []storage.PersonEntity{{ID: 8}},
+	}, nil)
+	res, err = svc.ListPersons(ctx, model.PersonQuery{PageSize: 2, Cursor: &res.NextCursor, SkipTotal: true})
+	assert.NoError(t, err)
+	assert.Nil(t, res.Total)
+	assert.Empty(t, res.NextCursor)
+	storeMock.AssertExpectations(t)
+}
+
+func TestListPersons_Sort(t *testing.T) {
+	ctx := context.Background()
+	storeMock := new(mockStore)
+
+	nullsFirst := false
+	sort := []storage.SortField{
+		{Column: "age", Desc: true, NullsFirst: false},
+		{Column: "surname"},
+	}
+	storeMock.On("ListPersons", ctx, storage.ListParams{Sort: sort, Limit: 1}).Return(storage.PagedResult{
+		Items:   []storage.PersonEntity{{ID: 4, Surname: "Ivanov", Age: intPtr(30)}},
+		HasMore: true,
+	}, nil)
+
+	svc := makeService(nil, storeMock)
+	q := model.PersonQuery{
+		Sort: []model.SortField{
+			{Field: "age", Desc: true, NullsFirst: &nullsFirst},
+			{Field: "surname"},
+		},
+		Page:     1,
+		PageSize: 1,
+	}
+	res, err := svc.ListPersons(ctx, q)
+	assert.NoError(t, err)
+
+	next := storage.ListParams{
+		Sort:  sort,
+		Limit: 1,
+		After: &storage.Cursor{Values: []*string{strPtr("30"), strPtr("Ivanov"), strPtr("4")}},
+	}
+	storeMock.On("ListPersons", ctx, next).Return(storage.PagedResult{}, nil)
+	q.Page, q.Cursor = 0, &res.NextCursor
+	_, err = svc.ListPersons(ctx, q)
+	assert.NoError(t, err)
+
+	// курсор от другого порядка не принимается
+	q.Sort = []model.SortField{{Field: "surname"}}
+	_, err = svc.ListPersons(ctx, q)
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+
+	q.Sort, q.Cursor = []model.SortField{{Field: "password"}}, nil
+	_, err = svc.ListPersons(ctx, q)
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+	storeMock.AssertExpectations(t)
+}
+
+func TestListPersons_SearchDefaultsToRelevance(t *testing.T) {
+	ctx := context.Background()
+	storeMock := new(mockStore)
+
+	score := 0.8
+	params := storage.ListParams{
+		Search: strPtr("ivan"),
+		Sort:   []storage.SortField{{Column: storage.ScoreColumn, Desc: true, NullsFirst: true}},
+		Limit:  10,
+	}
+	storeMock.On("ListPersons", ctx, params).Return(storage.PagedResult{
+		Items: []storage.PersonEntity{{ID: 1, Name: "Ivan", Score: &score}},
+	}, nil)
+
+	svc := makeService(nil, storeMock)
+	res, err := svc.ListPersons(ctx, model.PersonQuery{Search: strPtr("ivan"), Page: 1, PageSize: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 0.8, *res.Persons[0].Score)
+
+	// без поиска сортировать по релевантности нельзя
+	_, err = svc.ListPersons(ctx, model.PersonQuery{Sort: []model.SortField{{Field: "score"}}, Page: 1, PageSize: 10})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+	storeMock.AssertExpectations(t)
+}
+
+func TestListPersons_InvalidCursor(t *testing.T) {
+	svc := makeService(nil, new(mockStore))
+	_, err := svc.ListPersons(context.Background(), model.PersonQuery{PageSize: 10, Cursor: strPtr("not a cursor")})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+}
+
+func TestRestoreAndPurge(t *testing.T) {
+	ctx := context.Background()
+	storeMock := new(mockStore)
+	deletedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	storeMock.On("RestorePerson", ctx, int64(9)).Return(storage.PersonEntity{ID: 9, Name: "A"}, nil)
+	storeMock.On("ListPersons", ctx, storage.ListParams{Limit: 10, IncludeDeleted: true}).Return(storage.PagedResult{
+		Items: []storage.PersonEntity{{ID: 10, DeletedAt: &deletedAt}},
+	}, nil)
+	storeMock.On("PurgeDeleted", ctx, mock.MatchedBy(func(before time.Time) bool {
+		return time.Since(before) >= time.Hour && time.Since(before) < time.Hour+time.Minute
+	})).Return(int64(2), nil)
+
+	svc := makeService(nil, storeMock)
+	p, err := svc.RestorePerson(ctx, 9)
+	assert.NoError(t, err)
+	assert.Nil(t, p.DeletedAt)
+
+	res, err := svc.ListPersons(ctx, model.PersonQuery{Page: 1, PageSize: 10, IncludeDeleted: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-05-01T10:00:00Z", *res.Persons[0].DeletedAt)
+
+	n, err := svc.PurgeDeleted(ctx, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	storeMock.AssertExpectations(t)
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	ctx := context.Background()
+	storeMock := new(mockStore)
+	stored := storage.IdempotencyKey{Key: "k", Fingerprint: "fp", Status: 201, Header: storage.Header{"ETag": `"1"`}, Body: []byte(`{}`), Claim: 2}
+	// ключ без ответа можно занять снова через DefaultIdempotencyLease
+	lease := mock.MatchedBy(func(staleBefore time.Time) bool {
+		return time.Since(staleBefore)-DefaultIdempotencyLease < time.Second
+	})
+	storeMock.On("ClaimIdempotencyKey", ctx, "k", "fp", lease).Return(stored, false, nil)
+	storeMock.On("CompleteIdempotencyKey", ctx, storage.IdempotencyKey{Key: "k", Status: 201, Body: []byte(`{}`), Claim: 2}).Return(storage.ErrNotFound)
+	storeMock.On("DeleteIdempotencyKey", ctx, "k", int64(2)).Return(storage.ErrUnavailable)
+
+	svc := makeService(nil, storeMock)
+	rec, claimed, err := svc.ClaimIdempotencyKey(ctx, "k", "fp")
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Equal(t, model.IdempotencyRecord{Fingerprint: "fp", Status: 201, Header: map[string]string{"ETag": `"1"`}, Body: []byte(`{}`), Claim: 2}, rec)
+
+	err = svc.CompleteIdempotencyKey(ctx, "k", model.IdempotencyRecord{Status: 201, Body: []byte(`{}`), Claim: 2})
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, svc.ReleaseIdempotencyKey(ctx, "k", 2), ErrUnavailable)
+	storeMock.AssertExpectations(t)
+}
+
+func TestClaimIdempotencyKey_Lease(t *testing.T) {
+	ctx := context.Background()
+	st := memory.NewMemoryStorage()
+	svc := NewPersonService(slog.New(slog.NewTextHandler(io.Discard, nil)), nil, st, WithIdempotencyLease(time.Nanosecond))
+
+	_, claimed, err := svc.ClaimIdempotencyKey(ctx, "k", "fp")
+	require.NoError(t, err)
+	require.True(t, claimed)
+	time.Sleep(time.Millisecond)
+
+	// первый запрос так и не сохранил ответ: по истечении аренды ключ занимается снова
+	_, claimed, err = svc.ClaimIdempotencyKey(ctx, "k", "fp")
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	// но не другим запросом
+	rec, claimed, err := svc.ClaimIdempotencyKey(ctx, "k", "other")
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Equal(t, "fp", rec.Fingerprint)
+
+	// без аренды ключ без ответа остаётся занятым
+	svc = NewPersonService(slog.New(slog.NewTextHandler(io.Discard, nil)), nil, st, WithIdempotencyLease(0))
+	_, claimed, err = svc.ClaimIdempotencyKey(ctx, "k", "fp")
+	require.NoError(t, err)
+	assert.False(t, claimed)
+}
+
+func TestGetPersonHistory(t *testing.T) {
+	ctx := context.Background()
+	storeMock := new(mockStore)
+	changedAt := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+	storeMock.On("GetPersonHistory", ctx, int64(3)).Return([]storage.HistoryEntity{
+		{ID: 1, PersonID: 3, Action: storage.ActionUpdate, ChangedAt: changedAt,
+			Changes: storage.Changes{"nationality": {Old: "RU", New: "KZ"}}},
+	}, nil)
+
+	svc := makeService(nil, storeMock)
+	got, err := svc.GetPersonHistory(ctx, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.HistoryEntry{{
+		ID: 1, PersonID: 3, Action: "update", ChangedAt: "2024-03-02T12:00:00Z",
+		Changes: map[string]model.FieldChange{"nationality": {Old: "RU", New: "KZ"}},
+	}}, got)
+	storeMock.AssertExpectations(t)
+}
+
+func strPtr(s string) *string     { return &s }
+func intPtr(i int) *int           { return &i }
+func floatPtr(f float64) *float64 { return &f }
+
+func TestExportPersons(t *testing.T) {
+	ctx := context.Background()
+	storeMock := new(mockStore)
+	search := "ivan"
+	// фильтры и сортировка как у ListPersons, без пагинации
+	storeMock.On("ExportPersons", ctx, storage.ListParams{
+		Search: &search,
+		Sort:   []storage.SortField{{Column: storage.ScoreColumn, Desc: true, NullsFirst: true}},
+	}).Return([]storage.PersonEntity{{ID: 1, Name: "Ivan"}, {ID: 2, Name: "Ivana"}}, nil)
+
+	svc := makeService(nil, storeMock)
+	var got []int64
+	err := svc.ExportPersons(ctx, model.PersonQuery{Search: &search, Page: 3, PageSize: 10}, func(p model.Person) error {
+		got = append(got, p.ID)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, got)
+
+	// ошибка обработчика возвращается без изменений
+	stop := errors.New("client gone")
+	err = svc.ExportPersons(ctx, model.PersonQuery{Search: &search}, func(model.Person) error { return stop })
+	assert.Equal(t, stop, err)
+
+	err = svc.ExportPersons(ctx, model.PersonQuery{Sort: []model.SortField{{Field: "password"}}}, nil)
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+}
+
+func TestImportPersons(t *testing.T) {
+	ctx := context.Background()
+	storeMock := new(mockStore)
+	// строки шага сверяются с базой одним запросом, без повторов из файла
+	storeMock.On("FindPersonsByNames", ctx, []storage.FullName{
+		{Name: "Ivan", Surname: "Ivanov"},
+		{Name: "Anna", Surname: "Petrova"},
+	}).Return([]storage.PersonEntity{
+		{ID: 7, Name: "IVAN", Surname: "ivanov"},
+		{ID: 9, Name: "Ivan", Surname: "Ivanov"},
+	}, nil)
+
+	rows := []model.ImportRow{
+		{Line: 2, Cmd: model.CreatePersonCommand{Name: "Ivan", Surname: "Ivanov"}},
+		{Line: 3, Cmd: model.CreatePersonCommand{Name: "Anna", Surname: "Petrova"}},
+		{Line: 4, Errors: map[string]string{"name": "name is required"}},
+		{Line: 5, Cmd: model.CreatePersonCommand{Name: "anna", Surname: "PETROVA"}},
+	}
+	svc := makeService(nil, storeMock)
+
+	// dry run ничего не пишет
+	rep, err := svc.ImportPersons(ctx, rows, model.ImportOptions{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, []model.ImportRowResult{
+		{Line: 2, Status: model.ImportDuplicate, DuplicateOfID: 7},
+		{Line: 3, Status: model.ImportValid},
+		{Line: 4, Status: model.ImportInvalid, Errors: rows[2].Errors},
+		{Line: 5, Status: model.ImportDuplicate, DuplicateOfLine: 3},
+	}, rep.Rows)
+	assert.Equal(t, 1, rep.Valid)
+	assert.Equal(t, 2, rep.Duplicates)
+	storeMock.AssertNotCalled(t, "CreatePersons", mock.Anything, mock.Anything)
+
+	// без обогащения записи сохраняются как есть
+	storeMock.On("CreatePersons", ctx, []storage.PersonEntity{{Name: "Anna", Surname: "Petrova"}}).
+		Return([]storage.PersonEntity{{ID: 10, Name: "Anna", Surname: "Petrova"}}, nil)
+	rep, err = svc.ImportPersons(ctx, rows, model.ImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, model.ImportCreated, rep.Rows[1].Status)
+	assert.Equal(t, int64(10), rep.Rows[1].PersonID)
+	assert.Equal(t, 1, rep.Created)
+	assert.Zero(t, rep.Valid)
+	storeMock.AssertNumberOfCalls(t, "FindPersonsByNames", 2)
+}
+
+func TestStartImport(t *testing.T) {
+	ctx := context.Background()
+	storeMock := new(mockStore)
+	storeMock.On("FindPersonsByNames", mock.Anything, mock.Anything).Return([]storage.PersonEntity(nil), errors.New("db down"))
+	svc := makeService(nil, storeMock)
+
+	job := svc.StartImport(ctx, []model.ImportRow{{Line: 1, Cmd: model.CreatePersonCommand{Name: "A", Surname: "B"}}}, model.ImportOptions{})
+	assert.Equal(t, model.JobPending, job.Status)
+	assert.Equal(t, 1, job.Total)
+
+	require.Eventually(t, func() bool {
+		got, err := svc.GetImportJob(ctx, job.ID)
+		return err == nil && got.Status == model.JobFailed && got.Err != nil
+	}, time.Second, 5*time.Millisecond)
+
+	_, err := svc.GetImportJob(ctx, "missing")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Enrichment — как получены обогащённые атрибуты; ключ — атрибут (age,
+// gender, nationality). Хранится в JSONB.
+type Enrichment map[string]AttributeSource
+
+// AttributeSource без Status записан до появления статусов и означает
+// успешное обогащение.
+type AttributeSource struct {
+	Status      string      `json:"status,omitempty"`
+	Provider    string      `json:"provider"`
+	Probability *float64    `json:"probability,omitempty"`
+	Count       *int        `json:"count,omitempty"`
+	Candidates  []Candidate `json:"candidates,omitempty"`
+	Error       string      `json:"error,omitempty"`
+	Attempts    int         `json:"attempts,omitempty"`
+	RetryAt     *time.Time  `json:"retry_at,omitempty"`
+}
+
+type Candidate struct {
+	Value       string  `json:"value"`
+	Probability float64 `json:"probability"`
+}
+
+// NextRetry — ближайшее время повторного обогащения атрибутов; nil — повторять нечего.
+func (e Enrichment) NextRetry() *time.Time {
+	var next *time.Time
+	for _, src := range e {
+		if src.RetryAt != nil && (next == nil || src.RetryAt.Before(*next)) {
+			t := *src.RetryAt
+			next = &t
+		}
+	}
+	return next
+}
+
+// Queued сообщает, есть ли атрибуты, ждущие очереди обогащения: pending без
+// RetryAt (повторы с RetryAt находит ListEnrichmentRetries).
+func (e Enrichment) Queued() bool {
+	for _, src := range e {
+		if src.Status == "pending" && src.RetryAt == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (e Enrichment) Value() (driver.Value, error) {
+	if e == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(e)
+}
+
+func (e *Enrichment) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	case nil:
+		*e = nil
+		return nil
+	default:
+		return errors.New("enrichment: unsupported type")
+	}
+	return json.Unmarshal(b, e)
+}
+
+// EnrichmentCacheEntry — сохранённый ответ провайдера обогащения. Result —
+// JSON, формат которого задаёт пакет enrichment.
+type EnrichmentCacheEntry struct {
+	Key       string    `db:"key"`
+	Result    []byte    `db:"result"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// Статусы задания очереди обогащения.
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	// JobDead — попытки исчерпаны; задание остаётся в таблице для разбора.
+	JobDead = "dead"
+)
+
+// EnrichmentJob — задание обогатить атрибуты записи, ожидающие в статусе pending.
+type EnrichmentJob struct {
+	ID       int64  `db:"id"`
+	PersonID int64  `db:"person_id"`
+	Status   string `db:"status"`
+	// Attempts — сколько раз задание брали в работу, считая текущий.
+	Attempts int `db:"attempts"`
+	// RunAt — когда задание можно взять; у running — когда истекает аренда.
+	RunAt     time.Time `db:"run_at"`
+	LastError *string   `db:"last_error"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// EnrichmentQueueStats — число заданий очереди обогащения по статусам.
+type EnrichmentQueueStats struct {
+	Queued  int64
+	Running int64
+	Dead    int64
+	// OldestQueued — когда создано самое старое задание в статусе queued.
+	OldestQueued *time.Time
+}
@@ -0,0 +1,20 @@
+package storage
+
+import "errors"
+
+// Ошибки, в которые реализации Storage переводят ошибки драйвера.
+// Вызывающий код проверяет их через errors.Is и не зависит от database/sql.
+var (
+	// ErrNotFound — записи нет (или она удалена, если метод работает только с живыми записями).
+	ErrNotFound = errors.New("not found")
+	// ErrVersionConflict — запись существует, но её версия не совпала с ожидаемой.
+	ErrVersionConflict = errors.New("version conflict")
+	// ErrConflict — изменение противоречит данным в хранилище (уникальность, конкурентная транзакция).
+	ErrConflict = errors.New("conflict")
+	// ErrInvalid — хранилище отвергло данные (ограничения, длина, формат).
+	ErrInvalid = errors.New("invalid data")
+	// ErrUnavailable — хранилище недоступно.
+	ErrUnavailable = errors.New("storage unavailable")
+	// ErrTimeout — операция не уложилась во время.
+	ErrTimeout = errors.New("storage timeout")
+)
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+)
+
+// FieldChange — значение поля до и после изменения; nil соответствует NULL.
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// Changes хранится в JSONB-колонке person_history.changes.
+type Changes map[string]FieldChange
+
+func (c Changes) Value() (driver.Value, error) {
+	if c == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(c)
+}
+
+func (c *Changes) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	case nil:
+		*c = Changes{}
+		return nil
+	default:
+		return errors.New("changes: unsupported type")
+	}
+	return json.Unmarshal(b, c)
+}
+
+type HistoryEntity struct {
+	ID        int64     `db:"id"`
+	PersonID  int64     `db:"person_id"`
+	Action    string    `db:"action"`
+	Changes   Changes   `db:"changes"`
+	ChangedAt time.Time `db:"changed_at"`
+}
+
+// Diff возвращает изменённые поля данных человека. Для создания записи
+// передайте пустой old — тогда в диф попадут все заполненные поля.
+func Diff(old, new PersonEntity) Changes {
+	c := Changes{}
+	if old.Name != new.Name {
+		c["name"] = FieldChange{Old: emptyToNil(old.Name), New: emptyToNil(new.Name)}
+	}
+	if old.Surname != new.Surname {
+		c["surname"] = FieldChange{Old: emptyToNil(old.Surname), New: emptyToNil(new.Surname)}
+	}
+	diffPtr(c, "patronymic", old.Patronymic, new.Patronymic)
+	diffPtr(c, "age", old.Age, new.Age)
+	diffPtr(c, "gender", old.Gender, new.Gender)
+	diffPtr(c, "nationality", old.Nationality, new.Nationality)
+	return c
+}
+
+func diffPtr[T comparable](c Changes, field string, old, new *T) {
+	switch {
+	case old == nil && new == nil:
+	case old != nil && new != nil && *old == *new:
+	default:
+		c[field] = FieldChange{Old: deref(old), New: deref(new)}
+	}
+}
+
+func deref[T any](v *T) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func emptyToNil(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// IdempotencyKey — запрос с заголовком Idempotency-Key и ответ на него.
+type IdempotencyKey struct {
+	Key string `db:"key"`
+	// Fingerprint — хеш запроса: тот же ключ с другим запросом отвергается.
+	Fingerprint string `db:"fingerprint"`
+	// Status == 0 — первый запрос ещё выполняется, ответа нет.
+	Status    int       `db:"status"`
+	Header    Header    `db:"header"`
+	Body      []byte    `db:"body"`
+	CreatedAt time.Time `db:"created_at"`
+	// ClaimedAt — когда ключ заняли; меняется, если ключ заняли повторно.
+	ClaimedAt time.Time `db:"claimed_at"`
+	// Claim — номер захвата, растёт при каждом повторном захвате: запрос,
+	// чей ключ заняли заново, не может ни сохранить ответ, ни освободить ключ.
+	Claim int64 `db:"claim"`
+}
+
+// Header — сохранённые заголовки ответа, хранится в JSONB.
+type Header map[string]string
+
+func (h Header) Value() (driver.Value, error) {
+	if h == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(h)
+}
+
+func (h *Header) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	case nil:
+		*h = Header{}
+		return nil
+	default:
+		return errors.New("header: unsupported type")
+	}
+	return json.Unmarshal(b, h)
+}
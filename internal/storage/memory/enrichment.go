@@ -0,0 +1,191 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"person-api/internal/storage"
+)
+
+func (s *MemoryStorage) GetEnrichmentCache(_ context.Context, key string) (storage.EnrichmentCacheEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.enrichmentCache[key]
+	if !ok {
+		return storage.EnrichmentCacheEntry{}, storage.ErrNotFound
+	}
+	e.Result = append([]byte(nil), e.Result...)
+	return e, nil
+}
+
+func (s *MemoryStorage) PutEnrichmentCache(_ context.Context, e storage.EnrichmentCacheEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.Result = append([]byte(nil), e.Result...)
+	s.enrichmentCache[e.Key] = e
+	return nil
+}
+
+func (s *MemoryStorage) UpdateEnrichment(_ context.Context, id int64, fn func(*storage.PersonEntity)) (storage.PersonEntity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.persons[id]
+	if !ok || p.DeletedAt != nil {
+		return storage.PersonEntity{}, storage.ErrNotFound
+	}
+	e := clone(p)
+	fn(&e)
+	p.Age, p.Gender, p.Nationality = e.Age, e.Gender, e.Nationality
+	p.Enrichment, p.EnrichmentRetryAt = e.Enrichment, e.EnrichmentRetryAt
+	p = clone(p)
+	s.persons[id] = p
+	return clone(p), nil
+}
+
+func (s *MemoryStorage) ListEnrichmentRetries(_ context.Context, before time.Time, limit int) ([]storage.PersonEntity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []storage.PersonEntity
+	for _, p := range s.persons {
+		if p.DeletedAt == nil && p.EnrichmentRetryAt != nil && !p.EnrichmentRetryAt.After(before) {
+			out = append(out, clone(p))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].EnrichmentRetryAt, out[j].EnrichmentRetryAt
+		if !a.Equal(*b) {
+			return a.Before(*b)
+		}
+		return out[i].ID < out[j].ID
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *MemoryStorage) CreatePersonsQueued(_ context.Context, ps []storage.PersonEntity) ([]storage.PersonEntity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out, err := s.createPersons(ps)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	for _, p := range out {
+		s.enqueue(p.ID, now)
+	}
+	return out, nil
+}
+
+func (s *MemoryStorage) enqueue(personID int64, now time.Time) {
+	s.nextJobID++
+	s.jobs[s.nextJobID] = storage.EnrichmentJob{
+		ID:        s.nextJobID,
+		PersonID:  personID,
+		Status:    storage.JobQueued,
+		RunAt:     now,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+func (s *MemoryStorage) ClaimEnrichmentJobs(_ context.Context, limit int, lease time.Duration) ([]storage.EnrichmentJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var due []storage.EnrichmentJob
+	for _, j := range s.jobs {
+		if j.Status != storage.JobDead && !j.RunAt.After(now) {
+			due = append(due, j)
+		}
+	}
+	sort.Slice(due, func(a, b int) bool {
+		if !due[a].RunAt.Equal(due[b].RunAt) {
+			return due[a].RunAt.Before(due[b].RunAt)
+		}
+		return due[a].ID < due[b].ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	out := make([]storage.EnrichmentJob, len(due))
+	for i, j := range due {
+		j.Status = storage.JobRunning
+		j.Attempts++
+		j.RunAt = now.Add(lease).Truncate(time.Microsecond)
+		j.UpdatedAt = now
+		s.jobs[j.ID] = j
+		out[i] = cloneJob(j)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].ID < out[b].ID })
+	return out, nil
+}
+
+func (s *MemoryStorage) CompleteEnrichmentJob(_ context.Context, job storage.EnrichmentJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j, ok := s.jobs[job.ID]; ok && j.Attempts == job.Attempts {
+		delete(s.jobs, job.ID)
+	}
+	return nil
+}
+
+func (s *MemoryStorage) RetryEnrichmentJob(_ context.Context, job storage.EnrichmentJob, runAt time.Time, lastErr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[job.ID]
+	if !ok || j.Attempts != job.Attempts {
+		return nil
+	}
+	j.Status = storage.JobQueued
+	j.RunAt = runAt.UTC().Truncate(time.Microsecond)
+	j.LastError = &lastErr
+	j.UpdatedAt = s.now()
+	s.jobs[job.ID] = j
+	return nil
+}
+
+func (s *MemoryStorage) BuryEnrichmentJob(_ context.Context, job storage.EnrichmentJob, lastErr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[job.ID]
+	if !ok || j.Attempts != job.Attempts {
+		return nil
+	}
+	j.Status = storage.JobDead
+	j.LastError = &lastErr
+	j.UpdatedAt = s.now()
+	s.jobs[job.ID] = j
+	return nil
+}
+
+func (s *MemoryStorage) EnrichmentQueueStats(_ context.Context) (storage.EnrichmentQueueStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var st storage.EnrichmentQueueStats
+	for _, j := range s.jobs {
+		switch j.Status {
+		case storage.JobQueued:
+			st.Queued++
+			if st.OldestQueued == nil || j.CreatedAt.Before(*st.OldestQueued) {
+				t := j.CreatedAt
+				st.OldestQueued = &t
+			}
+		case storage.JobRunning:
+			st.Running++
+		case storage.JobDead:
+			st.Dead++
+		}
+	}
+	return st, nil
+}
+
+func cloneJob(j storage.EnrichmentJob) storage.EnrichmentJob {
+	if j.LastError != nil {
+		e := *j.LastError
+		j.LastError = &e
+	}
+	return j
+}
@@ -0,0 +1,72 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	"person-api/internal/storage"
+)
+
+func (s *MemoryStorage) ClaimIdempotencyKey(_ context.Context, key, fingerprint string, staleBefore time.Time) (storage.IdempotencyKey, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if k, ok := s.idempotency[key]; ok {
+		if k.Status != 0 || k.Fingerprint != fingerprint || !k.ClaimedAt.Before(staleBefore) {
+			return cloneKey(k), false, nil
+		}
+		k.ClaimedAt = now
+		k.Claim++
+		s.idempotency[key] = k
+		return cloneKey(k), true, nil
+	}
+	k := storage.IdempotencyKey{Key: key, Fingerprint: fingerprint, Header: storage.Header{}, CreatedAt: now, ClaimedAt: now, Claim: 1}
+	s.idempotency[key] = k
+	return cloneKey(k), true, nil
+}
+
+func (s *MemoryStorage) CompleteIdempotencyKey(_ context.Context, k storage.IdempotencyKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, ok := s.idempotency[k.Key]
+	if !ok || cur.Claim != k.Claim {
+		return storage.ErrNotFound
+	}
+	cur.Status, cur.Header, cur.Body = k.Status, k.Header, k.Body
+	s.idempotency[k.Key] = cloneKey(cur)
+	return nil
+}
+
+func (s *MemoryStorage) DeleteIdempotencyKey(_ context.Context, key string, claim int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k, ok := s.idempotency[key]; ok && k.Claim == claim {
+		delete(s.idempotency, key)
+	}
+	return nil
+}
+
+func (s *MemoryStorage) PurgeIdempotencyKeys(_ context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for key, k := range s.idempotency {
+		if k.CreatedAt.Before(before) {
+			delete(s.idempotency, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func cloneKey(k storage.IdempotencyKey) storage.IdempotencyKey {
+	k.Header = maps.Clone(k.Header)
+	if k.Header == nil {
+		k.Header = storage.Header{}
+	}
+	if k.Body != nil {
+		k.Body = append([]byte(nil), k.Body...)
+	}
+	return k
+}
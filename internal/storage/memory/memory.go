@@ -0,0 +1,537 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"person-api/internal/storage"
+)
+
+// MemoryStorage хранит данные в памяти процесса и повторяет поведение
+// PostgresStorage: фильтры, сортировку, пагинацию, историю и ошибки
+// (storage.ErrNotFound, storage.ErrVersionConflict). Подходит для локального
+// запуска и тестов; данные теряются при перезапуске.
+type MemoryStorage struct {
+	mu              sync.RWMutex
+	persons         map[int64]storage.PersonEntity
+	history         []storage.HistoryEntity
+	nextID          int64
+	nextHistoryID   int64
+	idempotency     map[string]storage.IdempotencyKey
+	enrichmentCache map[string]storage.EnrichmentCacheEntry
+	jobs            map[int64]storage.EnrichmentJob
+	nextJobID       int64
+	now             func() time.Time
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		persons:         make(map[int64]storage.PersonEntity),
+		idempotency:     make(map[string]storage.IdempotencyKey),
+		enrichmentCache: make(map[string]storage.EnrichmentCacheEntry),
+		jobs:            make(map[int64]storage.EnrichmentJob),
+		now: func() time.Time {
+			// Postgres хранит микросекунды
+			return time.Now().UTC().Truncate(time.Microsecond)
+		},
+	}
+}
+
+func (s *MemoryStorage) CreatePerson(_ context.Context, p storage.PersonEntity) (storage.PersonEntity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	now := s.now()
+	p = clone(p)
+	p.ID = s.nextID
+	p.CreatedAt, p.UpdatedAt = now, now
+	p.DeletedAt = nil
+	p.Version = 1
+	p.Score = nil
+	if err := s.addHistory(p.ID, storage.ActionCreate, storage.Diff(storage.PersonEntity{}, p), now); err != nil {
+		return storage.PersonEntity{}, err
+	}
+	s.persons[p.ID] = p
+	return clone(p), nil
+}
+
+func (s *MemoryStorage) CreatePersons(_ context.Context, ps []storage.PersonEntity) ([]storage.PersonEntity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createPersons(ps)
+}
+
+func (s *MemoryStorage) createPersons(ps []storage.PersonEntity) ([]storage.PersonEntity, error) {
+	// как и транзакция в Postgres: при ошибке ничего не сохраняем
+	nextID, nextHistoryID, historyLen := s.nextID, s.nextHistoryID, len(s.history)
+	now := s.now()
+	out := make([]storage.PersonEntity, len(ps))
+	for i, p := range ps {
+		s.nextID++
+		p = clone(p)
+		p.ID = s.nextID
+		p.CreatedAt, p.UpdatedAt = now, now
+		p.DeletedAt = nil
+		p.Version = 1
+		p.Score = nil
+		if err := s.addHistory(p.ID, storage.ActionCreate, storage.Diff(storage.PersonEntity{}, p), now); err != nil {
+			s.nextID, s.nextHistoryID, s.history = nextID, nextHistoryID, s.history[:historyLen]
+			return nil, err
+		}
+		out[i] = p
+	}
+	for i, p := range out {
+		s.persons[p.ID] = p
+		out[i] = clone(p)
+	}
+	return out, nil
+}
+
+func (s *MemoryStorage) UpdatePerson(_ context.Context, id int64, p storage.PersonEntity) (storage.PersonEntity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.persons[id]
+	if !ok || old.DeletedAt != nil {
+		return storage.PersonEntity{}, storage.ErrNotFound
+	}
+	if p.Version != 0 && p.Version != old.Version {
+		return storage.PersonEntity{}, storage.ErrVersionConflict
+	}
+	now := s.now()
+	p = clone(p)
+	p.ID = id
+	p.CreatedAt = old.CreatedAt
+	p.UpdatedAt = now
+	p.DeletedAt = nil
+	p.Version = old.Version + 1
+	p.Score = nil
+	if changes := storage.Diff(old, p); len(changes) > 0 {
+		if err := s.addHistory(id, storage.ActionUpdate, changes, now); err != nil {
+			return storage.PersonEntity{}, err
+		}
+	}
+	s.persons[id] = p
+	return clone(p), nil
+}
+
+func (s *MemoryStorage) DeletePerson(_ context.Context, id int64, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.persons[id]
+	if !ok || p.DeletedAt != nil {
+		return storage.ErrNotFound
+	}
+	if version != 0 && version != p.Version {
+		return storage.ErrVersionConflict
+	}
+	now := s.now()
+	p.DeletedAt = &now
+	p.Version++
+	if err := s.addHistory(id, storage.ActionDelete, storage.Changes{"deleted_at": {Old: nil, New: now}}, now); err != nil {
+		return err
+	}
+	s.persons[id] = p
+	return nil
+}
+
+func (s *MemoryStorage) RestorePerson(_ context.Context, id int64) (storage.PersonEntity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.persons[id]
+	if !ok || p.DeletedAt == nil {
+		return storage.PersonEntity{}, storage.ErrNotFound
+	}
+	now := s.now()
+	deletedAt := *p.DeletedAt
+	p.DeletedAt = nil
+	p.UpdatedAt = now
+	p.Version++
+	if err := s.addHistory(id, storage.ActionRestore, storage.Changes{"deleted_at": {Old: deletedAt, New: nil}}, now); err != nil {
+		return storage.PersonEntity{}, err
+	}
+	if p.Enrichment.Queued() {
+		s.enqueue(id, now)
+	}
+	s.persons[id] = p
+	return clone(p), nil
+}
+
+func (s *MemoryStorage) PurgeDeleted(_ context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for id, p := range s.persons {
+		if p.DeletedAt != nil && p.DeletedAt.Before(before) {
+			delete(s.persons, id)
+			n++
+		}
+	}
+	// как ON DELETE CASCADE в Postgres
+	for id, j := range s.jobs {
+		if _, ok := s.persons[j.PersonID]; !ok {
+			delete(s.jobs, id)
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStorage) GetPersonByID(_ context.Context, id int64) (storage.PersonEntity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.persons[id]
+	if !ok || p.DeletedAt != nil {
+		return storage.PersonEntity{}, storage.ErrNotFound
+	}
+	return clone(p), nil
+}
+
+func (s *MemoryStorage) FindPersonsByNames(_ context.Context, names []storage.FullName) ([]storage.PersonEntity, error) {
+	keys := make(map[storage.FullName]bool, len(names))
+	for _, n := range names {
+		keys[lowerName(n.Name, n.Surname, n.Patronymic)] = true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []storage.PersonEntity
+	for _, p := range s.persons {
+		if p.DeletedAt != nil {
+			continue
+		}
+		patronymic := ""
+		if p.Patronymic != nil {
+			patronymic = *p.Patronymic
+		}
+		if keys[lowerName(p.Name, p.Surname, patronymic)] {
+			out = append(out, clone(p))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func lowerName(name, surname, patronymic string) storage.FullName {
+	return storage.FullName{Name: strings.ToLower(name), Surname: strings.ToLower(surname), Patronymic: strings.ToLower(patronymic)}
+}
+
+func (s *MemoryStorage) GetPersonHistory(_ context.Context, id int64) ([]storage.HistoryEntity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var items []storage.HistoryEntity
+	for _, h := range s.history {
+		if h.PersonID == id {
+			items = append(items, h)
+		}
+	}
+	if _, ok := s.persons[id]; !ok && len(items) == 0 {
+		return nil, storage.ErrNotFound
+	}
+	return items, nil
+}
+
+func (s *MemoryStorage) ListPersons(_ context.Context, params storage.ListParams) (storage.PagedResult, error) {
+	items := s.selectSorted(params)
+	order := storage.NormalizeSort(params.Sort)
+	total := int64(len(items))
+
+	if params.After != nil {
+		if len(params.After.Values) != len(order) {
+			return storage.PagedResult{}, fmt.Errorf("%w: cursor has %d values, sort has %d fields", storage.ErrInvalid, len(params.After.Values), len(order))
+		}
+		after, err := cursorEntity(order, params.After.Values)
+		if err != nil {
+			return storage.PagedResult{}, err
+		}
+		start := sort.Search(len(items), func(i int) bool {
+			return compare(items[i], after, order) > 0
+		})
+		items = items[start:]
+	} else if params.Offset < len(items) {
+		items = items[params.Offset:]
+	} else {
+		items = nil
+	}
+
+	hasMore := len(items) > params.Limit
+	if hasMore {
+		items = items[:params.Limit]
+	}
+	out := make([]storage.PersonEntity, len(items))
+	for i, p := range items {
+		out[i] = clone(p)
+	}
+	if params.SkipCount {
+		total = 0
+	}
+	return storage.PagedResult{Items: out, TotalCount: total, HasMore: hasMore}, nil
+}
+
+// addHistory сохраняет изменения через JSON, как колонка jsonb: числа
+// становятся float64, время — строкой.
+func (s *MemoryStorage) addHistory(personID int64, action string, changes storage.Changes, at time.Time) error {
+	raw, err := changes.Value()
+	if err != nil {
+		return err
+	}
+	stored := storage.Changes{}
+	if err := stored.Scan(raw); err != nil {
+		return err
+	}
+	s.nextHistoryID++
+	s.history = append(s.history, storage.HistoryEntity{
+		ID:        s.nextHistoryID,
+		PersonID:  personID,
+		Action:    action,
+		Changes:   stored,
+		ChangedAt: at,
+	})
+	return nil
+}
+
+func (s *MemoryStorage) ExportPersons(ctx context.Context, params storage.ListParams, fn func(storage.PersonEntity) error) error {
+	for _, p := range s.selectSorted(params) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(clone(p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectSorted возвращает записи, подходящие под фильтры params, в порядке сортировки.
+func (s *MemoryStorage) selectSorted(params storage.ListParams) []storage.PersonEntity {
+	s.mu.RLock()
+	var items []storage.PersonEntity
+	for _, p := range s.persons {
+		if p, ok := match(p, params); ok {
+			items = append(items, p)
+		}
+	}
+	s.mu.RUnlock()
+
+	order := storage.NormalizeSort(params.Sort)
+	sort.Slice(items, func(i, j int) bool {
+		return compare(items[i], items[j], order) < 0
+	})
+	return items
+}
+
+// match применяет фильтры ListParams и при поиске заполняет Score.
+func match(p storage.PersonEntity, params storage.ListParams) (storage.PersonEntity, bool) {
+	if !params.IncludeDeleted && p.DeletedAt != nil {
+		return p, false
+	}
+	if params.NameContains != nil && !containsFold(p.Name, *params.NameContains) {
+		return p, false
+	}
+	if params.SurnameContains != nil && !containsFold(p.Surname, *params.SurnameContains) {
+		return p, false
+	}
+	if len(params.Genders) > 0 && (p.Gender == nil || !contains(params.Genders, *p.Gender)) {
+		return p, false
+	}
+	if len(params.Nationalities) > 0 && (p.Nationality == nil || !contains(params.Nationalities, *p.Nationality)) {
+		return p, false
+	}
+	if params.MinAge != nil && (p.Age == nil || *p.Age < *params.MinAge) {
+		return p, false
+	}
+	if params.MaxAge != nil && (p.Age == nil || *p.Age > *params.MaxAge) {
+		return p, false
+	}
+	p.Score = nil
+	if params.Search != nil {
+		score, ok := searchScore(storage.NormalizeSearch(*params.Search), searchText(p))
+		if !ok {
+			return p, false
+		}
+		p.Score = &score
+	}
+	return p, true
+}
+
+// compare упорядочивает записи так же, как ORDER BY в PostgresStorage.
+func compare(a, b storage.PersonEntity, order []storage.SortField) int {
+	for _, f := range order {
+		av, bv := value(a, f.Column), value(b, f.Column)
+		var c int
+		switch {
+		case av == nil && bv == nil:
+			continue
+		case av == nil:
+			// NULL не зависит от направления сортировки
+			c = 1
+			if f.NullsFirst {
+				c = -1
+			}
+		case bv == nil:
+			c = -1
+			if f.NullsFirst {
+				c = 1
+			}
+		default:
+			c = compareValues(av, bv)
+			if f.Desc {
+				c = -c
+			}
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareValues(a, b interface{}) int {
+	switch av := a.(type) {
+	case int64:
+		bv := b.(int64)
+		switch {
+		case av < bv:
+			return -1
+		case av > bv:
+			return 1
+		}
+		return 0
+	case float64:
+		bv := b.(float64)
+		switch {
+		case av < bv:
+			return -1
+		case av > bv:
+			return 1
+		}
+		return 0
+	case time.Time:
+		return av.Compare(b.(time.Time))
+	case string:
+		// побайтно, как COLLATE "C" в PostgresStorage
+		return strings.Compare(av, b.(string))
+	}
+	return 0
+}
+
+// value возвращает значение колонки для сравнения; nil — NULL.
+func value(p storage.PersonEntity, column string) interface{} {
+	switch column {
+	case "id":
+		return p.ID
+	case "name":
+		return p.Name
+	case "surname":
+		return p.Surname
+	case "created_at":
+		return p.CreatedAt
+	case "updated_at":
+		return p.UpdatedAt
+	case "age":
+		if p.Age == nil {
+			return nil
+		}
+		return int64(*p.Age)
+	case storage.ScoreColumn:
+		if p.Score == nil {
+			return nil
+		}
+		return *p.Score
+	}
+	if v := storage.SortValue(p, column); v != nil {
+		return *v
+	}
+	return nil
+}
+
+// cursorEntity собирает запись из значений курсора, чтобы сравнивать её через compare.
+func cursorEntity(order []storage.SortField, values []*string) (storage.PersonEntity, error) {
+	var p storage.PersonEntity
+	for i, f := range order {
+		v := values[i]
+		if v == nil {
+			continue
+		}
+		var err error
+		switch f.Column {
+		case "id":
+			p.ID, err = strconv.ParseInt(*v, 10, 64)
+		case "name":
+			p.Name = *v
+		case "surname":
+			p.Surname = *v
+		case "patronymic":
+			p.Patronymic = strPtr(*v)
+		case "gender":
+			p.Gender = strPtr(*v)
+		case "nationality":
+			p.Nationality = strPtr(*v)
+		case "age":
+			var age int
+			age, err = strconv.Atoi(*v)
+			p.Age = &age
+		case "created_at":
+			p.CreatedAt, err = time.Parse(time.RFC3339Nano, *v)
+		case "updated_at":
+			p.UpdatedAt, err = time.Parse(time.RFC3339Nano, *v)
+		case storage.ScoreColumn:
+			var score float64
+			score, err = strconv.ParseFloat(*v, 64)
+			p.Score = &score
+		}
+		if err != nil {
+			return p, fmt.Errorf("%w: cursor value for %s: %w", storage.ErrInvalid, f.Column, err)
+		}
+	}
+	return p, nil
+}
+
+func clone(p storage.PersonEntity) storage.PersonEntity {
+	p.Patronymic = clonePtr(p.Patronymic)
+	p.Age = clonePtr(p.Age)
+	p.Gender = clonePtr(p.Gender)
+	p.Nationality = clonePtr(p.Nationality)
+	p.DeletedAt = clonePtr(p.DeletedAt)
+	p.Score = clonePtr(p.Score)
+	p.EnrichmentRetryAt = clonePtr(p.EnrichmentRetryAt)
+	if p.Enrichment != nil {
+		e := make(storage.Enrichment, len(p.Enrichment))
+		for attr, src := range p.Enrichment {
+			src.Probability = clonePtr(src.Probability)
+			src.Count = clonePtr(src.Count)
+			src.Candidates = append([]storage.Candidate(nil), src.Candidates...)
+			src.RetryAt = clonePtr(src.RetryAt)
+			e[attr] = src
+		}
+		p.Enrichment = e
+	}
+	return p
+}
+
+func clonePtr[T any](v *T) *T {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	return &c
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func containsFold(s, sub string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(sub))
+}
+
+func contains(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
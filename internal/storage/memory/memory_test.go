@@ -0,0 +1,235 @@
+// internal/storage/memory/memory_test.go
+package memory
+
+import (
+	"context"
+	"person-api/internal/storage"
+	"person-api/internal/storage/storagetest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func seed(t *testing.T, s *MemoryStorage, persons ...storage.PersonEntity) []storage.PersonEntity {
+	t.Helper()
+	out := make([]storage.PersonEntity, len(persons))
+	for i, p := range persons {
+		created, err := s.CreatePerson(context.Background(), p)
+		require.NoError(t, err)
+		out[i] = created
+	}
+	return out
+}
+
+func TestCreateAndGet(t *testing.T) {
+	s := NewMemoryStorage()
+	ctx := context.Background()
+
+	created, err := s.CreatePerson(ctx, storage.PersonEntity{Name: "Ivan", Surname: "Ivanov", Age: ptr(30)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), created.ID)
+	assert.Equal(t, int64(1), created.Version)
+	assert.False(t, created.CreatedAt.IsZero())
+
+	got, err := s.GetPersonByID(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, created, got)
+
+	// возвращённая запись не разделяет память с хранилищем
+	*got.Age = 99
+	again, _ := s.GetPersonByID(ctx, created.ID)
+	assert.Equal(t, 30, *again.Age)
+
+	_, err = s.GetPersonByID(ctx, 42)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestUpdatePerson_Version(t *testing.T) {
+	s := NewMemoryStorage()
+	ctx := context.Background()
+	p := seed(t, s, storage.PersonEntity{Name: "A", Surname: "B"})[0]
+
+	p.Name = "C"
+	p.Version = 1
+	upd, err := s.UpdatePerson(ctx, p.ID, p)
+	require.NoError(t, err)
+	assert.Equal(t, "C", upd.Name)
+	assert.Equal(t, int64(2), upd.Version)
+
+	_, err = s.UpdatePerson(ctx, p.ID, p)
+	assert.ErrorIs(t, err, storage.ErrVersionConflict)
+
+	_, err = s.UpdatePerson(ctx, 42, p)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestDeleteRestorePurge(t *testing.T) {
+	s := NewMemoryStorage()
+	ctx := context.Background()
+	p := seed(t, s, storage.PersonEntity{Name: "A", Surname: "B"})[0]
+
+	assert.ErrorIs(t, s.DeletePerson(ctx, p.ID, 5), storage.ErrVersionConflict)
+	require.NoError(t, s.DeletePerson(ctx, p.ID, 0))
+	assert.ErrorIs(t, s.DeletePerson(ctx, p.ID, 0), storage.ErrNotFound)
+	_, err := s.GetPersonByID(ctx, p.ID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	res, err := s.ListPersons(ctx, storage.ListParams{Limit: 10, IncludeDeleted: true})
+	require.NoError(t, err)
+	require.Len(t, res.Items, 1)
+	assert.NotNil(t, res.Items[0].DeletedAt)
+
+	restored, err := s.RestorePerson(ctx, p.ID)
+	require.NoError(t, err)
+	assert.Nil(t, restored.DeletedAt)
+	assert.Equal(t, int64(3), restored.Version)
+	_, err = s.RestorePerson(ctx, p.ID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	require.NoError(t, s.DeletePerson(ctx, p.ID, 0))
+	n, err := s.PurgeDeleted(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	h, err := s.GetPersonHistory(ctx, p.ID)
+	require.NoError(t, err)
+	var actions []string
+	for _, e := range h {
+		actions = append(actions, e.Action)
+	}
+	assert.Equal(t, []string{storage.ActionCreate, storage.ActionDelete, storage.ActionRestore, storage.ActionDelete}, actions)
+
+	_, err = s.GetPersonHistory(ctx, 42)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestListPersons_Filters(t *testing.T) {
+	s := NewMemoryStorage()
+	seed(t, s,
+		storage.PersonEntity{Name: "Ivan", Surname: "Ivanov", Age: ptr(30), Gender: ptr("male"), Nationality: ptr("RU")},
+		storage.PersonEntity{Name: "Anna", Surname: "Petrova", Age: ptr(25), Gender: ptr("female"), Nationality: ptr("UA")},
+		storage.PersonEntity{Name: "Ivanna", Surname: "Sidorova"},
+	)
+
+	res, err := s.ListPersons(context.Background(), storage.ListParams{NameContains: ptr("IVAN"), Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), res.TotalCount)
+
+	res, err = s.ListPersons(context.Background(), storage.ListParams{
+		Genders: []string{"female", "male"}, MinAge: ptr(26), Limit: 10,
+	})
+	require.NoError(t, err)
+	require.Len(t, res.Items, 1)
+	assert.Equal(t, "Ivan", res.Items[0].Name)
+
+	res, err = s.ListPersons(context.Background(), storage.ListParams{Nationalities: []string{"UA"}, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, res.Items, 1)
+	assert.Equal(t, "Anna", res.Items[0].Name)
+}
+
+func TestListPersons_SortAndPages(t *testing.T) {
+	s := NewMemoryStorage()
+	seed(t, s,
+		storage.PersonEntity{Name: "A", Surname: "X", Age: ptr(30)},
+		storage.PersonEntity{Name: "B", Surname: "X"},
+		storage.PersonEntity{Name: "C", Surname: "X", Age: ptr(20)},
+		storage.PersonEntity{Name: "D", Surname: "X", Age: ptr(30)},
+	)
+	ctx := context.Background()
+	sort := []storage.SortField{{Column: "age", Desc: true, NullsFirst: false}}
+
+	res, err := s.ListPersons(ctx, storage.ListParams{Sort: sort, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A", "D", "C", "B"}, names(res.Items))
+
+	res, err = s.ListPersons(ctx, storage.ListParams{Sort: sort, Offset: 1, Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"D", "C"}, names(res.Items))
+	assert.True(t, res.HasMore)
+
+	// keyset: продолжаем после записи D (age=30, id=4)
+	res, err = s.ListPersons(ctx, storage.ListParams{
+		Sort: sort, Limit: 10, SkipCount: true,
+		After: &storage.Cursor{Values: []*string{ptr("30"), ptr("4")}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"C", "B"}, names(res.Items))
+	assert.False(t, res.HasMore)
+	assert.Zero(t, res.TotalCount)
+
+	// NULL-значение в курсоре
+	res, err = s.ListPersons(ctx, storage.ListParams{
+		Sort: []storage.SortField{{Column: "age", NullsFirst: true}}, Limit: 10,
+		After: &storage.Cursor{Values: []*string{nil, ptr("2")}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"C", "A", "D"}, names(res.Items))
+}
+
+func TestListPersons_Search(t *testing.T) {
+	s := NewMemoryStorage()
+	seed(t, s,
+		storage.PersonEntity{Name: "Иван", Surname: "Петров"},
+		storage.PersonEntity{Name: "Ivana", Surname: "Petrova"},
+		storage.PersonEntity{Name: "Anna", Surname: "Sidorova"},
+	)
+
+	res, err := s.ListPersons(context.Background(), storage.ListParams{
+		Search: ptr("ivan"),
+		Sort:   []storage.SortField{{Column: storage.ScoreColumn, Desc: true, NullsFirst: true}},
+		Limit:  10,
+	})
+	require.NoError(t, err)
+	require.Len(t, res.Items, 2)
+	assert.Equal(t, "Иван", res.Items[0].Name)
+	assert.Equal(t, 1.0, *res.Items[0].Score)
+	assert.Less(t, *res.Items[1].Score, 1.0)
+}
+
+func TestWordSimilarity(t *testing.T) {
+	// пример из документации pg_trgm
+	assert.InDelta(t, 0.8, wordSimilarity("word", "two words"), 1e-6)
+	assert.Equal(t, 0.0, wordSimilarity("", "two words"))
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	s := NewMemoryStorage()
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := s.CreatePerson(ctx, storage.PersonEntity{Name: "A", Surname: "B"})
+			assert.NoError(t, err)
+			_, err = s.ListPersons(ctx, storage.ListParams{Limit: 5})
+			assert.NoError(t, err)
+			_, err = s.UpdatePerson(ctx, p.ID, storage.PersonEntity{Name: "C", Surname: "D"})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	res, err := s.ListPersons(ctx, storage.ListParams{Limit: 100})
+	require.NoError(t, err)
+	assert.Equal(t, int64(50), res.TotalCount)
+}
+
+func names(items []storage.PersonEntity) []string {
+	out := make([]string, len(items))
+	for i, p := range items {
+		out[i] = p.Name
+	}
+	return out
+}
+
+func TestStorageContract(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return NewMemoryStorage()
+	})
+}
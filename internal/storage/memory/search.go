@@ -0,0 +1,105 @@
+package memory
+
+import (
+	"strings"
+	"unicode"
+
+	"person-api/internal/storage"
+)
+
+// Порог оператора <% из pg_trgm (pg_trgm.word_similarity_threshold по умолчанию).
+const wordSimilarityThreshold = 0.6
+
+// tsRankSingle — значение ts_rank для одного вхождения без весов; точный
+// ранг Postgres зависит от позиций слов, здесь хватает порядка величины.
+const tsRankSingle = 0.0607927
+
+// searchText повторяет генерируемую колонку search_text.
+func searchText(p storage.PersonEntity) string {
+	patronymic := ""
+	if p.Patronymic != nil {
+		patronymic = *p.Patronymic
+	}
+	return storage.NormalizeSearch(p.Name + " " + p.Surname + " " + patronymic)
+}
+
+// searchScore повторяет условие и выражение релевантности PostgresStorage:
+// запись подходит, если q <% text или все слова q есть в text.
+func searchScore(q, text string) (float64, bool) {
+	sim := wordSimilarity(q, text)
+	rank := 0.0
+	if tsMatch(q, text) {
+		rank = float64(float32(tsRankSingle))
+	}
+	if sim < wordSimilarityThreshold && rank == 0 {
+		return 0, false
+	}
+	return max(sim, rank), true
+}
+
+// wordSimilarity — аналог word_similarity из pg_trgm: лучшая похожесть
+// триграмм q на непрерывный отрезок упорядоченных триграмм text.
+func wordSimilarity(q, text string) float64 {
+	qSet := make(map[string]bool)
+	for _, t := range trigrams(q) {
+		qSet[t] = true
+	}
+	if len(qSet) == 0 {
+		return 0
+	}
+	seq := trigrams(text)
+	best := 0.0
+	for i := range seq {
+		seen := make(map[string]bool)
+		count := 0
+		for j := i; j < len(seq); j++ {
+			if seen[seq[j]] {
+				continue
+			}
+			seen[seq[j]] = true
+			if qSet[seq[j]] {
+				count++
+			}
+			sml := float64(count) / float64(len(qSet)+len(seen)-count)
+			best = max(best, sml)
+		}
+	}
+	// pg_trgm считает в float4
+	return float64(float32(best))
+}
+
+// trigrams разбивает строку на слова и дополняет каждое пробелами, как pg_trgm.
+func trigrams(s string) []string {
+	var out []string
+	for _, w := range words(s) {
+		r := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(r); i++ {
+			out = append(out, string(r[i:i+3]))
+		}
+	}
+	return out
+}
+
+// tsMatch повторяет search_tsv @@ plainto_tsquery('simple', q).
+func tsMatch(q, text string) bool {
+	terms := words(q)
+	if len(terms) == 0 {
+		return false
+	}
+	have := make(map[string]bool)
+	for _, w := range words(text) {
+		have[w] = true
+	}
+	for _, t := range terms {
+		if !have[t] {
+			return false
+		}
+	}
+	return true
+}
+
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,155 @@
+package postgres
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"person-api/internal/storage"
+)
+
+func (s *PostgresStorage) GetEnrichmentCache(ctx context.Context, key string) (storage.EnrichmentCacheEntry, error) {
+	var e storage.EnrichmentCacheEntry
+	err := s.db.GetContext(ctx, &e, `SELECT key, result, expires_at FROM enrichment_cache WHERE key=$1`, key)
+	if err != nil {
+		return storage.EnrichmentCacheEntry{}, translateError(err)
+	}
+	return e, nil
+}
+
+func (s *PostgresStorage) PutEnrichmentCache(ctx context.Context, e storage.EnrichmentCacheEntry) error {
+	_, err := s.db.ExecContext(ctx, `
+    INSERT INTO enrichment_cache (key, result, expires_at) VALUES ($1, $2, $3)
+    ON CONFLICT (key) DO UPDATE SET result = EXCLUDED.result, expires_at = EXCLUDED.expires_at`,
+		e.Key, e.Result, e.ExpiresAt)
+	return translateError(err)
+}
+
+func (s *PostgresStorage) UpdateEnrichment(ctx context.Context, id int64, fn func(*storage.PersonEntity)) (storage.PersonEntity, error) {
+	var p storage.PersonEntity
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		lockQ := `SELECT ` + personColumns + ` FROM persons WHERE id=$1 AND deleted_at IS NULL FOR UPDATE`
+		if err := tx.GetContext(ctx, &p, lockQ, id); err != nil {
+			return err
+		}
+		p = enrichedCopy(p, fn)
+		const q = `
+    UPDATE persons SET
+      age = :age,
+      gender = :gender,
+      nationality = :nationality,
+      enrichment = :enrichment,
+      enrichment_retry_at = :enrichment_retry_at
+    WHERE id = :id`
+		_, err := tx.NamedExecContext(ctx, q, p)
+		return err
+	})
+	if err != nil {
+		return storage.PersonEntity{}, err
+	}
+	return p, nil
+}
+
+// enrichedCopy — p с полями обогащения, которые изменила fn.
+func enrichedCopy(p storage.PersonEntity, fn func(*storage.PersonEntity)) storage.PersonEntity {
+	e := p
+	fn(&e)
+	p.Age, p.Gender, p.Nationality = e.Age, e.Gender, e.Nationality
+	p.Enrichment, p.EnrichmentRetryAt = e.Enrichment, e.EnrichmentRetryAt
+	return p
+}
+
+func (s *PostgresStorage) ListEnrichmentRetries(ctx context.Context, before time.Time, limit int) ([]storage.PersonEntity, error) {
+	var items []storage.PersonEntity
+	const q = `
+    SELECT ` + personColumns + `
+      FROM persons
+     WHERE enrichment_retry_at <= $1 AND deleted_at IS NULL
+     ORDER BY enrichment_retry_at, id LIMIT $2`
+	if err := s.db.SelectContext(ctx, &items, q, before, limit); err != nil {
+		return nil, translateError(err)
+	}
+	return items, nil
+}
+
+func (s *PostgresStorage) CreatePersonsQueued(ctx context.Context, ps []storage.PersonEntity) ([]storage.PersonEntity, error) {
+	return s.createPersons(ctx, ps, true)
+}
+
+func enqueueEnrichment(ctx context.Context, tx *sqlx.Tx, ps []storage.PersonEntity) error {
+	ids := make([]int64, len(ps))
+	for i, p := range ps {
+		ids[i] = p.ID
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO enrichment_jobs (person_id) SELECT unnest($1::bigint[])`, pq.Array(ids))
+	return err
+}
+
+const jobColumns = "id, person_id, status, attempts, run_at, last_error, created_at, updated_at"
+
+func (s *PostgresStorage) ClaimEnrichmentJobs(ctx context.Context, limit int, lease time.Duration) ([]storage.EnrichmentJob, error) {
+	// SKIP LOCKED: задания, которые в этот момент берёт другой обработчик, не ждём
+	const q = `
+    UPDATE enrichment_jobs
+       SET status = 'running', attempts = attempts + 1,
+           run_at = NOW() + make_interval(secs => $1), updated_at = NOW()
+     WHERE id IN (
+        SELECT id FROM enrichment_jobs
+         WHERE status <> 'dead' AND run_at <= NOW()
+         ORDER BY run_at, id
+         LIMIT $2
+           FOR UPDATE SKIP LOCKED)
+    RETURNING ` + jobColumns
+	var jobs []storage.EnrichmentJob
+	if err := s.db.SelectContext(ctx, &jobs, q, lease.Seconds(), limit); err != nil {
+		return nil, translateError(err)
+	}
+	// RETURNING не гарантирует порядок
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs, nil
+}
+
+func (s *PostgresStorage) CompleteEnrichmentJob(ctx context.Context, job storage.EnrichmentJob) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM enrichment_jobs WHERE id=$1 AND attempts=$2`, job.ID, job.Attempts)
+	return translateError(err)
+}
+
+func (s *PostgresStorage) RetryEnrichmentJob(ctx context.Context, job storage.EnrichmentJob, runAt time.Time, lastErr string) error {
+	_, err := s.db.ExecContext(ctx, `
+    UPDATE enrichment_jobs SET status = 'queued', run_at = $3, last_error = $4, updated_at = NOW()
+     WHERE id = $1 AND attempts = $2`, job.ID, job.Attempts, runAt, lastErr)
+	return translateError(err)
+}
+
+func (s *PostgresStorage) BuryEnrichmentJob(ctx context.Context, job storage.EnrichmentJob, lastErr string) error {
+	_, err := s.db.ExecContext(ctx, `
+    UPDATE enrichment_jobs SET status = 'dead', last_error = $3, updated_at = NOW()
+     WHERE id = $1 AND attempts = $2`, job.ID, job.Attempts, lastErr)
+	return translateError(err)
+}
+
+func (s *PostgresStorage) EnrichmentQueueStats(ctx context.Context) (storage.EnrichmentQueueStats, error) {
+	var rows []struct {
+		Status string     `db:"status"`
+		Count  int64      `db:"count"`
+		Oldest *time.Time `db:"oldest"`
+	}
+	const q = `SELECT status, COUNT(*) AS count, MIN(created_at) AS oldest FROM enrichment_jobs GROUP BY status`
+	if err := s.db.SelectContext(ctx, &rows, q); err != nil {
+		return storage.EnrichmentQueueStats{}, translateError(err)
+	}
+	var st storage.EnrichmentQueueStats
+	for _, r := range rows {
+		switch r.Status {
+		case storage.JobQueued:
+			st.Queued, st.OldestQueued = r.Count, r.Oldest
+		case storage.JobRunning:
+			st.Running = r.Count
+		case storage.JobDead:
+			st.Dead = r.Count
+		}
+	}
+	return st, nil
+}
@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/lib/pq"
+
+	"person-api/internal/storage"
+)
+
+// translateError переводит ошибки database/sql и lib/pq в ошибки пакета storage.
+// Неизвестные ошибки возвращаются как есть.
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var (
+		pqErr  *pq.Error
+		netErr net.Error
+	)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return storage.ErrNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%w: %w", storage.ErrTimeout, err)
+	case errors.As(err, &pqErr):
+		if target := pqErrorKind(pqErr); target != nil {
+			return fmt.Errorf("%w: %w", target, err)
+		}
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone):
+		return fmt.Errorf("%w: %w", storage.ErrUnavailable, err)
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return fmt.Errorf("%w: %w", storage.ErrTimeout, err)
+		}
+		return fmt.Errorf("%w: %w", storage.ErrUnavailable, err)
+	}
+	return err
+}
+
+// pqErrorKind сопоставляет SQLSTATE ошибке storage; nil — ошибка не классифицирована.
+// Коды: https://www.postgresql.org/docs/current/errcodes-appendix.html
+func pqErrorKind(err *pq.Error) error {
+	switch err.Code {
+	case "23505", "23503": // unique_violation, foreign_key_violation
+		return storage.ErrConflict
+	case "57014", "55P03": // query_canceled (statement_timeout), lock_not_available
+		return storage.ErrTimeout
+	case "57P01", "57P02", "57P03": // admin_shutdown, crash_shutdown, cannot_connect_now
+		return storage.ErrUnavailable
+	}
+	switch err.Code.Class() {
+	case "22", "23": // data_exception, integrity_constraint_violation
+		return storage.ErrInvalid
+	case "40": // serialization_failure, deadlock_detected
+		return storage.ErrConflict
+	case "08", "53": // connection_exception, insufficient_resources
+		return storage.ErrUnavailable
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"person-api/internal/storage"
+)
+
+const idempotencyColumns = "key, fingerprint, status, header, body, created_at, claimed_at, claim"
+
+// claimAttempts — сколько раз повторять захват ключа, если его удаляют
+// между INSERT и SELECT.
+const claimAttempts = 3
+
+func (s *PostgresStorage) ClaimIdempotencyKey(ctx context.Context, key, fingerprint string, staleBefore time.Time) (storage.IdempotencyKey, bool, error) {
+	const insertQ = `
+    INSERT INTO idempotency_keys (key, fingerprint) VALUES ($1, $2)
+    ON CONFLICT (key) DO UPDATE SET claimed_at = CURRENT_TIMESTAMP, claim = idempotency_keys.claim + 1
+    WHERE idempotency_keys.status = 0 AND idempotency_keys.fingerprint = EXCLUDED.fingerprint
+      AND idempotency_keys.claimed_at < $3
+    RETURNING ` + idempotencyColumns
+	const selectQ = `SELECT ` + idempotencyColumns + ` FROM idempotency_keys WHERE key=$1`
+	for i := 0; i < claimAttempts; i++ {
+		var k storage.IdempotencyKey
+		err := s.db.GetContext(ctx, &k, insertQ, key, fingerprint, staleBefore)
+		if err == nil {
+			return k, true, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return storage.IdempotencyKey{}, false, translateError(err)
+		}
+		err = s.db.GetContext(ctx, &k, selectQ, key)
+		if err == nil {
+			return k, false, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return storage.IdempotencyKey{}, false, translateError(err)
+		}
+	}
+	return storage.IdempotencyKey{}, false, storage.ErrConflict
+}
+
+func (s *PostgresStorage) CompleteIdempotencyKey(ctx context.Context, k storage.IdempotencyKey) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE idempotency_keys SET status=$2, header=$3, body=$4 WHERE key=$1 AND claim=$5`,
+		k.Key, k.Status, k.Header, k.Body, k.Claim)
+	if err != nil {
+		return translateError(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStorage) DeleteIdempotencyKey(ctx context.Context, key string, claim int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE key=$1 AND claim=$2`, key, claim)
+	return translateError(err)
+}
+
+func (s *PostgresStorage) PurgeIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, translateError(err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,125 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+
+	"github.com/pressly/goose/v3"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migrationLockID — ключ pg_advisory_lock, под которым выполняются миграции.
+const migrationLockID int64 = 0x7065_7273_6f6e // "person"
+
+// Команды Migrate.
+const (
+	MigrateUp     = "up"
+	MigrateDown   = "down"
+	MigrateRedo   = "redo"
+	MigrateStatus = "status"
+)
+
+// MigrationStatus — состояние одной миграции после выполнения команды.
+type MigrationStatus struct {
+	Version int64
+	File    string
+	Applied bool
+	// AppliedAt заполняется только для команды status.
+	AppliedAt string
+}
+
+// Migrate выполняет команду над встроенными миграциями. Для up, down и redo
+// возвращает затронутые миграции, для status — все. Несколько реплик,
+// запущенных одновременно, выполняют миграции по очереди.
+func (s *PostgresStorage) Migrate(ctx context.Context, command string) ([]MigrationStatus, error) {
+	switch command {
+	case MigrateUp, MigrateDown, MigrateRedo, MigrateStatus:
+	default:
+		return nil, fmt.Errorf("unknown migrate command %q", command)
+	}
+	provider, err := newMigrationProvider(s.db.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	// блокировка сессионная, поэтому держим одно соединение до конца
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return nil, fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID) //nolint:errcheck // блокировка снимется и при закрытии соединения
+
+	var results []*goose.MigrationResult
+	switch command {
+	case MigrateUp:
+		results, err = provider.Up(ctx)
+	case MigrateDown:
+		var res *goose.MigrationResult
+		res, err = provider.Down(ctx)
+		results = append(results, res)
+	case MigrateRedo:
+		var down, up *goose.MigrationResult
+		if down, err = provider.Down(ctx); err == nil {
+			up, err = provider.UpByOne(ctx)
+		}
+		results = append(results, down, up)
+	case MigrateStatus:
+		return migrationStatus(ctx, provider)
+	}
+
+	out := make([]MigrationStatus, 0, len(results))
+	for _, r := range results {
+		if r == nil || r.Source == nil {
+			continue
+		}
+		out = append(out, MigrationStatus{
+			Version: r.Source.Version,
+			File:    r.Source.Path,
+			Applied: r.Direction == "up" && r.Error == nil,
+		})
+	}
+	if err != nil {
+		return out, fmt.Errorf("migrate %s: %w", command, err)
+	}
+	return out, nil
+}
+
+func newMigrationProvider(db *sql.DB) (*goose.Provider, error) {
+	fsys, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	provider, err := goose.NewProvider(goose.DialectPostgres, db, fsys)
+	if err != nil {
+		return nil, fmt.Errorf("load migrations: %w", err)
+	}
+	return provider, nil
+}
+
+func migrationStatus(ctx context.Context, provider *goose.Provider) ([]MigrationStatus, error) {
+	statuses, err := provider.Status(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("migrate status: %w", err)
+	}
+	out := make([]MigrationStatus, len(statuses))
+	for i, st := range statuses {
+		out[i] = MigrationStatus{
+			Version: st.Source.Version,
+			File:    st.Source.Path,
+			Applied: st.State == goose.StateApplied,
+		}
+		if !st.AppliedAt.IsZero() {
+			out[i].AppliedAt = st.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+	}
+	return out, nil
+}
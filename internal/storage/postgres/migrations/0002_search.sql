@@ -0,0 +1,38 @@
+-- internal/storage/migrations/0002_search.sql
+
+-- +goose Up
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- должна совпадать с storage.NormalizeSearch
+-- +goose StatementBegin
+CREATE FUNCTION person_translit(s TEXT) RETURNS TEXT
+    LANGUAGE SQL IMMUTABLE PARALLEL SAFE AS
+$$
+SELECT translate(
+           replace(replace(replace(replace(replace(replace(replace(replace(
+               lower(s),
+               'щ', 'shch'), 'ж', 'zh'), 'х', 'kh'), 'ц', 'ts'),
+               'ч', 'ch'), 'ш', 'sh'), 'ю', 'yu'), 'я', 'ya'),
+           'абвгдеёзийклмнопрстуфыэъь',
+           'abvgdeeziyklmnoprstufye')
+$$;
+-- +goose StatementEnd
+
+ALTER TABLE persons
+    ADD COLUMN search_text TEXT GENERATED ALWAYS AS (
+        person_translit(name || ' ' || surname || ' ' || coalesce(patronymic, ''))
+    ) STORED,
+    ADD COLUMN search_tsv TSVECTOR GENERATED ALWAYS AS (
+        to_tsvector('simple', person_translit(name || ' ' || surname || ' ' || coalesce(patronymic, '')))
+    ) STORED;
+
+CREATE INDEX persons_search_text_trgm_idx ON persons USING GIN (search_text gin_trgm_ops);
+CREATE INDEX persons_search_tsv_idx ON persons USING GIN (search_tsv);
+
+-- +goose Down
+DROP INDEX IF EXISTS persons_search_tsv_idx;
+DROP INDEX IF EXISTS persons_search_text_trgm_idx;
+ALTER TABLE persons
+    DROP COLUMN IF EXISTS search_tsv,
+    DROP COLUMN IF EXISTS search_text;
+DROP FUNCTION IF EXISTS person_translit(TEXT);
@@ -0,0 +1,11 @@
+-- internal/storage/migrations/0003_soft_delete.sql
+
+-- +goose Up
+ALTER TABLE persons ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- для фоновой очистки: индекс только по удалённым записям
+CREATE INDEX persons_deleted_at_idx ON persons (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS persons_deleted_at_idx;
+ALTER TABLE persons DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,16 @@
+-- internal/storage/migrations/0004_person_history.sql
+
+-- +goose Up
+-- без внешнего ключа: история переживает окончательное удаление записи
+CREATE TABLE person_history (
+    id BIGSERIAL PRIMARY KEY,
+    person_id INT NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    changes JSONB NOT NULL DEFAULT '{}',
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX person_history_person_id_idx ON person_history (person_id, id);
+
+-- +goose Down
+DROP TABLE IF EXISTS person_history;
@@ -0,0 +1,7 @@
+-- internal/storage/migrations/0005_version.sql
+
+-- +goose Up
+ALTER TABLE persons ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+-- +goose Down
+ALTER TABLE persons DROP COLUMN IF EXISTS version;
@@ -0,0 +1,9 @@
+-- internal/storage/migrations/0007_enrichment.sql
+
+-- +goose Up
+-- откуда получены age, gender и nationality: провайдер, вероятность, размер
+-- выборки и для nationality — все варианты по убыванию вероятности
+ALTER TABLE persons ADD COLUMN enrichment JSONB NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE persons DROP COLUMN IF EXISTS enrichment;
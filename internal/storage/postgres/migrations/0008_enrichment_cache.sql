@@ -0,0 +1,13 @@
+-- internal/storage/migrations/0008_enrichment_cache.sql
+
+-- +goose Up
+-- ответы провайдеров обогащения по нормализованному имени; result с value = null —
+-- провайдер не знает имя
+CREATE TABLE enrichment_cache (
+    key TEXT PRIMARY KEY,
+    result JSONB NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS enrichment_cache;
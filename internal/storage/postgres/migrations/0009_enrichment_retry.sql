@@ -0,0 +1,13 @@
+-- internal/storage/migrations/0009_enrichment_retry.sql
+
+-- +goose Up
+-- когда повторить обогащение атрибутов, которые не удалось получить
+ALTER TABLE persons ADD COLUMN enrichment_retry_at TIMESTAMPTZ;
+
+-- для фоновых повторов: индекс только по записям, которые ждут повтора
+CREATE INDEX persons_enrichment_retry_at_idx ON persons (enrichment_retry_at)
+    WHERE enrichment_retry_at IS NOT NULL AND deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS persons_enrichment_retry_at_idx;
+ALTER TABLE persons DROP COLUMN IF EXISTS enrichment_retry_at;
@@ -0,0 +1,22 @@
+-- internal/storage/migrations/0010_enrichment_jobs.sql
+
+-- +goose Up
+-- очередь асинхронного обогащения; у running-задания run_at — конец аренды,
+-- после него задание снова можно взять
+CREATE TABLE enrichment_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    person_id BIGINT NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    status VARCHAR(16) NOT NULL DEFAULT 'queued',
+    attempts INT NOT NULL DEFAULT 0,
+    run_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- для выборки обработчиками: dead-задания не выбираются
+CREATE INDEX enrichment_jobs_run_at_idx ON enrichment_jobs (run_at, id) WHERE status <> 'dead';
+CREATE INDEX enrichment_jobs_person_id_idx ON enrichment_jobs (person_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS enrichment_jobs;
@@ -0,0 +1,9 @@
+-- internal/storage/migrations/0011_idempotency_lease.sql
+
+-- +goose Up
+-- когда ключ заняли в последний раз: ключ без ответа, занятый слишком давно,
+-- можно занять снова — первый запрос, скорее всего, прервался вместе с процессом
+ALTER TABLE idempotency_keys ADD COLUMN claimed_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS claimed_at;
@@ -0,0 +1,9 @@
+-- internal/storage/migrations/0012_person_full_name_idx.sql
+
+-- +goose Up
+-- поиск дубликатов при импорте: ФИО без учёта регистра, см. FindPersonsByNames
+CREATE INDEX persons_full_name_idx ON persons (lower(name), lower(surname), lower(coalesce(patronymic, '')))
+    WHERE deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS persons_full_name_idx;
@@ -0,0 +1,9 @@
+-- internal/storage/migrations/0013_idempotency_claim.sql
+
+-- +goose Up
+-- номер захвата ключа: растёт при каждом повторном захвате, ответ сохраняет
+-- и ключ освобождает только запрос с последним номером
+ALTER TABLE idempotency_keys ADD COLUMN claim BIGINT NOT NULL DEFAULT 1;
+
+-- +goose Down
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS claim;
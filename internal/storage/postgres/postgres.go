@@ -3,15 +3,18 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"person-api/internal/storage"
 )
 
+const personColumns = "id, name, surname, patronymic, age, gender, nationality, enrichment, enrichment_retry_at, created_at, updated_at, deleted_at, version"
+
 type PostgresStorage struct {
 	db *sqlx.DB
 }
@@ -27,28 +30,124 @@ func NewPostgresStorage(dsn string) (*PostgresStorage, error) {
 	return &PostgresStorage{db: db}, nil
 }
 
+func (s *PostgresStorage) Close() error {
+	return s.db.Close()
+}
+
+// CreatePerson, UpdatePerson, DeletePerson и RestorePerson пишут строку
+// person_history в той же транзакции, что и само изменение.
 func (s *PostgresStorage) CreatePerson(ctx context.Context, p storage.PersonEntity) (storage.PersonEntity, error) {
 	const q = `
-    INSERT INTO persons (name, surname, patronymic, age, gender, nationality)
-    VALUES (:name, :surname, :patronymic, :age, :gender, :nationality)
-    RETURNING id, created_at, updated_at`
-	rows, err := s.db.NamedQueryContext(ctx, q, p)
+    INSERT INTO persons (name, surname, patronymic, age, gender, nationality, enrichment, enrichment_retry_at)
+    VALUES (:name, :surname, :patronymic, :age, :gender, :nationality, :enrichment, :enrichment_retry_at)
+    RETURNING id, created_at, updated_at, version`
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		rows, err := sqlx.NamedQueryContext(ctx, tx, q, p)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			return errors.New("insert person: no row returned")
+		}
+		if err := rows.Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt, &p.Version); err != nil {
+			return err
+		}
+		rows.Close()
+		return addHistory(ctx, tx, p.ID, storage.ActionCreate, storage.Diff(storage.PersonEntity{}, p))
+	})
 	if err != nil {
 		return storage.PersonEntity{}, err
 	}
+	return p, nil
+}
+
+// createBatchSize ограничивает число строк в одном INSERT: у запроса
+// не может быть больше 65535 параметров.
+const createBatchSize = 1000
+
+func (s *PostgresStorage) CreatePersons(ctx context.Context, ps []storage.PersonEntity) ([]storage.PersonEntity, error) {
+	return s.createPersons(ctx, ps, false)
+}
+
+// createPersons вставляет ps и при queue ставит их в очередь обогащения.
+func (s *PostgresStorage) createPersons(ctx context.Context, ps []storage.PersonEntity, queue bool) ([]storage.PersonEntity, error) {
+	if len(ps) == 0 {
+		return nil, nil
+	}
+	out := make([]storage.PersonEntity, len(ps))
+	copy(out, ps)
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		for start := 0; start < len(out); start += createBatchSize {
+			if err := insertPersons(ctx, tx, out[start:min(start+createBatchSize, len(out))]); err != nil {
+				return err
+			}
+		}
+		if queue {
+			return enqueueEnrichment(ctx, tx, out)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// insertPersons вставляет ps одним INSERT и дописывает в них id, время и версию.
+func insertPersons(ctx context.Context, tx *sqlx.Tx, ps []storage.PersonEntity) error {
+	values := make([]string, len(ps))
+	args := make([]interface{}, 0, len(ps)*8)
+	for i, p := range ps {
+		n := len(args)
+		values[i] = fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8)
+		args = append(args, p.Name, p.Surname, p.Patronymic, p.Age, p.Gender, p.Nationality, p.Enrichment, p.EnrichmentRetryAt)
+	}
+	q := `INSERT INTO persons (name, surname, patronymic, age, gender, nationality, enrichment, enrichment_retry_at) VALUES ` +
+		strings.Join(values, ", ") + ` RETURNING id, created_at, updated_at, version`
+	rows, err := tx.QueryContext(ctx, q, args...)
+	if err != nil {
+		return err
+	}
 	defer rows.Close()
-	if !rows.Next() {
-		return storage.PersonEntity{}, sql.ErrNoRows
+	// RETURNING отдаёт строки в порядке VALUES
+	n := 0
+	for rows.Next() {
+		if n == len(ps) {
+			return errors.New("insert persons: too many rows returned")
+		}
+		p := &ps[n]
+		if err := rows.Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt, &p.Version); err != nil {
+			return err
+		}
+		n++
 	}
-	if err := rows.Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt); err != nil {
-		return storage.PersonEntity{}, err
+	if err := rows.Err(); err != nil {
+		return err
 	}
-	return p, nil
+	if n != len(ps) {
+		return fmt.Errorf("insert persons: %d of %d rows returned", n, len(ps))
+	}
+	rows.Close()
+
+	values = values[:0]
+	args = args[:0]
+	for _, p := range ps {
+		n := len(args)
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d)", n+1, n+2, n+3))
+		args = append(args, p.ID, storage.ActionCreate, storage.Diff(storage.PersonEntity{}, p))
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO person_history (person_id, action, changes) VALUES `+strings.Join(values, ", "), args...)
+	return err
 }
 
 func (s *PostgresStorage) UpdatePerson(ctx context.Context, id int64, p storage.PersonEntity) (storage.PersonEntity, error) {
 	p.ID = id
-	const q = `
+	q := `
     UPDATE persons SET
       name = :name,
       surname = :surname,
@@ -56,49 +155,300 @@ func (s *PostgresStorage) UpdatePerson(ctx context.Context, id int64, p storage.
       age = :age,
       gender = :gender,
       nationality = :nationality,
-      updated_at = NOW()
-    WHERE id = :id
-    RETURNING created_at, updated_at`
-	rows, err := s.db.NamedQueryContext(ctx, q, p)
+      enrichment = :enrichment,
+      enrichment_retry_at = :enrichment_retry_at,
+      updated_at = NOW(),
+      version = version + 1
+    WHERE id = :id AND deleted_at IS NULL`
+	if p.Version != 0 {
+		q += ` AND version = :version`
+	}
+	q += `
+    RETURNING created_at, updated_at, version`
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		var old storage.PersonEntity
+		lockQ := `SELECT ` + personColumns + ` FROM persons WHERE id=$1 AND deleted_at IS NULL FOR UPDATE`
+		if err := tx.GetContext(ctx, &old, lockQ, id); err != nil {
+			return err
+		}
+		rows, err := sqlx.NamedQueryContext(ctx, tx, q, p)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			// строка заблокирована выше, значит не совпала версия
+			return storage.ErrVersionConflict
+		}
+		if err := rows.Scan(&p.CreatedAt, &p.UpdatedAt, &p.Version); err != nil {
+			return err
+		}
+		rows.Close()
+		if changes := storage.Diff(old, p); len(changes) > 0 {
+			return addHistory(ctx, tx, id, storage.ActionUpdate, changes)
+		}
+		return nil
+	})
 	if err != nil {
 		return storage.PersonEntity{}, err
 	}
-	defer rows.Close()
-	if !rows.Next() {
-		return storage.PersonEntity{}, sql.ErrNoRows
-	}
-	if err := rows.Scan(&p.CreatedAt, &p.UpdatedAt); err != nil {
+	return p, nil
+}
+
+// DeletePerson только помечает запись удалённой; окончательно её убирает PurgeDeleted.
+func (s *PostgresStorage) DeletePerson(ctx context.Context, id int64, version int64) error {
+	return s.inTx(ctx, func(tx *sqlx.Tx) error {
+		var deletedAt time.Time
+		q := `UPDATE persons SET deleted_at = NOW(), version = version + 1 WHERE id=$1 AND deleted_at IS NULL`
+		args := []interface{}{id}
+		if version != 0 {
+			q += ` AND version = $2`
+			args = append(args, version)
+		}
+		err := tx.GetContext(ctx, &deletedAt, q+` RETURNING deleted_at`, args...)
+		if errors.Is(err, sql.ErrNoRows) && version != 0 {
+			var exists bool
+			const existsQ = `SELECT EXISTS(SELECT 1 FROM persons WHERE id=$1 AND deleted_at IS NULL)`
+			if err := tx.GetContext(ctx, &exists, existsQ, id); err != nil {
+				return err
+			}
+			if exists {
+				return storage.ErrVersionConflict
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return addHistory(ctx, tx, id, storage.ActionDelete, storage.Changes{
+			"deleted_at": {Old: nil, New: deletedAt},
+		})
+	})
+}
+
+func (s *PostgresStorage) RestorePerson(ctx context.Context, id int64) (storage.PersonEntity, error) {
+	var p storage.PersonEntity
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		var deletedAt time.Time
+		const lockQ = `SELECT deleted_at FROM persons WHERE id=$1 AND deleted_at IS NOT NULL FOR UPDATE`
+		if err := tx.GetContext(ctx, &deletedAt, lockQ, id); err != nil {
+			return err
+		}
+		q := `
+    UPDATE persons SET deleted_at = NULL, updated_at = NOW(), version = version + 1
+     WHERE id=$1
+    RETURNING ` + personColumns
+		if err := tx.GetContext(ctx, &p, q, id); err != nil {
+			return err
+		}
+		if p.Enrichment.Queued() {
+			if err := enqueueEnrichment(ctx, tx, []storage.PersonEntity{p}); err != nil {
+				return err
+			}
+		}
+		return addHistory(ctx, tx, id, storage.ActionRestore, storage.Changes{
+			"deleted_at": {Old: deletedAt, New: nil},
+		})
+	})
+	if err != nil {
 		return storage.PersonEntity{}, err
 	}
 	return p, nil
 }
 
-func (s *PostgresStorage) DeletePerson(ctx context.Context, id int64) error {
-	res, err := s.db.ExecContext(ctx, `DELETE FROM persons WHERE id=$1`, id)
-	if err != nil {
-		return err
+// GetPersonHistory возвращает историю в порядке изменений. storage.ErrNotFound —
+// если такой записи нет и никогда не было.
+func (s *PostgresStorage) GetPersonHistory(ctx context.Context, id int64) ([]storage.HistoryEntity, error) {
+	var items []storage.HistoryEntity
+	const q = `
+    SELECT id, person_id, action, changes, changed_at
+      FROM person_history WHERE person_id=$1 ORDER BY id`
+	if err := s.db.SelectContext(ctx, &items, q, id); err != nil {
+		return nil, translateError(err)
+	}
+	if len(items) == 0 {
+		// записи, созданные до появления истории, её не имеют
+		var exists bool
+		if err := s.db.GetContext(ctx, &exists, `SELECT EXISTS(SELECT 1 FROM persons WHERE id=$1)`, id); err != nil {
+			return nil, translateError(err)
+		}
+		if !exists {
+			return nil, storage.ErrNotFound
+		}
 	}
-	if cnt, _ := res.RowsAffected(); cnt == 0 {
-		return sql.ErrNoRows
+	return items, nil
+}
+
+func (s *PostgresStorage) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM persons WHERE deleted_at < $1`, before)
+	if err != nil {
+		return 0, translateError(err)
 	}
-	return nil
+	return res.RowsAffected()
 }
 
 func (s *PostgresStorage) GetPersonByID(ctx context.Context, id int64) (storage.PersonEntity, error) {
 	var p storage.PersonEntity
-	const q = `
-    SELECT id, name, surname, patronymic, age, gender, nationality, created_at, updated_at
-      FROM persons WHERE id=$1`
+	q := `
+    SELECT ` + personColumns + `
+      FROM persons WHERE id=$1 AND deleted_at IS NULL`
 	if err := s.db.GetContext(ctx, &p, q, id); err != nil {
-		return storage.PersonEntity{}, err
+		return storage.PersonEntity{}, translateError(err)
 	}
 	return p, nil
 }
 
+func (s *PostgresStorage) FindPersonsByNames(ctx context.Context, names []storage.FullName) ([]storage.PersonEntity, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	first := make([]string, len(names))
+	last := make([]string, len(names))
+	middle := make([]string, len(names))
+	for i, n := range names {
+		first[i], last[i], middle[i] = n.Name, n.Surname, n.Patronymic
+	}
+	// выражение совпадает с индексом persons_full_name_idx
+	q := `
+    SELECT ` + personColumns + `
+      FROM persons
+     WHERE deleted_at IS NULL
+       AND (lower(name), lower(surname), lower(coalesce(patronymic, ''))) IN (
+           SELECT lower(n), lower(s), lower(p) FROM unnest($1::text[], $2::text[], $3::text[]) AS k(n, s, p))
+     ORDER BY id`
+	var ps []storage.PersonEntity
+	if err := s.db.SelectContext(ctx, &ps, q, pq.Array(first), pq.Array(last), pq.Array(middle)); err != nil {
+		return nil, translateError(err)
+	}
+	return ps, nil
+}
+
 func (s *PostgresStorage) ListPersons(ctx context.Context, params storage.ListParams) (storage.PagedResult, error) {
-	var conds []string
-	var args []interface{}
+	conds, args, score := filterConditions(params)
+	idx := len(args) + 1
+
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int64
+	if !params.SkipCount {
+		countQ := fmt.Sprintf("SELECT COUNT(*) FROM persons %s", where)
+		if err := s.db.GetContext(ctx, &total, countQ, args...); err != nil {
+			return storage.PagedResult{}, translateError(err)
+		}
+	}
+
+	sort := storage.NormalizeSort(params.Sort)
+
+	// курсор сужает только выборку страницы, но не общий счётчик
+	page := ""
+	if params.After != nil {
+		if len(params.After.Values) != len(sort) {
+			return storage.PagedResult{}, fmt.Errorf("%w: cursor has %d values, sort has %d fields", storage.ErrInvalid, len(params.After.Values), len(sort))
+		}
+		var cond string
+		cond, args = keysetCondition(sort, params.After.Values, args, score)
+		idx = len(args) + 1
+		conds = append(conds, cond)
+		page = fmt.Sprintf("LIMIT $%d", idx)
+		args = append(args, params.Limit+1)
+	} else {
+		page = fmt.Sprintf("LIMIT $%d OFFSET $%d", idx, idx+1)
+		args = append(args, params.Limit+1, params.Offset)
+	}
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	columns := personColumns
+	if score != "" {
+		columns += ", " + score + " AS score"
+	}
+	dataQ := fmt.Sprintf(`
+    SELECT %s
+      FROM persons %s ORDER BY %s %s`, columns, where, orderBy(sort), page)
+
+	var items []storage.PersonEntity
+	if err := s.db.SelectContext(ctx, &items, dataQ, args...); err != nil {
+		return storage.PagedResult{}, translateError(err)
+	}
+
+	// лишняя строка нужна только чтобы понять, есть ли следующая страница
+	hasMore := len(items) > params.Limit
+	if hasMore {
+		items = items[:params.Limit]
+	}
+
+	return storage.PagedResult{Items: items, TotalCount: total, HasMore: hasMore}, nil
+}
+
+// exportFetchSize — сколько строк ExportPersons читает из курсора за раз.
+const exportFetchSize = 500
+
+// ExportPersons читает записи через серверный курсор порциями по
+// exportFetchSize, поэтому память не растёт с размером выборки.
+func (s *PostgresStorage) ExportPersons(ctx context.Context, params storage.ListParams, fn func(storage.PersonEntity) error) error {
+	conds, args, score := filterConditions(params)
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+	columns := personColumns
+	if score != "" {
+		columns += ", " + score + " AS score"
+	}
+	declareQ := fmt.Sprintf(`
+    DECLARE person_export NO SCROLL CURSOR FOR
+    SELECT %s
+      FROM persons %s ORDER BY %s`, columns, where, orderBy(storage.NormalizeSort(params.Sort)))
+
+	// курсор живёт до конца транзакции
+	return s.inTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, declareQ, args...); err != nil {
+			return err
+		}
+		fetchQ := fmt.Sprintf(`FETCH FORWARD %d FROM person_export`, exportFetchSize)
+		for {
+			rows, err := tx.QueryxContext(ctx, fetchQ)
+			if err != nil {
+				return err
+			}
+			n := 0
+			for rows.Next() {
+				var p storage.PersonEntity
+				if err := rows.StructScan(&p); err != nil {
+					rows.Close()
+					return err
+				}
+				n++
+				if err := fn(p); err != nil {
+					rows.Close()
+					return err
+				}
+			}
+			if err := rows.Err(); err != nil {
+				rows.Close()
+				return err
+			}
+			rows.Close()
+			if n < exportFetchSize {
+				return nil
+			}
+		}
+	})
+}
+
+// filterConditions строит условия WHERE по фильтрам params. score — выражение
+// релевантности для поиска, пустое без Search.
+func filterConditions(params storage.ListParams) (conds []string, args []interface{}, score string) {
 	idx := 1
+	if !params.IncludeDeleted {
+		conds = append(conds, "deleted_at IS NULL")
+	}
 	if params.NameContains != nil {
 		conds = append(conds, fmt.Sprintf("name ILIKE $%d", idx))
 		args = append(args, "%"+*params.NameContains+"%")
@@ -109,6 +459,16 @@ func (s *PostgresStorage) ListPersons(ctx context.Context, params storage.ListPa
 		args = append(args, "%"+*params.SurnameContains+"%")
 		idx++
 	}
+	if len(params.Genders) > 0 {
+		conds = append(conds, fmt.Sprintf("gender = ANY($%d)", idx))
+		args = append(args, pq.Array(params.Genders))
+		idx++
+	}
+	if len(params.Nationalities) > 0 {
+		conds = append(conds, fmt.Sprintf("nationality = ANY($%d)", idx))
+		args = append(args, pq.Array(params.Nationalities))
+		idx++
+	}
 	if params.MinAge != nil {
 		conds = append(conds, fmt.Sprintf("age >= $%d", idx))
 		args = append(args, *params.MinAge)
@@ -119,27 +479,127 @@ func (s *PostgresStorage) ListPersons(ctx context.Context, params storage.ListPa
 		args = append(args, *params.MaxAge)
 		idx++
 	}
+	// score — выражение релевантности; оба условия поиска используют GIN-индексы
+	if params.Search != nil {
+		conds = append(conds, fmt.Sprintf(
+			"($%[1]d <%% search_text OR search_tsv @@ plainto_tsquery('simple', $%[1]d))", idx))
+		score = fmt.Sprintf(
+			"GREATEST(word_similarity($%[1]d, search_text), ts_rank(search_tsv, plainto_tsquery('simple', $%[1]d)))::float8", idx)
+		args = append(args, storage.NormalizeSearch(*params.Search))
+	}
+	return conds, args, score
+}
 
-	where := ""
-	if len(conds) > 0 {
-		where = "WHERE " + strings.Join(conds, " AND ")
+// notNullColumns не требуют проверок на NULL в условии курсора.
+var notNullColumns = map[string]struct{}{"id": {}, "name": {}, "surname": {}, storage.ScoreColumn: {}}
+
+// textColumns сравниваются побайтно (COLLATE "C"), как в memory-хранилище:
+// иначе порядок и курсор зависели бы от collation базы.
+var textColumns = map[string]struct{}{"name": {}, "surname": {}, "patronymic": {}, "gender": {}, "nationality": {}}
+
+// sortExpr возвращает выражение колонки для ORDER BY и условия курсора.
+func sortExpr(column string) string {
+	if _, ok := textColumns[column]; ok {
+		return column + ` COLLATE "C"`
 	}
+	return column
+}
 
-	var total int64
-	countQ := fmt.Sprintf("SELECT COUNT(*) FROM persons %s", where)
-	if err := s.db.GetContext(ctx, &total, countQ, args...); err != nil {
-		return storage.PagedResult{}, err
+// inTx выполняет fn в транзакции и переводит ошибку в ошибки пакета storage.
+func (s *PostgresStorage) inTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return translateError(err)
+	}
+	defer tx.Rollback() //nolint:errcheck // после Commit откат ничего не делает
+	if err := fn(tx); err != nil {
+		return translateError(err)
 	}
+	return translateError(tx.Commit())
+}
 
-	dataQ := fmt.Sprintf(`
-    SELECT id, name, surname, patronymic, age, gender, nationality, created_at, updated_at
-      FROM persons %s ORDER BY id LIMIT $%d OFFSET $%d`, where, idx, idx+1)
-	args = append(args, params.Limit, params.Offset)
+func addHistory(ctx context.Context, tx *sqlx.Tx, personID int64, action string, changes storage.Changes) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO person_history (person_id, action, changes) VALUES ($1, $2, $3)`,
+		personID, action, changes)
+	return err
+}
 
-	var items []storage.PersonEntity
-	if err := s.db.SelectContext(ctx, &items, dataQ, args...); err != nil {
-		return storage.PagedResult{}, err
+func orderBy(sort []storage.SortField) string {
+	parts := make([]string, len(sort))
+	for i, f := range sort {
+		// колонки уже проверены через storage.IsSortable
+		part := sortExpr(f.Column)
+		if f.Desc {
+			part += " DESC"
+		}
+		// по умолчанию Postgres ставит NULL последними для ASC и первыми для DESC
+		if f.NullsFirst != f.Desc {
+			if f.NullsFirst {
+				part += " NULLS FIRST"
+			} else {
+				part += " NULLS LAST"
+			}
+		}
+		parts[i] = part
+	}
+	return strings.Join(parts, ", ")
+}
+
+// keysetCondition строит условие «строка идёт после курсора» для составного
+// порядка с учётом направления и положения NULL:
+// (f1 после v1) OR (f1 = v1 AND f2 после v2) OR ...
+// score подставляется вместо псевдоколонки storage.ScoreColumn.
+func keysetCondition(sort []storage.SortField, values []*string, args []interface{}, score string) (string, []interface{}) {
+	column := func(f storage.SortField) string {
+		if f.Column == storage.ScoreColumn {
+			return score
+		}
+		return sortExpr(f.Column)
+	}
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		if v != nil {
+			args = append(args, *v)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
 	}
 
-	return storage.PagedResult{Items: items, TotalCount: total}, nil
+	var branches []string
+	for i, f := range sort {
+		var after string
+		switch {
+		case values[i] == nil && f.NullsFirst:
+			after = column(f) + " IS NOT NULL"
+		case values[i] == nil:
+			// после NULL при NULLS LAST идут только такие же NULL
+		default:
+			op := ">"
+			if f.Desc {
+				op = "<"
+			}
+			after = fmt.Sprintf("%s %s %s", column(f), op, placeholders[i])
+			if _, notNull := notNullColumns[f.Column]; !notNull && !f.NullsFirst {
+				after = fmt.Sprintf("(%s OR %s IS NULL)", after, column(f))
+			}
+		}
+		if after != "" {
+			eqs := make([]string, 0, i+1)
+			for j := 0; j < i; j++ {
+				if values[j] == nil {
+					eqs = append(eqs, column(sort[j])+" IS NULL")
+				} else {
+					eqs = append(eqs, fmt.Sprintf("%s = %s", column(sort[j]), placeholders[j]))
+				}
+			}
+			branches = append(branches, strings.Join(append(eqs, after), " AND "))
+		}
+	}
+	if len(branches) == 0 {
+		return "FALSE", args
+	}
+	if len(branches) == 1 {
+		return branches[0], args
+	}
+	return "(" + strings.Join(branches, " OR ") + ")", args
 }
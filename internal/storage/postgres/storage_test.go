@@ -4,15 +4,22 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"net"
+	"os"
 	"person-api/internal/storage"
+	"person-api/internal/storage/storagetest"
 	"regexp"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCreatePerson_QuerySuccess(t *testing.T) {
@@ -23,18 +30,24 @@ func TestCreatePerson_QuerySuccess(t *testing.T) {
 	store := &PostgresStorage{db: sqlxDB}
 
 	// Expect INSERT with named params
+	mock.ExpectBegin()
 	mock.ExpectQuery(regexp.QuoteMeta(
-		`INSERT INTO persons (name, surname, patronymic, age, gender, nationality)
-    VALUES ($1, $2, $3, $4, $5, $6)
-    RETURNING id, created_at, updated_at`)).
-		WithArgs("A", "B", nil, nil, nil, nil).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
-			AddRow(1, time.Now(), time.Now()))
+		`INSERT INTO persons (name, surname, patronymic, age, gender, nationality, enrichment, enrichment_retry_at)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+    RETURNING id, created_at, updated_at, version`)).
+		WithArgs("A", "B", nil, nil, nil, nil, []byte(`{}`), nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "version"}).
+			AddRow(1, time.Now(), time.Now(), 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO person_history (person_id, action, changes) VALUES ($1, $2, $3)")).
+		WithArgs(1, storage.ActionCreate, []byte(`{"name":{"old":null,"new":"A"},"surname":{"old":null,"new":"B"}}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
 	ent := storage.PersonEntity{Name: "A", Surname: "B"}
 	got, err := store.CreatePerson(context.Background(), ent)
 	assert.NoError(t, err)
 	assert.Equal(t, int64(1), got.ID)
+	assert.Equal(t, int64(1), got.Version)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -44,10 +57,57 @@ func TestCreatePerson_NoRows(t *testing.T) {
 	sqlxDB := sqlx.NewDb(db, "postgres")
 	store := &PostgresStorage{db: sqlxDB}
 
+	mock.ExpectBegin()
 	mock.ExpectQuery("INSERT INTO persons").
 		WillReturnRows(sqlmock.NewRows([]string{}))
+	mock.ExpectRollback()
 	_, err := store.CreatePerson(context.Background(), storage.PersonEntity{Name: "X"})
-	assert.Equal(t, sql.ErrNoRows, err)
+	assert.EqualError(t, err, "insert person: no row returned")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreatePersons(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	store := &PostgresStorage{db: sqlx.NewDb(db, "postgres")}
+
+	age := 30
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`INSERT INTO persons (name, surname, patronymic, age, gender, nationality, enrichment, enrichment_retry_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8), ($9, $10, $11, $12, $13, $14, $15, $16) RETURNING id, created_at, updated_at, version`)).
+		WithArgs("A", "B", nil, 30, nil, nil, []byte(`{"age":{"provider":"agify","count":120}}`), nil, "C", "D", nil, nil, nil, nil, []byte(`{}`), nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "version"}).
+			AddRow(7, time.Now(), time.Now(), 1).
+			AddRow(8, time.Now(), time.Now(), 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO person_history (person_id, action, changes) VALUES ($1, $2, $3), ($4, $5, $6)")).
+		WithArgs(7, storage.ActionCreate, sqlmock.AnyArg(), 8, storage.ActionCreate, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	got, err := store.CreatePersons(context.Background(), []storage.PersonEntity{
+		{Name: "A", Surname: "B", Age: &age, Enrichment: storage.Enrichment{"age": {Provider: "agify", Count: ptrInt(120)}}},
+		{Name: "C", Surname: "D"},
+	})
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, int64(7), got[0].ID)
+	assert.Equal(t, "C", got[1].Name)
+	assert.Equal(t, int64(8), got[1].ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreatePersons_Rollback(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	store := &PostgresStorage{db: sqlx.NewDb(db, "postgres")}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO persons").WillReturnError(&pq.Error{Code: "22001"})
+	mock.ExpectRollback()
+
+	_, err := store.CreatePersons(context.Background(), []storage.PersonEntity{{Name: "A", Surname: "B"}})
+	assert.ErrorIs(t, err, storage.ErrInvalid)
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestUpdatePerson_Success(t *testing.T) {
@@ -58,15 +118,25 @@ func TestUpdatePerson_Success(t *testing.T) {
 	id := int64(2)
 	created := time.Now()
 
-	mock.ExpectQuery("UPDATE persons SET").
-		WithArgs("A", "B", nil, nil, nil, nil, id).
-		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).
-			AddRow(created, time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM persons WHERE id=$1 AND deleted_at IS NULL FOR UPDATE")).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname", "nationality"}).AddRow(id, "A", "B", "RU"))
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE id = $9 AND deleted_at IS NULL AND version = $10")).
+		WithArgs("A", "B", nil, nil, nil, "KZ", []byte(`{}`), nil, id, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at", "version"}).
+			AddRow(created, time.Now(), 4))
+	mock.ExpectExec("INSERT INTO person_history").
+		WithArgs(id, storage.ActionUpdate, []byte(`{"nationality":{"old":"RU","new":"KZ"}}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
-	ent := storage.PersonEntity{Name: "A", Surname: "B"}
+	ent := storage.PersonEntity{Name: "A", Surname: "B", Nationality: ptrString("KZ"), Version: 3}
 	got, err := store.UpdatePerson(context.Background(), id, ent)
 	assert.NoError(t, err)
 	assert.Equal(t, created.Format(time.RFC3339), got.CreatedAt.Format(time.RFC3339))
+	assert.Equal(t, int64(4), got.Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestUpdatePerson_NoRows(t *testing.T) {
@@ -75,10 +145,51 @@ func TestUpdatePerson_NoRows(t *testing.T) {
 	sqlxDB := sqlx.NewDb(db, "postgres")
 	store := &PostgresStorage{db: sqlxDB}
 
-	mock.ExpectQuery("UPDATE persons SET").
+	mock.ExpectBegin()
+	mock.ExpectQuery("FOR UPDATE").
 		WillReturnRows(sqlmock.NewRows([]string{}))
+	mock.ExpectRollback()
 	_, err := store.UpdatePerson(context.Background(), 5, storage.PersonEntity{})
-	assert.Equal(t, sql.ErrNoRows, err)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdatePerson_VersionConflict(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := &PostgresStorage{db: sqlxDB}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FOR UPDATE").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname", "version"}).AddRow(2, "A", "B", 6))
+	mock.ExpectQuery("AND version = \\$10").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at", "version"}))
+	mock.ExpectRollback()
+	_, err := store.UpdatePerson(context.Background(), 2, storage.PersonEntity{Name: "A", Surname: "B", Version: 5})
+	assert.ErrorIs(t, err, storage.ErrVersionConflict)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdatePerson_RowsError(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	store := &PostgresStorage{db: sqlx.NewDb(db, "postgres")}
+
+	// ошибка чтения результата — не конфликт версий
+	mock.ExpectBegin()
+	mock.ExpectQuery("FOR UPDATE").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname", "version"}).AddRow(2, "A", "B", 5))
+	mock.ExpectQuery("AND version = \\$10").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at", "version"}).
+			AddRow(time.Now(), time.Now(), 6).RowError(0, &pq.Error{Code: "57P01"}))
+	mock.ExpectRollback()
+	_, err := store.UpdatePerson(context.Background(), 2, storage.PersonEntity{Name: "A", Surname: "B", Version: 5})
+	assert.ErrorIs(t, err, storage.ErrUnavailable)
+	assert.NotErrorIs(t, err, storage.ErrVersionConflict)
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestDeletePerson_Success(t *testing.T) {
@@ -87,11 +198,18 @@ func TestDeletePerson_Success(t *testing.T) {
 	sqlxDB := sqlx.NewDb(db, "postgres")
 	store := &PostgresStorage{db: sqlxDB}
 
-	mock.ExpectExec("DELETE FROM persons WHERE id=\\$1").
+	deletedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE persons SET deleted_at = NOW(), version = version + 1 WHERE id=$1 AND deleted_at IS NULL RETURNING deleted_at")).
 		WithArgs(3).
-		WillReturnResult(sqlmock.NewResult(0, 1))
-	err := store.DeletePerson(context.Background(), 3)
+		WillReturnRows(sqlmock.NewRows([]string{"deleted_at"}).AddRow(deletedAt))
+	mock.ExpectExec("INSERT INTO person_history").
+		WithArgs(3, storage.ActionDelete, []byte(`{"deleted_at":{"old":null,"new":"2024-01-02T03:04:05Z"}}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	err := store.DeletePerson(context.Background(), 3, 0)
 	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestDeletePerson_NotFound(t *testing.T) {
@@ -100,11 +218,388 @@ func TestDeletePerson_NotFound(t *testing.T) {
 	sqlxDB := sqlx.NewDb(db, "postgres")
 	store := &PostgresStorage{db: sqlxDB}
 
-	mock.ExpectExec("DELETE FROM persons WHERE id=\\$1").
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE persons SET deleted_at").
 		WithArgs(4).
-		WillReturnResult(sqlmock.NewResult(0, 0))
-	err := store.DeletePerson(context.Background(), 4)
-	assert.Equal(t, sql.ErrNoRows, err)
+		WillReturnRows(sqlmock.NewRows([]string{"deleted_at"}))
+	mock.ExpectRollback()
+	err := store.DeletePerson(context.Background(), 4, 0)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeletePerson_VersionConflict(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := &PostgresStorage{db: sqlxDB}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE id=$1 AND deleted_at IS NULL AND version = $2 RETURNING deleted_at")).
+		WithArgs(4, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"deleted_at"}))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS(SELECT 1 FROM persons WHERE id=$1 AND deleted_at IS NULL)")).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+	err := store.DeletePerson(context.Background(), 4, 2)
+	assert.ErrorIs(t, err, storage.ErrVersionConflict)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRestorePerson(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := &PostgresStorage{db: sqlxDB}
+
+	deletedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	cols := []string{"id", "name", "surname", "patronymic", "age", "gender", "nationality", "created_at", "updated_at", "deleted_at"}
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT deleted_at FROM persons WHERE id=$1 AND deleted_at IS NOT NULL FOR UPDATE")).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"deleted_at"}).AddRow(deletedAt))
+	mock.ExpectQuery("UPDATE persons SET deleted_at = NULL").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(cols).AddRow(5, "N", "S", nil, nil, nil, nil, time.Now(), time.Now(), nil))
+	mock.ExpectExec("INSERT INTO person_history").
+		WithArgs(5, storage.ActionRestore, []byte(`{"deleted_at":{"old":"2024-01-02T03:04:05Z","new":null}}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	// атрибуты ждут очереди: запись ставится в неё заново
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT deleted_at FROM persons WHERE id=$1 AND deleted_at IS NOT NULL FOR UPDATE")).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"deleted_at"}).AddRow(deletedAt))
+	mock.ExpectQuery("UPDATE persons SET deleted_at = NULL").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(append(cols, "enrichment")).AddRow(7, "N", "S", nil, nil, nil, nil, time.Now(), time.Now(), nil, []byte(`{"age":{"status":"pending","provider":""}}`)))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO enrichment_jobs (person_id) SELECT unnest($1::bigint[])")).
+		WithArgs(pq.Array([]int64{7})).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO person_history").
+		WithArgs(7, storage.ActionRestore, []byte(`{"deleted_at":{"old":"2024-01-02T03:04:05Z","new":null}}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT deleted_at FROM persons").
+		WithArgs(6).
+		WillReturnRows(sqlmock.NewRows([]string{"deleted_at"}))
+	mock.ExpectRollback()
+
+	got, err := store.RestorePerson(context.Background(), 5)
+	assert.NoError(t, err)
+	assert.Nil(t, got.DeletedAt)
+	_, err = store.RestorePerson(context.Background(), 7)
+	assert.NoError(t, err)
+	_, err = store.RestorePerson(context.Background(), 6)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPersonHistory(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := &PostgresStorage{db: sqlxDB}
+
+	cols := []string{"id", "person_id", "action", "changes", "changed_at"}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM person_history WHERE person_id=$1 ORDER BY id")).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(cols).
+			AddRow(1, 7, "create", []byte(`{"name":{"old":null,"new":"A"}}`), time.Now()).
+			AddRow(2, 7, "update", []byte(`{"nationality":{"old":"RU","new":"KZ"}}`), time.Now()))
+	items, err := store.GetPersonHistory(context.Background(), 7)
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, "KZ", items[1].Changes["nationality"].New)
+
+	// нет истории и нет записи — не найдено
+	mock.ExpectQuery("FROM person_history").
+		WithArgs(8).
+		WillReturnRows(sqlmock.NewRows(cols))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS(SELECT 1 FROM persons WHERE id=$1)")).
+		WithArgs(8).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	_, err = store.GetPersonHistory(context.Background(), 8)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := &PostgresStorage{db: sqlxDB}
+
+	before := time.Now().Add(-time.Hour)
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM persons WHERE deleted_at < $1")).
+		WithArgs(before).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	n, err := store.PurgeDeleted(context.Background(), before)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFindPersonsByNames(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	store := &PostgresStorage{db: sqlx.NewDb(db, "postgres")}
+
+	mock.ExpectQuery(regexp.QuoteMeta("AND (lower(name), lower(surname), lower(coalesce(patronymic, ''))) IN (")).
+		WithArgs(pq.Array([]string{"Ivan", "Anna"}), pq.Array([]string{"Ivanov", "Petrova"}), pq.Array([]string{"Petrovich", ""})).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname"}).AddRow(7, "IVAN", "ivanov"))
+	got, err := store.FindPersonsByNames(context.Background(), []storage.FullName{
+		{Name: "Ivan", Surname: "Ivanov", Patronymic: "Petrovich"},
+		{Name: "Anna", Surname: "Petrova"},
+	})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, int64(7), got[0].ID)
+
+	// пустой список — без запроса
+	got, err = store.FindPersonsByNames(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClaimIdempotencyKey(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	store := &PostgresStorage{db: sqlx.NewDb(db, "postgres")}
+
+	cols := []string{"key", "fingerprint", "status", "header", "body", "created_at", "claimed_at", "claim"}
+	now := time.Now()
+	staleBefore := now.Add(-time.Minute)
+	insertQ := regexp.QuoteMeta("INSERT INTO idempotency_keys (key, fingerprint) VALUES ($1, $2) " +
+		"ON CONFLICT (key) DO UPDATE SET claimed_at = CURRENT_TIMESTAMP, claim = idempotency_keys.claim + 1 " +
+		"WHERE idempotency_keys.status = 0 AND idempotency_keys.fingerprint = EXCLUDED.fingerprint " +
+		"AND idempotency_keys.claimed_at < $3")
+	selectQ := regexp.QuoteMeta("SELECT key, fingerprint, status, header, body, created_at, claimed_at, claim FROM idempotency_keys WHERE key=$1")
+
+	// новый ключ или ключ без ответа с истёкшей арендой
+	mock.ExpectQuery(insertQ).WithArgs("k1", "fp", staleBefore).
+		WillReturnRows(sqlmock.NewRows(cols).AddRow("k1", "fp", 0, []byte(`{}`), nil, now, now, 2))
+	k, claimed, err := store.ClaimIdempotencyKey(context.Background(), "k1", "fp", staleBefore)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	assert.Equal(t, 0, k.Status)
+	assert.Equal(t, int64(2), k.Claim)
+
+	// ключ уже занят — возвращается сохранённый ответ
+	mock.ExpectQuery(insertQ).WithArgs("k1", "fp", staleBefore).WillReturnRows(sqlmock.NewRows(cols))
+	mock.ExpectQuery(selectQ).WithArgs("k1").
+		WillReturnRows(sqlmock.NewRows(cols).AddRow("k1", "fp", 201, []byte(`{"ETag":"\"1\""}`), []byte(`{"id":1}`), now, now, 1))
+	k, claimed, err = store.ClaimIdempotencyKey(context.Background(), "k1", "fp", staleBefore)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Equal(t, 201, k.Status)
+	assert.Equal(t, storage.Header{"ETag": `"1"`}, k.Header)
+	assert.Equal(t, []byte(`{"id":1}`), k.Body)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCompleteIdempotencyKey(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	store := &PostgresStorage{db: sqlx.NewDb(db, "postgres")}
+
+	q := regexp.QuoteMeta("UPDATE idempotency_keys SET status=$2, header=$3, body=$4 WHERE key=$1 AND claim=$5")
+	mock.ExpectExec(q).WithArgs("k1", 201, []byte(`{"Location":"/persons/1"}`), []byte(`{}`), int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// ключ заняли заново
+	mock.ExpectExec(q).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM idempotency_keys WHERE key=$1 AND claim=$2")).
+		WithArgs("k1", int64(3)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	k := storage.IdempotencyKey{Key: "k1", Status: 201, Header: storage.Header{"Location": "/persons/1"}, Body: []byte(`{}`), Claim: 3}
+	require.NoError(t, store.CompleteIdempotencyKey(context.Background(), k))
+	assert.ErrorIs(t, store.CompleteIdempotencyKey(context.Background(), k), storage.ErrNotFound)
+	assert.NoError(t, store.DeleteIdempotencyKey(context.Background(), "k1", 3))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEnrichmentCache(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	store := &PostgresStorage{db: sqlx.NewDb(db, "postgres")}
+
+	expires := time.Now().Add(time.Hour)
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO enrichment_cache (key, result, expires_at) VALUES ($1, $2, $3) ON CONFLICT (key) DO UPDATE")).
+		WithArgs("agify::ivan", []byte(`{"value":30}`), expires).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT key, result, expires_at FROM enrichment_cache WHERE key=$1")).
+		WithArgs("agify::anna").
+		WillReturnRows(sqlmock.NewRows([]string{"key", "result", "expires_at"}))
+
+	err := store.PutEnrichmentCache(context.Background(), storage.EnrichmentCacheEntry{
+		Key: "agify::ivan", Result: []byte(`{"value":30}`), ExpiresAt: expires,
+	})
+	require.NoError(t, err)
+	_, err = store.GetEnrichmentCache(context.Background(), "agify::anna")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListEnrichmentRetries(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	store := &PostgresStorage{db: sqlx.NewDb(db, "postgres")}
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM persons WHERE enrichment_retry_at <= $1 AND deleted_at IS NULL ORDER BY enrichment_retry_at, id LIMIT $2")).
+		WithArgs(now, 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname", "enrichment", "enrichment_retry_at"}).
+			AddRow(3, "A", "B", []byte(`{"age":{"status":"pending","provider":"","attempts":1}}`), now.Add(-time.Minute)))
+
+	got, err := store.ListEnrichmentRetries(context.Background(), now, 100)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, int64(3), got[0].ID)
+	assert.Equal(t, storage.Enrichment{"age": {Status: "pending", Attempts: 1}}, got[0].Enrichment)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateEnrichment(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	store := &PostgresStorage{db: sqlx.NewDb(db, "postgres")}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM persons WHERE id=$1 AND deleted_at IS NULL FOR UPDATE")).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname", "version"}).AddRow(3, "A", "B", 2))
+	// без версии и истории
+	mock.ExpectExec(`UPDATE persons SET age = \$1, gender = \$2, nationality = \$3, enrichment = \$4, enrichment_retry_at = \$5 WHERE id = \$6$`).
+		WithArgs(40, nil, nil, []byte(`{"age":{"status":"complete","provider":"agify"}}`), nil, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	got, err := store.UpdateEnrichment(context.Background(), 3, func(e *storage.PersonEntity) {
+		age := 40
+		e.Age = &age
+		e.Enrichment = storage.Enrichment{"age": {Status: "complete", Provider: "agify"}}
+		e.Name = "ignored"
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "A", got.Name)
+	assert.Equal(t, int64(2), got.Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreatePersonsQueued(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	store := &PostgresStorage{db: sqlx.NewDb(db, "postgres")}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO persons").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "version"}).
+			AddRow(7, time.Now(), time.Now(), 1).
+			AddRow(8, time.Now(), time.Now(), 1))
+	mock.ExpectExec("INSERT INTO person_history").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO enrichment_jobs (person_id) SELECT unnest($1::bigint[])")).
+		WithArgs(pq.Array([]int64{7, 8})).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	got, err := store.CreatePersonsQueued(context.Background(), []storage.PersonEntity{
+		{Name: "A", Surname: "B"},
+		{Name: "C", Surname: "D"},
+	})
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, int64(8), got[1].ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClaimEnrichmentJobs(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	store := &PostgresStorage{db: sqlx.NewDb(db, "postgres")}
+
+	claim := regexp.QuoteMeta("WHERE status <> 'dead' AND run_at <= NOW() ORDER BY run_at, id LIMIT $2 FOR UPDATE SKIP LOCKED)")
+	now := time.Now()
+	mock.ExpectQuery(claim).
+		WithArgs(float64(300), 50).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "person_id", "status", "attempts", "run_at", "last_error", "created_at", "updated_at"}).
+			AddRow(6, 8, "running", 1, now.Add(5*time.Minute), nil, now, now).
+			AddRow(5, 7, "running", 2, now.Add(5*time.Minute), "agify: status 503", now, now))
+	mock.ExpectQuery(claim).
+		WithArgs(float64(300), 50).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "person_id", "status", "attempts", "run_at", "last_error", "created_at", "updated_at"}))
+
+	got, err := store.ClaimEnrichmentJobs(context.Background(), 50, 5*time.Minute)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, int64(5), got[0].ID)
+	assert.Equal(t, int64(7), got[0].PersonID)
+	assert.Equal(t, 2, got[0].Attempts)
+	require.NotNil(t, got[0].LastError)
+	assert.Equal(t, "agify: status 503", *got[0].LastError)
+	assert.Nil(t, got[1].LastError)
+
+	got, err = store.ClaimEnrichmentJobs(context.Background(), 50, 5*time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFinishEnrichmentJob(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	store := &PostgresStorage{db: sqlx.NewDb(db, "postgres")}
+	ctx := context.Background()
+
+	// задание меняется, только пока его не взял другой обработчик
+	job := storage.EnrichmentJob{ID: 5, Attempts: 2}
+	runAt := time.Now()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM enrichment_jobs WHERE id=$1 AND attempts=$2")).
+		WithArgs(int64(5), 2).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("SET status = 'queued', run_at = $3, last_error = $4, updated_at = NOW() WHERE id = $1 AND attempts = $2")).
+		WithArgs(int64(5), 2, runAt, "agify: status 503").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("SET status = 'dead', last_error = $3, updated_at = NOW() WHERE id = $1 AND attempts = $2")).
+		WithArgs(int64(5), 2, "gave up").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, store.CompleteEnrichmentJob(ctx, job))
+	require.NoError(t, store.RetryEnrichmentJob(ctx, job, runAt, "agify: status 503"))
+	require.NoError(t, store.BuryEnrichmentJob(ctx, job, "gave up"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEnrichmentQueueStats(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	store := &PostgresStorage{db: sqlx.NewDb(db, "postgres")}
+
+	oldest := time.Now().Add(-time.Minute)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM enrichment_jobs GROUP BY status")).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "count", "oldest"}).
+			AddRow("queued", 3, oldest).
+			AddRow("dead", 1, oldest.Add(-time.Hour)))
+
+	got, err := store.EnrichmentQueueStats(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, storage.EnrichmentQueueStats{Queued: 3, Dead: 1, OldestQueued: &oldest}, got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListPersons_IncludeDeleted(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := &PostgresStorage{db: sqlxDB}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM persons") + "$").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM persons ORDER BY id LIMIT $1 OFFSET $2")).
+		WithArgs(11, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	_, err := store.ListPersons(context.Background(), storage.ListParams{Limit: 10, IncludeDeleted: true})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestGetPersonByID_Success(t *testing.T) {
@@ -114,7 +609,7 @@ func TestGetPersonByID_Success(t *testing.T) {
 	store := &PostgresStorage{db: sqlxDB}
 
 	cols := []string{"id", "name", "surname", "patronymic", "age", "gender", "nationality", "created_at", "updated_at"}
-	mock.ExpectQuery("SELECT id, name, surname, patronymic, age, gender, nationality, created_at, updated_at").
+	mock.ExpectQuery("SELECT id, name, surname, patronymic, age, gender, nationality, enrichment, enrichment_retry_at, created_at, updated_at").
 		WithArgs(1).
 		WillReturnRows(sqlmock.NewRows(cols).AddRow(1, "N", "S", nil, nil, nil, nil, time.Now(), time.Now()))
 
@@ -146,7 +641,7 @@ func TestListPersons_BaseAndFilter(t *testing.T) {
 		WithArgs().
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
 	mock.ExpectQuery("SELECT id, name, surname").
-		WithArgs(5, 0).
+		WithArgs(6, 0).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname", "patronymic", "age", "gender", "nationality", "created_at", "updated_at"}).
 			AddRow(1, "A", "B", nil, nil, nil, nil, time.Now(), time.Now()).
 			AddRow(2, "C", "D", nil, nil, nil, nil, time.Now(), time.Now()))
@@ -156,11 +651,11 @@ func TestListPersons_BaseAndFilter(t *testing.T) {
 		Offset:       0,
 		Limit:        5,
 	}
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM persons WHERE name ILIKE $1")).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM persons WHERE deleted_at IS NULL AND name ILIKE $1")).
 		WithArgs("%A%").
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, surname, patronymic, age, gender, nationality, created_at, updated_at FROM persons WHERE name ILIKE $1 ORDER BY id LIMIT $2 OFFSET $3")).
-		WithArgs("%A%", 5, 0).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, surname, patronymic, age, gender, nationality, enrichment, enrichment_retry_at, created_at, updated_at, deleted_at, version FROM persons WHERE deleted_at IS NULL AND name ILIKE $1 ORDER BY id LIMIT $2 OFFSET $3")).
+		WithArgs("%A%", 6, 0).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname", "patronymic", "age", "gender", "nationality", "created_at", "updated_at"}).
 			AddRow(1, "A", "B", nil, nil, nil, nil, time.Now(), time.Now()))
 
@@ -174,4 +669,237 @@ func TestListPersons_BaseAndFilter(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestListPersons_GenderAndNationality(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := &PostgresStorage{db: sqlxDB}
+
+	genders := pq.Array([]string{"male"})
+	nationalities := pq.Array([]string{"RU", "KZ"})
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM persons WHERE deleted_at IS NULL AND gender = ANY($1) AND nationality = ANY($2) AND age >= $3")).
+		WithArgs(genders, nationalities, 18).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM persons WHERE deleted_at IS NULL AND gender = ANY($1) AND nationality = ANY($2) AND age >= $3 ORDER BY id LIMIT $4 OFFSET $5")).
+		WithArgs(genders, nationalities, 18, 11, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname", "patronymic", "age", "gender", "nationality", "created_at", "updated_at"}))
+
+	minAge := 18
+	_, err := store.ListPersons(context.Background(), storage.ListParams{
+		Genders:       []string{"male"},
+		Nationalities: []string{"RU", "KZ"},
+		MinAge:        &minAge,
+		Limit:         10,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListPersons_KeysetWithoutCount(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := &PostgresStorage{db: sqlxDB}
+
+	cols := []string{"id", "name", "surname", "patronymic", "age", "gender", "nationality", "created_at", "updated_at"}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM persons WHERE deleted_at IS NULL AND name ILIKE $1 AND id > $2 ORDER BY id LIMIT $3")).
+		WithArgs("%A%", "7", 3).
+		WillReturnRows(sqlmock.NewRows(cols).
+			AddRow(8, "A", "B", nil, nil, nil, nil, time.Now(), time.Now()).
+			AddRow(9, "A", "C", nil, nil, nil, nil, time.Now(), time.Now()).
+			AddRow(10, "A", "D", nil, nil, nil, nil, time.Now(), time.Now()))
+
+	res, err := store.ListPersons(context.Background(), storage.ListParams{
+		NameContains: ptrString("A"),
+		After:        &storage.Cursor{Values: []*string{ptrString("7")}},
+		SkipCount:    true,
+		Limit:        2,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, res.Items, 2)
+	assert.True(t, res.HasMore)
+	assert.Equal(t, int64(9), res.Items[1].ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListPersons_SortWithKeyset(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := &PostgresStorage{db: sqlxDB}
+
+	cols := []string{"id", "name", "surname", "patronymic", "age", "gender", "nationality", "created_at", "updated_at"}
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM persons WHERE deleted_at IS NULL AND ((age < $1 OR age IS NULL) OR age = $1 AND surname COLLATE "C" > $2 OR age = $1 AND surname COLLATE "C" = $2 AND id > $3) `+
+		`ORDER BY age DESC NULLS LAST, surname COLLATE "C", id LIMIT $4`)).
+		WithArgs("30", "Ivanov", "4", 11).
+		WillReturnRows(sqlmock.NewRows(cols))
+
+	_, err := store.ListPersons(context.Background(), storage.ListParams{
+		Sort: []storage.SortField{
+			{Column: "age", Desc: true},
+			{Column: "surname"},
+		},
+		After:     &storage.Cursor{Values: []*string{ptrString("30"), ptrString("Ivanov"), ptrString("4")}},
+		SkipCount: true,
+		Limit:     10,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListPersons_Search(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	store := &PostgresStorage{db: sqlxDB}
+
+	score := "GREATEST(word_similarity($1, search_text), ts_rank(search_tsv, plainto_tsquery('simple', $1)))::float8"
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM persons WHERE deleted_at IS NULL AND ($1 <% search_text OR search_tsv @@ plainto_tsquery('simple', $1))")).
+		WithArgs("ivanov").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(score+" AS score")+`\s+`+
+		regexp.QuoteMeta("FROM persons WHERE deleted_at IS NULL AND ($1 <% search_text OR search_tsv @@ plainto_tsquery('simple', $1)) "+
+			"AND ("+score+" < $2 OR "+score+" = $2 AND id > $3) ORDER BY score DESC, id LIMIT $4")).
+		WithArgs("ivanov", "0.5", "3", 6).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname", "patronymic", "age", "gender", "nationality", "created_at", "updated_at", "score"}).
+			AddRow(4, "Иван", "Иванов", nil, nil, nil, nil, time.Now(), time.Now(), 0.4))
+
+	res, err := store.ListPersons(context.Background(), storage.ListParams{
+		Search: ptrString(" Иванов "),
+		Sort:   []storage.SortField{{Column: storage.ScoreColumn, Desc: true, NullsFirst: true}},
+		After:  &storage.Cursor{Values: []*string{ptrString("0.5"), ptrString("3")}},
+		Limit:  5,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0.4, *res.Items[0].Score)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExportPersons(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	store := &PostgresStorage{db: sqlx.NewDb(db, "postgres")}
+
+	cols := []string{"id", "name", "surname", "patronymic", "age", "gender", "nationality", "created_at", "updated_at", "deleted_at", "version"}
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(
+		`DECLARE person_export NO SCROLL CURSOR FOR SELECT ` + personColumns + ` FROM persons WHERE deleted_at IS NULL AND gender = ANY($1) ORDER BY id`)).
+		WithArgs(pq.Array([]string{"male"})).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`FETCH FORWARD 500 FROM person_export`)).
+		WillReturnRows(sqlmock.NewRows(cols).
+			AddRow(1, "Ivan", "Ivanov", nil, 30, "male", "RU", time.Now(), time.Now(), nil, 1).
+			AddRow(2, "Oleg", "Smirnov", nil, nil, "male", nil, time.Now(), time.Now(), nil, 1))
+	mock.ExpectCommit()
+
+	var got []string
+	err := store.ExportPersons(context.Background(), storage.ListParams{Genders: []string{"male"}}, func(p storage.PersonEntity) error {
+		got = append(got, p.Name)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Ivan", "Oleg"}, got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestKeysetCondition_NullCursorValue(t *testing.T) {
+	sort := storage.NormalizeSort([]storage.SortField{{Column: "age", NullsFirst: true}})
+	cond, args := keysetCondition(sort, []*string{nil, ptrString("9")}, nil, "")
+	assert.Equal(t, "(age IS NOT NULL OR age IS NULL AND id > $1)", cond)
+	assert.Equal(t, []interface{}{"9"}, args)
+
+	sort = storage.NormalizeSort([]storage.SortField{{Column: "age"}})
+	cond, _ = keysetCondition(sort, []*string{nil, ptrString("9")}, nil, "")
+	assert.Equal(t, "age IS NULL AND id > $1", cond)
+}
+
 func ptrString(s string) *string { return &s }
+func ptrInt(n int) *int          { return &n }
+
+func TestTranslateError(t *testing.T) {
+	fail := errors.New("fail")
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"no rows", sql.ErrNoRows, storage.ErrNotFound},
+		{"unique", &pq.Error{Code: "23505"}, storage.ErrConflict},
+		{"not null", &pq.Error{Code: "23502"}, storage.ErrInvalid},
+		{"value too long", &pq.Error{Code: "22001"}, storage.ErrInvalid},
+		{"deadlock", &pq.Error{Code: "40P01"}, storage.ErrConflict},
+		{"statement timeout", &pq.Error{Code: "57014"}, storage.ErrTimeout},
+		{"connection failure", &pq.Error{Code: "08006"}, storage.ErrUnavailable},
+		{"shutdown", &pq.Error{Code: "57P01"}, storage.ErrUnavailable},
+		{"bad conn", driver.ErrBadConn, storage.ErrUnavailable},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), storage.ErrTimeout},
+		{"dial", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, storage.ErrUnavailable},
+		{"unknown", fail, fail},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.ErrorIs(t, translateError(tc.err), tc.want)
+		})
+	}
+	assert.Nil(t, translateError(nil))
+	// синтаксические ошибки в SQL — ошибка программы, а не данных
+	err := &pq.Error{Code: "42601"}
+	assert.Equal(t, err, translateError(err))
+}
+
+func TestMigrations_Embedded(t *testing.T) {
+	db, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	provider, err := newMigrationProvider(db)
+	require.NoError(t, err)
+	var files []string
+	for _, src := range provider.ListSources() {
+		files = append(files, src.Path)
+	}
+	assert.Equal(t, []string{
+		"0001_init.sql", "0002_search.sql", "0003_soft_delete.sql", "0004_person_history.sql", "0005_version.sql",
+		"0006_idempotency_keys.sql", "0007_enrichment.sql", "0008_enrichment_cache.sql",
+		"0009_enrichment_retry.sql",
+		"0010_enrichment_jobs.sql",
+		"0011_idempotency_lease.sql",
+		"0012_person_full_name_idx.sql",
+		"0013_idempotency_claim.sql",
+	}, files)
+}
+
+func TestMigrate_UnknownCommand(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	store := &PostgresStorage{db: sqlx.NewDb(db, "postgres")}
+
+	_, err = store.Migrate(context.Background(), "sideways")
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestStorageContract прогоняет общий набор проверок на настоящей базе.
+// Миграции применяются автоматически; таблицы очищаются перед каждым подтестом.
+func TestStorageContract(t *testing.T) {
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		// в CI база есть всегда: пропуск означал бы, что проверки молча не выполняются
+		if os.Getenv("CI") != "" {
+			t.Fatal("TEST_DB_DSN is not set")
+		}
+		t.Skip("TEST_DB_DSN is not set")
+	}
+	store, err := NewPostgresStorage(dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	_, err = store.Migrate(context.Background(), MigrateUp)
+	require.NoError(t, err)
+
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		_, err := store.db.Exec(`TRUNCATE persons, person_history, idempotency_keys, enrichment_cache, enrichment_jobs RESTART IDENTITY`)
+		require.NoError(t, err)
+		return store
+	})
+}
@@ -0,0 +1,21 @@
+package storage
+
+import "strings"
+
+// ScoreColumn — псевдоколонка релевантности, доступная для сортировки только при поиске.
+const ScoreColumn = "score"
+
+// translit повторяет SQL-функцию person_translit из миграции 0002_search.sql:
+// строки для поиска хранятся в латинице, чтобы «Иван» находился по «ivan».
+var translit = strings.NewReplacer(
+	"а", "a", "б", "b", "в", "v", "г", "g", "д", "d", "е", "e", "ё", "e",
+	"ж", "zh", "з", "z", "и", "i", "й", "y", "к", "k", "л", "l", "м", "m",
+	"н", "n", "о", "o", "п", "p", "р", "r", "с", "s", "т", "t", "у", "u",
+	"ф", "f", "х", "kh", "ц", "ts", "ч", "ch", "ш", "sh", "щ", "shch",
+	"ъ", "", "ы", "y", "ь", "", "э", "e", "ю", "yu", "я", "ya",
+)
+
+// NormalizeSearch приводит строку к виду колонки search_text: нижний регистр и латиница.
+func NormalizeSearch(s string) string {
+	return translit.Replace(strings.ToLower(strings.TrimSpace(s)))
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"strconv"
+	"time"
+)
+
+// SortField — одно поле сортировки списка.
+type SortField struct {
+	Column     string
+	Desc       bool
+	NullsFirst bool
+}
+
+// sortableColumns перечисляет колонки PersonEntity, по которым разрешена сортировка.
+var sortableColumns = map[string]struct{}{
+	"id":          {},
+	"name":        {},
+	"surname":     {},
+	"patronymic":  {},
+	"age":         {},
+	"gender":      {},
+	"nationality": {},
+	"created_at":  {},
+	"updated_at":  {},
+}
+
+// IsSortable сообщает, можно ли сортировать по колонке.
+func IsSortable(column string) bool {
+	_, ok := sortableColumns[column]
+	return ok
+}
+
+// NormalizeSort добавляет id в конец, чтобы порядок был полным и подходил для курсора.
+func NormalizeSort(sort []SortField) []SortField {
+	out := make([]SortField, 0, len(sort)+1)
+	for _, f := range sort {
+		out = append(out, f)
+		if f.Column == "id" {
+			return out
+		}
+	}
+	return append(out, SortField{Column: "id"})
+}
+
+// SortValue возвращает значение колонки в текстовом виде для курсора; nil — NULL.
+func SortValue(e PersonEntity, column string) *string {
+	var v string
+	switch column {
+	case "id":
+		v = strconv.FormatInt(e.ID, 10)
+	case "name":
+		v = e.Name
+	case "surname":
+		v = e.Surname
+	case "patronymic":
+		return e.Patronymic
+	case "age":
+		if e.Age == nil {
+			return nil
+		}
+		v = strconv.Itoa(*e.Age)
+	case "gender":
+		return e.Gender
+	case "nationality":
+		return e.Nationality
+	case "created_at":
+		v = e.CreatedAt.Format(time.RFC3339Nano)
+	case "updated_at":
+		v = e.UpdatedAt.Format(time.RFC3339Nano)
+	case ScoreColumn:
+		if e.Score == nil {
+			return nil
+		}
+		v = strconv.FormatFloat(*e.Score, 'g', -1, 64)
+	default:
+		return nil
+	}
+	return &v
+}
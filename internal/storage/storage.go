@@ -15,26 +15,128 @@ type PersonEntity struct {
 	Nationality *string   `db:"nationality"`
 	CreatedAt   time.Time `db:"created_at"`
 	UpdatedAt   time.Time `db:"updated_at"`
+	// DeletedAt != nil — запись удалена и видна только с IncludeDeleted.
+	DeletedAt *time.Time `db:"deleted_at"`
+	// Version растёт с каждым изменением; используется для оптимистичной блокировки.
+	Version int64 `db:"version"`
+	// Score заполняется только при поиске по Search.
+	Score *float64 `db:"score"`
+	// Enrichment не попадает в историю изменений.
+	Enrichment Enrichment `db:"enrichment"`
+	// EnrichmentRetryAt — Enrichment.NextRetry(), отдельной колонкой для поиска
+	// записей, которые пора дообогатить.
+	EnrichmentRetryAt *time.Time `db:"enrichment_retry_at"`
 }
 
 type ListParams struct {
 	NameContains    *string
 	SurnameContains *string
+	Genders         []string
+	Nationalities   []string
 	MinAge          *int
 	MaxAge          *int
-	Offset          int
-	Limit           int
+	// Search — нечёткий поиск по имени, фамилии и отчеству с ранжированием.
+	Search *string
+	// Sort задаёт порядок; пустой — по id.
+	Sort   []SortField
+	Offset int
+	Limit  int
+	// After включает keyset-пагинацию: Offset игнорируется.
+	After          *Cursor
+	SkipCount      bool
+	IncludeDeleted bool
+}
+
+// Cursor — позиция последней отданной записи: значения полей NormalizeSort(Sort) по порядку.
+type Cursor struct {
+	Values []*string
+}
+
+// FullName — ФИО для поиска совпадений; пустое Patronymic совпадает с отсутствующим отчеством.
+type FullName struct {
+	Name       string
+	Surname    string
+	Patronymic string
 }
 
 type PagedResult struct {
 	Items      []PersonEntity
 	TotalCount int64
+	HasMore    bool
 }
 
 type Storage interface {
 	CreatePerson(ctx context.Context, p PersonEntity) (PersonEntity, error)
+	// CreatePersons вставляет записи одной транзакцией: либо все, либо ни одной.
+	// Результат идёт в том же порядке, что и ps.
+	CreatePersons(ctx context.Context, ps []PersonEntity) ([]PersonEntity, error)
+	// UpdatePerson при p.Version != 0 меняет запись только с этой версией,
+	// иначе возвращает ErrVersionConflict.
 	UpdatePerson(ctx context.Context, id int64, p PersonEntity) (PersonEntity, error)
-	DeletePerson(ctx context.Context, id int64) error
+	// DeletePerson при version != 0 удаляет запись только с этой версией.
+	DeletePerson(ctx context.Context, id int64, version int64) error
+	// RestorePerson снимает пометку удаления. Если атрибуты записи ждут
+	// очереди обогащения (Enrichment.Queued), запись снова ставится в очередь:
+	// задание, выполненное, пока она была удалена, ничего не сделало.
+	RestorePerson(ctx context.Context, id int64) (PersonEntity, error)
+	// PurgeDeleted безвозвратно удаляет записи, помеченные удалёнными раньше before.
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
 	GetPersonByID(ctx context.Context, id int64) (PersonEntity, error)
+	GetPersonHistory(ctx context.Context, id int64) ([]HistoryEntity, error)
 	ListPersons(ctx context.Context, params ListParams) (PagedResult, error)
+	// FindPersonsByNames возвращает неудалённые записи, ФИО которых без учёта
+	// регистра совпадает с одним из names, по возрастанию id.
+	FindPersonsByNames(ctx context.Context, names []FullName) ([]PersonEntity, error)
+	// ExportPersons передаёт в fn по одной все записи, подходящие под фильтры
+	// params, в порядке Sort, не загружая их в память целиком. Offset, Limit,
+	// After и SkipCount не используются. Ошибка fn прерывает обход.
+	ExportPersons(ctx context.Context, params ListParams, fn func(PersonEntity) error) error
+
+	// ClaimIdempotencyKey сохраняет новый ключ без ответа и возвращает его с
+	// true; если ключ уже есть — возвращает сохранённую запись и false.
+	// Ключ без ответа с тем же fingerprint, занятый раньше staleBefore,
+	// занимается заново и тоже возвращается с true.
+	ClaimIdempotencyKey(ctx context.Context, key, fingerprint string, staleBefore time.Time) (IdempotencyKey, bool, error)
+	// CompleteIdempotencyKey сохраняет ответ для ключа, занятого ClaimIdempotencyKey
+	// с номером k.Claim. Если ключа нет или его заняли заново — ErrNotFound.
+	CompleteIdempotencyKey(ctx context.Context, k IdempotencyKey) error
+	// DeleteIdempotencyKey освобождает ключ с номером захвата claim, чтобы запрос
+	// можно было повторить; ключ, занятый заново, не трогает.
+	DeleteIdempotencyKey(ctx context.Context, key string, claim int64) error
+	// PurgeIdempotencyKeys удаляет ключи, созданные раньше before.
+	PurgeIdempotencyKeys(ctx context.Context, before time.Time) (int64, error)
+
+	// GetEnrichmentCache возвращает запись кеша обогащения, в том числе
+	// просроченную, или ErrNotFound.
+	GetEnrichmentCache(ctx context.Context, key string) (EnrichmentCacheEntry, error)
+	// PutEnrichmentCache добавляет или заменяет запись кеша обогащения.
+	PutEnrichmentCache(ctx context.Context, e EnrichmentCacheEntry) error
+	// UpdateEnrichment сохраняет результаты обогащения неудалённой записи: fn
+	// получает её текущее состояние под блокировкой и меняет Age, Gender,
+	// Nationality, Enrichment и EnrichmentRetryAt; прочие изменения не
+	// сохраняются. Это работа сервиса, а не пользователя: версия, UpdatedAt и
+	// история не меняются, поэтому ETag клиента остаётся верным.
+	UpdateEnrichment(ctx context.Context, id int64, fn func(*PersonEntity)) (PersonEntity, error)
+	// ListEnrichmentRetries возвращает до limit неудалённых записей с
+	// EnrichmentRetryAt не позже before, начиная с самых давних.
+	ListEnrichmentRetries(ctx context.Context, before time.Time, limit int) ([]PersonEntity, error)
+
+	// CreatePersonsQueued — CreatePersons, который в той же транзакции ставит
+	// каждую запись в очередь обогащения.
+	CreatePersonsQueued(ctx context.Context, ps []PersonEntity) ([]PersonEntity, error)
+	// ClaimEnrichmentJobs берёт в работу до limit самых ранних заданий, чей
+	// RunAt наступил: queued или running с истёкшей арендой. Задания получают
+	// статус running, RunAt = now + lease и Attempts + 1; задания, которые уже
+	// берёт другой обработчик, пропускаются. Результат упорядочен по ID; нет
+	// заданий — пустой срез.
+	ClaimEnrichmentJobs(ctx context.Context, limit int, lease time.Duration) ([]EnrichmentJob, error)
+	// CompleteEnrichmentJob удаляет выполненное задание. Complete, Retry и Bury
+	// меняют задание, только пока его Attempts равен job.Attempts: задание,
+	// которое по истечении аренды взял другой обработчик, они не трогают.
+	CompleteEnrichmentJob(ctx context.Context, job EnrichmentJob) error
+	// RetryEnrichmentJob возвращает задание в очередь до runAt.
+	RetryEnrichmentJob(ctx context.Context, job EnrichmentJob, runAt time.Time, lastErr string) error
+	// BuryEnrichmentJob переводит задание в JobDead: больше оно не выполняется.
+	BuryEnrichmentJob(ctx context.Context, job EnrichmentJob, lastErr string) error
+	EnrichmentQueueStats(ctx context.Context) (EnrichmentQueueStats, error)
 }
@@ -0,0 +1,987 @@
+// Package storagetest — общий набор поведенческих тестов для реализаций storage.Storage.
+// Реализация подключает его из своего _test.go:
+//
+//	storagetest.Run(t, func(t *testing.T) storage.Storage { return newEmptyStorage(t) })
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"person-api/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory возвращает пустое хранилище; вызывается для каждого подтеста.
+type Factory func(t *testing.T) storage.Storage
+
+// Run прогоняет все проверки контракта против хранилища из factory.
+func Run(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storage.Storage)
+	}{
+		{"CreateAndGet", testCreateAndGet},
+		{"CreateBatch", testCreateBatch},
+		{"NotFound", testNotFound},
+		{"Update", testUpdate},
+		{"UpdateVersionConflict", testUpdateVersionConflict},
+		{"DeleteAndRestore", testDeleteAndRestore},
+		{"PurgeDeleted", testPurgeDeleted},
+		{"History", testHistory},
+		{"ListFilters", testListFilters},
+		{"ListSort", testListSort},
+		{"ListOffsetPagination", testListOffsetPagination},
+		{"ListKeysetPagination", testListKeysetPagination},
+		{"ListCollation", testListCollation},
+		{"ListSearch", testListSearch},
+		{"Export", testExport},
+		{"FindByNames", testFindByNames},
+		{"IdempotencyKeys", testIdempotencyKeys},
+		{"EnrichmentCache", testEnrichmentCache},
+		{"EnrichmentRetries", testEnrichmentRetries},
+		{"UpdateEnrichment", testUpdateEnrichment},
+		{"EnrichmentJobs", testEnrichmentJobs},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, factory(t))
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+// fixtures — набор записей для проверок списка. Порядок строк побайтный
+// (см. testListCollation); здесь имена с заглавной буквы и латиницей.
+func fixtures() []storage.PersonEntity {
+	return []storage.PersonEntity{
+		{Name: "Ivan", Surname: "Ivanov", Patronymic: ptr("Petrovich"), Age: ptr(30), Gender: ptr("male"), Nationality: ptr("RU")},
+		{Name: "Anna", Surname: "Petrova", Age: ptr(25), Gender: ptr("female"), Nationality: ptr("UA")},
+		{Name: "Ivanna", Surname: "Sidorova", Age: ptr(41), Gender: ptr("female"), Nationality: ptr("RU")},
+		{Name: "Oleg", Surname: "Smirnov", Gender: ptr("male")},
+		{Name: "Boris", Surname: "Ivanenko", Age: ptr(30), Nationality: ptr("UA")},
+	}
+}
+
+func seed(t *testing.T, s storage.Storage, persons ...storage.PersonEntity) []storage.PersonEntity {
+	t.Helper()
+	out := make([]storage.PersonEntity, len(persons))
+	for i, p := range persons {
+		created, err := s.CreatePerson(context.Background(), p)
+		require.NoError(t, err)
+		out[i] = created
+	}
+	return out
+}
+
+func list(t *testing.T, s storage.Storage, params storage.ListParams) storage.PagedResult {
+	t.Helper()
+	if params.Limit == 0 {
+		params.Limit = 100
+	}
+	res, err := s.ListPersons(context.Background(), params)
+	require.NoError(t, err)
+	return res
+}
+
+func names(items []storage.PersonEntity) []string {
+	out := make([]string, len(items))
+	for i, p := range items {
+		out[i] = p.Name
+	}
+	return out
+}
+
+// assertSamePerson сравнивает данные записи; время сравнивается как момент, без учёта зоны.
+func assertSamePerson(t *testing.T, want, got storage.PersonEntity) {
+	t.Helper()
+	assert.Equal(t, want.ID, got.ID)
+	assert.Equal(t, want.Name, got.Name)
+	assert.Equal(t, want.Surname, got.Surname)
+	assert.Equal(t, want.Patronymic, got.Patronymic)
+	assert.Equal(t, want.Age, got.Age)
+	assert.Equal(t, want.Gender, got.Gender)
+	assert.Equal(t, want.Nationality, got.Nationality)
+	assert.Equal(t, want.Version, got.Version)
+	// пустое обогащение Postgres возвращает как {}
+	if len(want.Enrichment) > 0 || len(got.Enrichment) > 0 {
+		assert.Equal(t, want.Enrichment, got.Enrichment)
+	}
+	assert.True(t, want.CreatedAt.Equal(got.CreatedAt), "created_at: want %v, got %v", want.CreatedAt, got.CreatedAt)
+	assert.True(t, want.UpdatedAt.Equal(got.UpdatedAt), "updated_at: want %v, got %v", want.UpdatedAt, got.UpdatedAt)
+}
+
+func testCreateAndGet(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	full := storage.PersonEntity{
+		Name: "Ivan", Surname: "Ivanov", Patronymic: ptr("Petrovich"),
+		Age: ptr(30), Gender: ptr("male"), Nationality: ptr("RU"),
+		Enrichment: storage.Enrichment{
+			"gender": {Provider: "genderize", Probability: ptr(0.99), Count: ptr(1200)},
+			"nationality": {Provider: "nationalize", Probability: ptr(0.6), Candidates: []storage.Candidate{
+				{Value: "RU", Probability: 0.6}, {Value: "UA", Probability: 0.3},
+			}},
+		},
+	}
+	created, err := s.CreatePerson(ctx, full)
+	require.NoError(t, err)
+	assert.NotZero(t, created.ID)
+	assert.Equal(t, int64(1), created.Version)
+	assert.Nil(t, created.DeletedAt)
+	assert.WithinDuration(t, time.Now(), created.CreatedAt, time.Minute)
+	assert.True(t, created.UpdatedAt.Equal(created.CreatedAt))
+
+	got, err := s.GetPersonByID(ctx, created.ID)
+	require.NoError(t, err)
+	full.ID, full.Version, full.CreatedAt, full.UpdatedAt = created.ID, 1, created.CreatedAt, created.UpdatedAt
+	assertSamePerson(t, full, got)
+
+	// необязательные поля остаются NULL
+	minimal, err := s.CreatePerson(ctx, storage.PersonEntity{Name: "Anna", Surname: "Petrova"})
+	require.NoError(t, err)
+	assert.NotEqual(t, created.ID, minimal.ID)
+	got, err = s.GetPersonByID(ctx, minimal.ID)
+	require.NoError(t, err)
+	assert.Nil(t, got.Patronymic)
+	assert.Nil(t, got.Age)
+	assert.Nil(t, got.Gender)
+	assert.Nil(t, got.Nationality)
+	assert.Empty(t, got.Enrichment)
+}
+
+func testCreateBatch(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	in := fixtures()
+	created, err := s.CreatePersons(ctx, in)
+	require.NoError(t, err)
+	require.Len(t, created, len(in))
+	// порядок результата совпадает с порядком входа
+	for i, p := range created {
+		assert.Equal(t, in[i].Name, p.Name)
+		assert.Equal(t, int64(1), p.Version)
+		got, err := s.GetPersonByID(ctx, p.ID)
+		require.NoError(t, err)
+		assertSamePerson(t, p, got)
+
+		h, err := s.GetPersonHistory(ctx, p.ID)
+		require.NoError(t, err)
+		require.Len(t, h, 1)
+		assert.Equal(t, storage.ActionCreate, h[0].Action)
+	}
+	assert.Equal(t, int64(len(in)), list(t, s, storage.ListParams{}).TotalCount)
+
+	created, err = s.CreatePersons(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, created)
+}
+
+func testNotFound(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	const missing = 999999
+
+	_, err := s.GetPersonByID(ctx, missing)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.UpdatePerson(ctx, missing, storage.PersonEntity{Name: "A", Surname: "B"})
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.ErrorIs(t, s.DeletePerson(ctx, missing, 0), storage.ErrNotFound)
+	assert.ErrorIs(t, s.DeletePerson(ctx, missing, 1), storage.ErrNotFound)
+	_, err = s.RestorePerson(ctx, missing)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.GetPersonHistory(ctx, missing)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	// восстановить можно только удалённую запись
+	p := seed(t, s, storage.PersonEntity{Name: "A", Surname: "B"})[0]
+	_, err = s.RestorePerson(ctx, p.ID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testUpdate(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	p := seed(t, s, storage.PersonEntity{
+		Name: "Ivan", Surname: "Ivanov", Patronymic: ptr("Petrovich"), Age: ptr(30),
+	})[0]
+
+	upd, err := s.UpdatePerson(ctx, p.ID, storage.PersonEntity{
+		Name: "Petr", Surname: "Ivanov", Age: ptr(31), Gender: ptr("male"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, p.ID, upd.ID)
+	assert.Equal(t, int64(2), upd.Version)
+	assert.True(t, upd.CreatedAt.Equal(p.CreatedAt), "created_at must not change")
+	assert.False(t, upd.UpdatedAt.Before(p.UpdatedAt), "updated_at must not go back")
+
+	got, err := s.GetPersonByID(ctx, p.ID)
+	require.NoError(t, err)
+	assertSamePerson(t, upd, got)
+	assert.Equal(t, "Petr", got.Name)
+	assert.Nil(t, got.Patronymic, "update replaces the whole record")
+	assert.Equal(t, ptr(31), got.Age)
+	assert.Equal(t, ptr("male"), got.Gender)
+}
+
+func testUpdateVersionConflict(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	p := seed(t, s, storage.PersonEntity{Name: "Ivan", Surname: "Ivanov"})[0]
+
+	p.Name = "Petr"
+	_, err := s.UpdatePerson(ctx, p.ID, p)
+	require.NoError(t, err)
+
+	// версия 1 уже устарела
+	p.Name = "Oleg"
+	_, err = s.UpdatePerson(ctx, p.ID, p)
+	assert.ErrorIs(t, err, storage.ErrVersionConflict)
+
+	got, err := s.GetPersonByID(ctx, p.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Petr", got.Name)
+	assert.Equal(t, int64(2), got.Version)
+
+	// Version = 0 обновляет без проверки
+	p.Version = 0
+	upd, err := s.UpdatePerson(ctx, p.ID, p)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), upd.Version)
+}
+
+func testDeleteAndRestore(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	ps := seed(t, s,
+		storage.PersonEntity{Name: "Ivan", Surname: "Ivanov"},
+		storage.PersonEntity{Name: "Anna", Surname: "Petrova"},
+	)
+	p := ps[0]
+
+	assert.ErrorIs(t, s.DeletePerson(ctx, p.ID, p.Version+1), storage.ErrVersionConflict)
+	require.NoError(t, s.DeletePerson(ctx, p.ID, p.Version))
+	assert.ErrorIs(t, s.DeletePerson(ctx, p.ID, 0), storage.ErrNotFound)
+
+	_, err := s.GetPersonByID(ctx, p.ID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.UpdatePerson(ctx, p.ID, storage.PersonEntity{Name: "A", Surname: "B"})
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	res := list(t, s, storage.ListParams{})
+	assert.Equal(t, []string{"Anna"}, names(res.Items))
+	assert.Equal(t, int64(1), res.TotalCount)
+
+	res = list(t, s, storage.ListParams{IncludeDeleted: true})
+	require.Len(t, res.Items, 2)
+	assert.Equal(t, int64(2), res.TotalCount)
+	assert.NotNil(t, res.Items[0].DeletedAt)
+	assert.Equal(t, int64(2), res.Items[0].Version)
+	assert.Nil(t, res.Items[1].DeletedAt)
+
+	restored, err := s.RestorePerson(ctx, p.ID)
+	require.NoError(t, err)
+	assert.Nil(t, restored.DeletedAt)
+	assert.Equal(t, int64(3), restored.Version)
+	assert.Equal(t, "Ivan", restored.Name)
+	assert.True(t, restored.CreatedAt.Equal(p.CreatedAt))
+
+	got, err := s.GetPersonByID(ctx, p.ID)
+	require.NoError(t, err)
+	assertSamePerson(t, restored, got)
+}
+
+func testPurgeDeleted(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	ps := seed(t, s,
+		storage.PersonEntity{Name: "Ivan", Surname: "Ivanov"},
+		storage.PersonEntity{Name: "Anna", Surname: "Petrova"},
+	)
+	require.NoError(t, s.DeletePerson(ctx, ps[0].ID, 0))
+
+	n, err := s.PurgeDeleted(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, n, "records deleted after the cutoff are kept")
+
+	n, err = s.PurgeDeleted(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	_, err = s.RestorePerson(ctx, ps[0].ID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	res := list(t, s, storage.ListParams{IncludeDeleted: true})
+	assert.Equal(t, []string{"Anna"}, names(res.Items))
+}
+
+func testHistory(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	p := seed(t, s, storage.PersonEntity{Name: "Ivan", Surname: "Ivanov", Age: ptr(30)})[0]
+
+	// без изменений запись истории не добавляется
+	_, err := s.UpdatePerson(ctx, p.ID, storage.PersonEntity{Name: "Ivan", Surname: "Ivanov", Age: ptr(30)})
+	require.NoError(t, err)
+	_, err = s.UpdatePerson(ctx, p.ID, storage.PersonEntity{Name: "Petr", Surname: "Ivanov"})
+	require.NoError(t, err)
+	require.NoError(t, s.DeletePerson(ctx, p.ID, 0))
+	_, err = s.RestorePerson(ctx, p.ID)
+	require.NoError(t, err)
+
+	h, err := s.GetPersonHistory(ctx, p.ID)
+	require.NoError(t, err)
+	require.Len(t, h, 4)
+	actions := make([]string, len(h))
+	for i, e := range h {
+		actions[i] = e.Action
+		assert.Equal(t, p.ID, e.PersonID)
+		assert.NotZero(t, e.ID)
+		assert.WithinDuration(t, time.Now(), e.ChangedAt, time.Minute)
+		if i > 0 {
+			assert.False(t, e.ChangedAt.Before(h[i-1].ChangedAt))
+		}
+	}
+	assert.Equal(t, []string{
+		storage.ActionCreate, storage.ActionUpdate, storage.ActionDelete, storage.ActionRestore,
+	}, actions)
+
+	// значения проходят через JSON, поэтому числа приходят как float64
+	assert.Equal(t, storage.Changes{
+		"name":    {Old: nil, New: "Ivan"},
+		"surname": {Old: nil, New: "Ivanov"},
+		"age":     {Old: nil, New: float64(30)},
+	}, h[0].Changes)
+	assert.Equal(t, storage.Changes{
+		"name": {Old: "Ivan", New: "Petr"},
+		"age":  {Old: float64(30), New: nil},
+	}, h[1].Changes)
+	assert.Contains(t, h[2].Changes, "deleted_at")
+	assert.Nil(t, h[2].Changes["deleted_at"].Old)
+	assert.Contains(t, h[3].Changes, "deleted_at")
+	assert.Nil(t, h[3].Changes["deleted_at"].New)
+
+	// история доступна и для удалённой записи
+	require.NoError(t, s.DeletePerson(ctx, p.ID, 0))
+	h, err = s.GetPersonHistory(ctx, p.ID)
+	require.NoError(t, err)
+	assert.Len(t, h, 5)
+}
+
+func testListFilters(t *testing.T, s storage.Storage) {
+	seed(t, s, fixtures()...)
+
+	tests := []struct {
+		name   string
+		params storage.ListParams
+		want   []string
+	}{
+		{"no filters", storage.ListParams{}, []string{"Ivan", "Anna", "Ivanna", "Oleg", "Boris"}},
+		{"name contains, case-insensitive", storage.ListParams{NameContains: ptr("IVAN")}, []string{"Ivan", "Ivanna"}},
+		{"surname contains", storage.ListParams{SurnameContains: ptr("ivan")}, []string{"Ivan", "Boris"}},
+		{"name and surname", storage.ListParams{NameContains: ptr("ivan"), SurnameContains: ptr("ova")}, []string{"Ivanna"}},
+		{"one gender", storage.ListParams{Genders: []string{"female"}}, []string{"Anna", "Ivanna"}},
+		{"several genders skip NULL", storage.ListParams{Genders: []string{"female", "male"}}, []string{"Ivan", "Anna", "Ivanna", "Oleg"}},
+		{"nationalities", storage.ListParams{Nationalities: []string{"UA"}}, []string{"Anna", "Boris"}},
+		{"min age skips NULL", storage.ListParams{MinAge: ptr(30)}, []string{"Ivan", "Ivanna", "Boris"}},
+		{"max age skips NULL", storage.ListParams{MaxAge: ptr(30)}, []string{"Ivan", "Anna", "Boris"}},
+		{"age range inclusive", storage.ListParams{MinAge: ptr(30), MaxAge: ptr(30)}, []string{"Ivan", "Boris"}},
+		{"gender and nationality", storage.ListParams{Genders: []string{"female"}, Nationalities: []string{"RU"}}, []string{"Ivanna"}},
+		{"all filters", storage.ListParams{
+			NameContains: ptr("i"), SurnameContains: ptr("ov"), Genders: []string{"male"},
+			Nationalities: []string{"RU"}, MinAge: ptr(18), MaxAge: ptr(40),
+		}, []string{"Ivan"}},
+		{"nothing matches", storage.ListParams{NameContains: ptr("zzz")}, []string{}},
+		{"empty range", storage.ListParams{MinAge: ptr(40), MaxAge: ptr(30)}, []string{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res := list(t, s, tc.params)
+			assert.Equal(t, tc.want, names(res.Items))
+			assert.Equal(t, int64(len(tc.want)), res.TotalCount)
+			assert.False(t, res.HasMore)
+		})
+	}
+}
+
+func testListSort(t *testing.T, s storage.Storage) {
+	seed(t, s, fixtures()...)
+
+	tests := []struct {
+		name string
+		sort []storage.SortField
+		want []string
+	}{
+		{"default by id", nil, []string{"Ivan", "Anna", "Ivanna", "Oleg", "Boris"}},
+		{"name asc", []storage.SortField{{Column: "name"}}, []string{"Anna", "Boris", "Ivan", "Ivanna", "Oleg"}},
+		{"name desc", []storage.SortField{{Column: "name", Desc: true, NullsFirst: true}}, []string{"Oleg", "Ivanna", "Ivan", "Boris", "Anna"}},
+		{"age asc nulls last, ties by id", []storage.SortField{{Column: "age"}}, []string{"Anna", "Ivan", "Boris", "Ivanna", "Oleg"}},
+		{"age asc nulls first", []storage.SortField{{Column: "age", NullsFirst: true}}, []string{"Oleg", "Anna", "Ivan", "Boris", "Ivanna"}},
+		{"age desc nulls first", []storage.SortField{{Column: "age", Desc: true, NullsFirst: true}}, []string{"Oleg", "Ivanna", "Ivan", "Boris", "Anna"}},
+		{"age desc nulls last", []storage.SortField{{Column: "age", Desc: true}}, []string{"Ivanna", "Ivan", "Boris", "Anna", "Oleg"}},
+		{"multi-field", []storage.SortField{{Column: "age", Desc: true}, {Column: "name", Desc: true, NullsFirst: true}}, []string{"Ivanna", "Ivan", "Boris", "Anna", "Oleg"}},
+		{"nullable string", []storage.SortField{{Column: "nationality"}, {Column: "name"}}, []string{"Ivan", "Ivanna", "Anna", "Boris", "Oleg"}},
+		{"id desc", []storage.SortField{{Column: "id", Desc: true, NullsFirst: true}}, []string{"Boris", "Oleg", "Ivanna", "Anna", "Ivan"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res := list(t, s, storage.ListParams{Sort: tc.sort})
+			assert.Equal(t, tc.want, names(res.Items))
+		})
+	}
+}
+
+func testListOffsetPagination(t *testing.T, s storage.Storage) {
+	seed(t, s, fixtures()...)
+	sort := []storage.SortField{{Column: "name"}}
+
+	tests := []struct {
+		name    string
+		offset  int
+		limit   int
+		want    []string
+		hasMore bool
+	}{
+		{"first page", 0, 2, []string{"Anna", "Boris"}, true},
+		{"middle page", 2, 2, []string{"Ivan", "Ivanna"}, true},
+		{"last partial page", 4, 2, []string{"Oleg"}, false},
+		{"limit equals total", 0, 5, []string{"Anna", "Boris", "Ivan", "Ivanna", "Oleg"}, false},
+		{"limit above total", 0, 50, []string{"Anna", "Boris", "Ivan", "Ivanna", "Oleg"}, false},
+		{"offset at end", 5, 2, []string{}, false},
+		{"offset past end", 100, 2, []string{}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res := list(t, s, storage.ListParams{Sort: sort, Offset: tc.offset, Limit: tc.limit})
+			assert.Equal(t, tc.want, names(res.Items))
+			assert.Equal(t, tc.hasMore, res.HasMore)
+			assert.Equal(t, int64(5), res.TotalCount, "total ignores paging")
+		})
+	}
+
+	res := list(t, s, storage.ListParams{Sort: sort, Limit: 2, SkipCount: true})
+	assert.Zero(t, res.TotalCount)
+	assert.True(t, res.HasMore)
+}
+
+func testListKeysetPagination(t *testing.T, s storage.Storage) {
+	seed(t, s, fixtures()...)
+
+	sorts := map[string][]storage.SortField{
+		"id":                   {},
+		"age nulls last":       {{Column: "age"}},
+		"age desc nulls first": {{Column: "age", Desc: true, NullsFirst: true}},
+		"nationality, name":    {{Column: "nationality", Desc: true}, {Column: "name"}},
+		"created_at desc":      {{Column: "created_at", Desc: true, NullsFirst: true}},
+	}
+	for name, sort := range sorts {
+		t.Run(name, func(t *testing.T) {
+			want := names(list(t, s, storage.ListParams{Sort: sort}).Items)
+
+			// обход по две записи должен дать тот же порядок, что и один запрос
+			var got []string
+			var after *storage.Cursor
+			for pages := 0; ; pages++ {
+				require.Less(t, pages, 10, "pagination does not terminate")
+				res := list(t, s, storage.ListParams{Sort: sort, Limit: 2, After: after, SkipCount: true})
+				got = append(got, names(res.Items)...)
+				if !res.HasMore {
+					break
+				}
+				require.NotEmpty(t, res.Items)
+				after = cursorAfter(sort, res.Items[len(res.Items)-1])
+			}
+			assert.Equal(t, want, got)
+		})
+	}
+
+	t.Run("cursor after last item", func(t *testing.T) {
+		all := list(t, s, storage.ListParams{})
+		res := list(t, s, storage.ListParams{Limit: 2, After: cursorAfter(nil, all.Items[len(all.Items)-1])})
+		assert.Empty(t, res.Items)
+		assert.False(t, res.HasMore)
+		assert.Equal(t, int64(5), res.TotalCount, "cursor narrows the page, not the total")
+	})
+
+	t.Run("cursor size mismatch", func(t *testing.T) {
+		_, err := s.ListPersons(context.Background(), storage.ListParams{
+			Sort: []storage.SortField{{Column: "age"}}, Limit: 2,
+			After: &storage.Cursor{Values: []*string{ptr("1")}},
+		})
+		assert.ErrorIs(t, err, storage.ErrInvalid)
+	})
+
+	t.Run("cursor value of wrong type", func(t *testing.T) {
+		for _, tc := range []struct {
+			column string
+			value  string
+		}{
+			{"id", "abc"},
+			{"age", "old"},
+			{"created_at", "yesterday"},
+		} {
+			sort := []storage.SortField{{Column: tc.column}}
+			values := make([]*string, len(storage.NormalizeSort(sort)))
+			for i := range values {
+				values[i] = ptr(tc.value)
+			}
+			_, err := s.ListPersons(context.Background(), storage.ListParams{
+				Sort: sort, Limit: 2, After: &storage.Cursor{Values: values},
+			})
+			assert.ErrorIs(t, err, storage.ErrInvalid, tc.column)
+		}
+	})
+}
+
+// testListCollation фиксирует побайтный порядок строк (UTF-8, как COLLATE "C"):
+// заглавная латиница, строчная латиница, затем кириллица, где Ё идёт раньше А.
+func testListCollation(t *testing.T, s storage.Storage) {
+	seed(t, s,
+		storage.PersonEntity{Name: "алла", Surname: "Test"},
+		storage.PersonEntity{Name: "Zoe", Surname: "Test"},
+		storage.PersonEntity{Name: "Борис", Surname: "Test"},
+		storage.PersonEntity{Name: "anna", Surname: "Test"},
+		storage.PersonEntity{Name: "Ёжик", Surname: "Test"},
+	)
+	want := []string{"Zoe", "anna", "Ёжик", "Борис", "алла"}
+	sort := []storage.SortField{{Column: "name"}}
+
+	assert.Equal(t, want, names(list(t, s, storage.ListParams{Sort: sort}).Items))
+
+	var got []string
+	var after *storage.Cursor
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 10, "pagination does not terminate")
+		res := list(t, s, storage.ListParams{Sort: sort, Limit: 2, After: after, SkipCount: true})
+		got = append(got, names(res.Items)...)
+		if !res.HasMore {
+			break
+		}
+		after = cursorAfter(sort, res.Items[len(res.Items)-1])
+	}
+	assert.Equal(t, want, got, "keyset pages follow the same order")
+}
+
+// cursorAfter собирает курсор так же, как сервис: значение каждого поля нормализованной сортировки.
+func cursorAfter(sort []storage.SortField, last storage.PersonEntity) *storage.Cursor {
+	fields := storage.NormalizeSort(sort)
+	values := make([]*string, len(fields))
+	for i, f := range fields {
+		values[i] = storage.SortValue(last, f.Column)
+	}
+	return &storage.Cursor{Values: values}
+}
+
+func testListSearch(t *testing.T, s storage.Storage) {
+	seed(t, s,
+		storage.PersonEntity{Name: "Иван", Surname: "Петров"},
+		storage.PersonEntity{Name: "Ivanna", Surname: "Sidorova"},
+		storage.PersonEntity{Name: "Anna", Surname: "Ivanova"},
+		storage.PersonEntity{Name: "Oleg", Surname: "Smirnov"},
+	)
+	byScore := []storage.SortField{{Column: storage.ScoreColumn, Desc: true, NullsFirst: true}}
+
+	res := list(t, s, storage.ListParams{Search: ptr("ivan"), Sort: byScore})
+	require.Len(t, res.Items, 3)
+	assert.Equal(t, int64(3), res.TotalCount)
+	assert.Equal(t, "Иван", res.Items[0].Name, "exact word ranks first, Cyrillic is transliterated")
+	for i, p := range res.Items {
+		require.NotNil(t, p.Score)
+		if i > 0 {
+			assert.LessOrEqual(t, *p.Score, *res.Items[i-1].Score)
+		}
+	}
+
+	// кириллический запрос находит латиницу
+	res = list(t, s, storage.ListParams{Search: ptr("Смирнов"), Sort: byScore})
+	assert.Equal(t, []string{"Oleg"}, names(res.Items))
+
+	// поиск сочетается с фильтрами и курсором по релевантности
+	res = list(t, s, storage.ListParams{Search: ptr("ivan"), NameContains: ptr("ann"), Sort: byScore})
+	assert.Equal(t, []string{"Anna", "Ivanna"}, sortedByName(res.Items))
+	first := list(t, s, storage.ListParams{Search: ptr("ivan"), Sort: byScore, Limit: 1})
+	rest := list(t, s, storage.ListParams{
+		Search: ptr("ivan"), Sort: byScore, Limit: 10, After: cursorAfter(byScore, first.Items[0]),
+	})
+	assert.Len(t, rest.Items, 2)
+	assert.NotContains(t, names(rest.Items), first.Items[0].Name)
+
+	res = list(t, s, storage.ListParams{Search: ptr("qwerty")})
+	assert.Empty(t, res.Items)
+
+	// без поиска релевантность не заполняется
+	for _, p := range list(t, s, storage.ListParams{}).Items {
+		assert.Nil(t, p.Score)
+	}
+}
+
+func sortedByName(items []storage.PersonEntity) []string {
+	out := names(items)
+	slices.Sort(out)
+	return out
+}
+
+func testExport(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	seeded := seed(t, s, fixtures()...)
+	require.NoError(t, s.DeletePerson(ctx, seeded[3].ID, 0))
+
+	export := func(params storage.ListParams) ([]string, error) {
+		out := []string{}
+		err := s.ExportPersons(ctx, params, func(p storage.PersonEntity) error {
+			out = append(out, p.Name)
+			return nil
+		})
+		return out, err
+	}
+
+	// пагинация не применяется, фильтры и сортировка — как у ListPersons
+	got, err := export(storage.ListParams{Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Ivan", "Anna", "Ivanna", "Boris"}, got)
+
+	got, err = export(storage.ListParams{
+		Genders: []string{"female"},
+		Sort:    []storage.SortField{{Column: "age", Desc: true, NullsFirst: true}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Ivanna", "Anna"}, got)
+
+	got, err = export(storage.ListParams{IncludeDeleted: true})
+	require.NoError(t, err)
+	assert.Len(t, got, len(seeded))
+
+	// ошибка обработчика прерывает обход
+	stop := errors.New("stop")
+	n := 0
+	err = s.ExportPersons(ctx, storage.ListParams{}, func(storage.PersonEntity) error {
+		n++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, n)
+}
+
+func testFindByNames(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	seeded := seed(t, s, fixtures()...)
+	twin := seed(t, s, storage.PersonEntity{Name: "Anna", Surname: "Petrova"})[0]
+	require.NoError(t, s.DeletePerson(ctx, seeded[3].ID, 0))
+
+	got, err := s.FindPersonsByNames(ctx, []storage.FullName{
+		{Name: "IVAN", Surname: "ivanov", Patronymic: "PETROVICH"},
+		{Name: "anna", Surname: "petrova"},
+		{Name: "Ivan", Surname: "Ivanov"},    // отчество не совпадает
+		{Name: "Ivanna", Surname: "Sidorov"}, // фамилия — не подстрока
+		{Name: "Oleg", Surname: "Smirnov"},   // удалён
+		{Name: "Boris", Surname: "Ivanenko", Patronymic: "Borisovich"},
+	})
+	require.NoError(t, err)
+	ids := make([]int64, len(got))
+	for i, p := range got {
+		ids[i] = p.ID
+	}
+	assert.Equal(t, []int64{seeded[0].ID, seeded[1].ID, twin.ID}, ids)
+	assertSamePerson(t, seeded[0], got[0])
+
+	got, err = s.FindPersonsByNames(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func testIdempotencyKeys(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	// fresh — аренда ещё не истекла, stale — уже истекла
+	fresh, stale := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	k, claimed, err := s.ClaimIdempotencyKey(ctx, "key-1", "fp-1", fresh)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	assert.Equal(t, "fp-1", k.Fingerprint)
+	assert.Zero(t, k.Status, "no response yet")
+
+	// повторный захват возвращает ту же запись, даже с другим отпечатком
+	k, claimed, err = s.ClaimIdempotencyKey(ctx, "key-1", "fp-2", fresh)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Equal(t, "fp-1", k.Fingerprint)
+
+	// ключ без ответа с истёкшей арендой занимается снова, но только тем же запросом
+	_, claimed, err = s.ClaimIdempotencyKey(ctx, "key-1", "fp-2", stale)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	reclaimed, claimed, err := s.ClaimIdempotencyKey(ctx, "key-1", "fp-1", stale)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	assert.Equal(t, "fp-1", reclaimed.Fingerprint)
+	assert.False(t, reclaimed.ClaimedAt.Before(k.ClaimedAt))
+	assert.Greater(t, reclaimed.Claim, k.Claim)
+
+	// первый владелец ключ потерял: его ответ не сохраняется, ключ не освобождается
+	k.Status = 500
+	assert.ErrorIs(t, s.CompleteIdempotencyKey(ctx, k), storage.ErrNotFound)
+	require.NoError(t, s.DeleteIdempotencyKey(ctx, "key-1", k.Claim))
+	got, claimed, err := s.ClaimIdempotencyKey(ctx, "key-1", "fp-1", fresh)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Zero(t, got.Status)
+	assert.Equal(t, reclaimed.Claim, got.Claim)
+
+	reclaimed.Status = 201
+	reclaimed.Header = storage.Header{"Location": "/persons/1"}
+	reclaimed.Body = []byte(`{"id":1}`)
+	require.NoError(t, s.CompleteIdempotencyKey(ctx, reclaimed))
+	got, claimed, err = s.ClaimIdempotencyKey(ctx, "key-1", "fp-1", fresh)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Equal(t, 201, got.Status)
+	assert.Equal(t, reclaimed.Header, got.Header)
+	assert.Equal(t, reclaimed.Body, got.Body)
+	// ключ с ответом аренда не освобождает
+	_, claimed, err = s.ClaimIdempotencyKey(ctx, "key-1", "fp-1", stale)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+
+	err = s.CompleteIdempotencyKey(ctx, storage.IdempotencyKey{Key: "missing", Status: 201})
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	// удалённый ключ можно занять снова
+	require.NoError(t, s.DeleteIdempotencyKey(ctx, "key-1", got.Claim))
+	_, claimed, err = s.ClaimIdempotencyKey(ctx, "key-1", "fp-2", fresh)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+
+	_, _, err = s.ClaimIdempotencyKey(ctx, "key-2", "fp", fresh)
+	require.NoError(t, err)
+	n, err := s.PurgeIdempotencyKeys(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	n, err = s.PurgeIdempotencyKeys(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+}
+
+func testEnrichmentCache(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	_, err := s.GetEnrichmentCache(ctx, "agify::ivan")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	expires := time.Now().Add(time.Hour)
+	require.NoError(t, s.PutEnrichmentCache(ctx, storage.EnrichmentCacheEntry{
+		Key: "agify::ivan", Result: []byte(`{"value": 30}`), ExpiresAt: expires,
+	}))
+	// повторная запись заменяет прежнюю
+	expires = expires.Add(time.Hour)
+	require.NoError(t, s.PutEnrichmentCache(ctx, storage.EnrichmentCacheEntry{
+		Key: "agify::ivan", Result: []byte(`{"value": 31}`), ExpiresAt: expires,
+	}))
+	got, err := s.GetEnrichmentCache(ctx, "agify::ivan")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"value": 31}`, string(got.Result))
+	assert.WithinDuration(t, expires, got.ExpiresAt, time.Millisecond)
+}
+
+func testEnrichmentRetries(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	pending := func(name string, at time.Time) storage.PersonEntity {
+		return storage.PersonEntity{Name: name, Surname: "S",
+			Enrichment: storage.Enrichment{
+				"age": {Status: "pending", Error: "agify: status 503", Attempts: 1, RetryAt: &at},
+			},
+			EnrichmentRetryAt: &at,
+		}
+	}
+	later, err := s.CreatePerson(ctx, pending("Later", now.Add(-time.Minute)))
+	require.NoError(t, err)
+	first, err := s.CreatePerson(ctx, pending("First", now.Add(-2*time.Minute)))
+	require.NoError(t, err)
+	_, err = s.CreatePerson(ctx, pending("Future", now.Add(time.Hour)))
+	require.NoError(t, err)
+	_, err = s.CreatePerson(ctx, storage.PersonEntity{Name: "Done", Surname: "S"})
+	require.NoError(t, err)
+	deleted, err := s.CreatePerson(ctx, pending("Deleted", now.Add(-time.Hour)))
+	require.NoError(t, err)
+	require.NoError(t, s.DeletePerson(ctx, deleted.ID, 0))
+
+	got, err := s.ListEnrichmentRetries(ctx, now, 10)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assertSamePerson(t, first, got[0])
+	assert.Equal(t, later.ID, got[1].ID)
+	require.NotNil(t, got[0].EnrichmentRetryAt)
+	assert.WithinDuration(t, now.Add(-2*time.Minute), *got[0].EnrichmentRetryAt, time.Millisecond)
+
+	got, err = s.ListEnrichmentRetries(ctx, now, 1)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, first.ID, got[0].ID)
+
+	// повторять больше нечего
+	first.Enrichment = storage.Enrichment{"age": {Status: "complete", Provider: "agify"}}
+	first.EnrichmentRetryAt = nil
+	_, err = s.UpdatePerson(ctx, first.ID, first)
+	require.NoError(t, err)
+	got, err = s.ListEnrichmentRetries(ctx, now, 10)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, later.ID, got[0].ID)
+}
+
+func testUpdateEnrichment(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	p, err := s.CreatePerson(ctx, storage.PersonEntity{Name: "Ivan", Surname: "Ivanov",
+		Enrichment: storage.Enrichment{"age": {Status: "pending"}}})
+	require.NoError(t, err)
+	retry := time.Now().Add(time.Hour).UTC().Truncate(time.Microsecond)
+	got, err := s.UpdateEnrichment(ctx, p.ID, func(e *storage.PersonEntity) {
+		assert.Equal(t, "Ivan", e.Name)
+		age := 40
+		e.Age = &age
+		e.Enrichment = storage.Enrichment{
+			"age":    {Status: "complete", Provider: "agify"},
+			"gender": {Status: "pending", Attempts: 1, RetryAt: &retry},
+		}
+		e.EnrichmentRetryAt = &retry
+		// прочие поля не сохраняются
+		e.Name = "Other"
+		e.Version = 100
+	})
+	require.NoError(t, err)
+	require.NotNil(t, got.Age)
+	assert.Equal(t, 40, *got.Age)
+	assert.Equal(t, "Ivan", got.Name)
+	// версия и история — только для изменений пользователя
+	assert.Equal(t, p.Version, got.Version)
+	assert.True(t, p.UpdatedAt.Equal(got.UpdatedAt))
+
+	stored, err := s.GetPersonByID(ctx, p.ID)
+	require.NoError(t, err)
+	assertSamePerson(t, got, stored)
+	assert.Equal(t, "complete", stored.Enrichment["age"].Status)
+	require.NotNil(t, stored.EnrichmentRetryAt)
+	assert.True(t, retry.Equal(*stored.EnrichmentRetryAt))
+	h, err := s.GetPersonHistory(ctx, p.ID)
+	require.NoError(t, err)
+	assert.Len(t, h, 1)
+
+	require.NoError(t, s.DeletePerson(ctx, p.ID, 0))
+	_, err = s.UpdateEnrichment(ctx, p.ID, func(*storage.PersonEntity) {})
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testEnrichmentJobs(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	none, err := s.ClaimEnrichmentJobs(ctx, 10, time.Hour)
+	require.NoError(t, err)
+	assert.Empty(t, none)
+
+	created, err := s.CreatePersonsQueued(ctx, []storage.PersonEntity{
+		{Name: "First", Surname: "S", Enrichment: storage.Enrichment{"age": {Status: "pending"}}},
+		{Name: "Second", Surname: "S"},
+		{Name: "Third", Surname: "S"},
+	})
+	require.NoError(t, err)
+	require.Len(t, created, 3)
+	got, err := s.GetPersonByID(ctx, created[0].ID)
+	require.NoError(t, err)
+	assertSamePerson(t, created[0], got)
+	stats, err := s.EnrichmentQueueStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Queued)
+	require.NotNil(t, stats.OldestQueued)
+
+	claimed, err := s.ClaimEnrichmentJobs(ctx, 2, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	first, second := claimed[0], claimed[1]
+	assert.Equal(t, created[0].ID, first.PersonID)
+	assert.Equal(t, created[1].ID, second.PersonID)
+	assert.Equal(t, storage.JobRunning, first.Status)
+	assert.Equal(t, 1, first.Attempts)
+	assert.True(t, first.RunAt.After(time.Now().Add(50*time.Minute)), "run_at is the lease end")
+	claimed, err = s.ClaimEnrichmentJobs(ctx, 10, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	third := claimed[0]
+	assert.Equal(t, created[2].ID, third.PersonID)
+	// все задания заняты
+	none, err = s.ClaimEnrichmentJobs(ctx, 10, time.Hour)
+	require.NoError(t, err)
+	assert.Empty(t, none)
+
+	require.NoError(t, s.RetryEnrichmentJob(ctx, first, time.Now().Add(-time.Second), "agify: status 503"))
+	claimed, err = s.ClaimEnrichmentJobs(ctx, 10, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	again := claimed[0]
+	assert.Equal(t, first.ID, again.ID)
+	assert.Equal(t, 2, again.Attempts)
+	require.NotNil(t, again.LastError)
+	assert.Equal(t, "agify: status 503", *again.LastError)
+
+	require.NoError(t, s.BuryEnrichmentJob(ctx, again, "gave up"))
+	require.NoError(t, s.CompleteEnrichmentJob(ctx, second))
+	require.NoError(t, s.CompleteEnrichmentJob(ctx, third))
+	stats, err = s.EnrichmentQueueStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, storage.EnrichmentQueueStats{Dead: 1}, stats)
+	// dead-задание больше не выдаётся
+	none, err = s.ClaimEnrichmentJobs(ctx, 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, none)
+
+	// аренда истекла: обработчик упал, задание берёт другой
+	fourth, err := s.CreatePersonsQueued(ctx, []storage.PersonEntity{{Name: "Fourth", Surname: "S"}})
+	require.NoError(t, err)
+	lost, err := s.ClaimEnrichmentJobs(ctx, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, lost, 1)
+	retaken, err := s.ClaimEnrichmentJobs(ctx, 10, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, retaken, 1)
+	assert.Equal(t, lost[0].ID, retaken[0].ID)
+	assert.Equal(t, 2, retaken[0].Attempts)
+	// прежний обработчик задание больше не меняет
+	require.NoError(t, s.CompleteEnrichmentJob(ctx, lost[0]))
+	require.NoError(t, s.RetryEnrichmentJob(ctx, lost[0], time.Now().Add(-time.Second), "late"))
+	require.NoError(t, s.BuryEnrichmentJob(ctx, lost[0], "late"))
+	stats, err = s.EnrichmentQueueStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, storage.EnrichmentQueueStats{Running: 1, Dead: 1}, stats)
+	none, err = s.ClaimEnrichmentJobs(ctx, 10, time.Hour)
+	require.NoError(t, err)
+	assert.Empty(t, none, "job still leased to the new worker")
+
+	// задания удаляются вместе с записью
+	require.NoError(t, s.DeletePerson(ctx, fourth[0].ID, 0))
+	require.NoError(t, s.DeletePerson(ctx, created[0].ID, 0))
+	_, err = s.PurgeDeleted(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	stats, err = s.EnrichmentQueueStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, storage.EnrichmentQueueStats{}, stats)
+
+	// задание удалённой записи ничего не делает: восстановление ставит её в очередь заново
+	fifth, err := s.CreatePersonsQueued(ctx, []storage.PersonEntity{
+		{Name: "Fifth", Surname: "S", Enrichment: storage.Enrichment{"age": {Status: "pending"}}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.DeletePerson(ctx, fifth[0].ID, 0))
+	claimed, err = s.ClaimEnrichmentJobs(ctx, 10, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.NoError(t, s.CompleteEnrichmentJob(ctx, claimed[0]))
+	_, err = s.RestorePerson(ctx, fifth[0].ID)
+	require.NoError(t, err)
+	claimed, err = s.ClaimEnrichmentJobs(ctx, 10, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, fifth[0].ID, claimed[0].PersonID)
+	require.NoError(t, s.CompleteEnrichmentJob(ctx, claimed[0]))
+	// без ждущих атрибутов восстановление очередь не трогает
+	plain, err := s.CreatePerson(ctx, storage.PersonEntity{Name: "Sixth", Surname: "S"})
+	require.NoError(t, err)
+	require.NoError(t, s.DeletePerson(ctx, plain.ID, 0))
+	_, err = s.RestorePerson(ctx, plain.ID)
+	require.NoError(t, err)
+	none, err = s.ClaimEnrichmentJobs(ctx, 10, time.Hour)
+	require.NoError(t, err)
+	assert.Empty(t, none)
+}